@@ -4,7 +4,9 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	"pet-proj/pkg/kafka"
 	"pet-proj/pkg/postgres"
 	"pet-proj/pkg/redis"
+	"pet-proj/pkg/redisstream"
 	"pet-proj/proto/consumer"
 )
 
@@ -25,23 +28,84 @@ var (
 	buildTime = "unknown"
 )
 
+// читатель событий выбранного транспорта с именем для логов
+type namedConsumer struct {
+	name     string
+	consumer kafka.ConsumerInterface
+}
+
 func main() {
 	cfg := &config.Config{
 		Service: config.ServiceConfig{
 			Name:     getEnv("SERVICE_NAME", "consumer"),
 			Port:     getEnvAsInt("SERVICE_PORT", 8080),
 			GRPCPort: getEnvAsInt("GRPC_PORT", 9091),
+			// Крупные события приходят по gRPC целиком, до выноса payload
+			GRPCMaxMessageSize: getEnvAsInt("GRPC_MAX_MESSAGE_SIZE", 4*1024*1024),
+			MaxBatchSize:       getEnvAsInt("MAX_BATCH_SIZE", 100),
 		},
 		Kafka: config.KafkaConfig{
-			Brokers: []string{getEnv("KAFKA_BROKERS", "kafka:29092")},
-			Topic:   getEnv("KAFKA_TOPIC", "user-events"),
-			GroupID: getEnv("KAFKA_GROUP_ID", "consumer-group"),
+			Brokers:          []string{getEnv("KAFKA_BROKERS", "kafka:29092")},
+			Topic:            getEnv("KAFKA_TOPIC", "user-events"),
+			GroupID:          getEnv("KAFKA_GROUP_ID", "consumer-group"),
+			Routes:           getEnvAsRoutes("KAFKA_ROUTES"),
+			Topics:           getEnvAsSlice("KAFKA_TOPICS", ""),
+			DeadLetterTopic:  getEnv("KAFKA_DEAD_LETTER_TOPIC", "user-events.dlq"),
+			RetryDelays:      getEnvAsDurations("KAFKA_RETRY_DELAYS", "5s,1m,10m"),
+			RetryMaxAttempts: getEnvAsInt("KAFKA_RETRY_MAX_ATTEMPTS", 3),
+			Workers:          getEnvAsInt("KAFKA_WORKERS", 1),
+			QueueDepth:       getEnvAsInt("KAFKA_QUEUE_DEPTH", 100),
+			MessageTimeout:   getEnvAsDuration("KAFKA_MESSAGE_TIMEOUT", "30s"),
+			Security: config.SecurityConfig{
+				TLS: config.TLSConfig{
+					Enabled:            getEnvAsBool("KAFKA_TLS_ENABLED", false),
+					CAFile:             getEnv("KAFKA_TLS_CA_FILE", ""),
+					CertFile:           getEnv("KAFKA_TLS_CERT_FILE", ""),
+					KeyFile:            getEnv("KAFKA_TLS_KEY_FILE", ""),
+					ServerName:         getEnv("KAFKA_TLS_SERVER_NAME", ""),
+					InsecureSkipVerify: getEnvAsBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false),
+				},
+				SASL: config.SASLConfig{
+					Mechanism: getEnv("KAFKA_SASL_MECHANISM", ""),
+					Username:  getEnv("KAFKA_SASL_USERNAME", ""),
+					Password:  getEnv("KAFKA_SASL_PASSWORD", ""),
+				},
+			},
+			Provisioning: config.ProvisioningConfig{
+				Enabled: getEnvAsBool("KAFKA_PROVISION_ENABLED", true),
+				DryRun:  getEnvAsBool("KAFKA_PROVISION_DRY_RUN", false),
+				Defaults: config.TopicSpec{
+					Partitions:        getEnvAsInt("KAFKA_TOPIC_PARTITIONS", 3),
+					ReplicationFactor: getEnvAsInt("KAFKA_TOPIC_REPLICATION_FACTOR", 1),
+					Retention:         getEnvAsDuration("KAFKA_TOPIC_RETENTION", "168h"),
+					CleanupPolicy:     getEnv("KAFKA_TOPIC_CLEANUP_POLICY", "delete"),
+				},
+				Topics: getEnvAsTopicSpecs("KAFKA_PROVISION_TOPICS"),
+			},
+			Delivery: config.DeliveryConfig{
+				Mode:       getEnv("KAFKA_DELIVERY_MODE", "forward"),
+				Backoff:    getEnvAsDuration("KAFKA_DELIVERY_BACKOFF", "500ms"),
+				MaxBackoff: getEnvAsDuration("KAFKA_DELIVERY_MAX_BACKOFF", "30s"),
+			},
 		},
 		Redis: config.RedisConfig{
+			Mode:     getEnv("REDIS_MODE", "standalone"),
 			Addr:     getEnv("REDIS_ADDR", "redis:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
 			Timeout:  getEnvAsDuration("REDIS_TIMEOUT", "5s"),
+
+			ClusterAddrs:     getEnvAsSlice("REDIS_CLUSTER_ADDRS", ""),
+			MasterName:       getEnv("REDIS_MASTER_NAME", ""),
+			SentinelAddrs:    getEnvAsSlice("REDIS_SENTINEL_ADDRS", ""),
+			SentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+			ReadFrom:         getEnv("REDIS_READ_FROM", "primary"),
+
+			PoolStatsInterval: getEnvAsDuration("REDIS_POOL_STATS_INTERVAL", "15s"),
+
+			Codec:                getEnv("REDIS_CODEC", "json"),
+			Compression:          getEnv("REDIS_COMPRESSION", "none"),
+			CompressionThreshold: getEnvAsInt("REDIS_COMPRESSION_THRESHOLD", 1024),
 		},
 		Postgres: config.PostgresConfig{
 			Host:     getEnv("POSTGRES_HOST", "postgres"),
@@ -55,6 +119,29 @@ func main() {
 			PrometheusPort: getEnvAsInt("PROMETHEUS_PORT", 9090),
 			JaegerEndpoint: getEnv("JAEGER_ENDPOINT", "http://localhost:14268/api/traces"),
 		},
+		ClaimCheck: config.ClaimCheckConfig{
+			Enabled:   getEnvAsBool("CLAIM_CHECK_ENABLED", true),
+			Threshold: getEnvAsInt("CLAIM_CHECK_THRESHOLD", 524288),
+			Store:     getEnv("CLAIM_CHECK_STORE", "redis"),
+			Dir:       getEnv("CLAIM_CHECK_DIR", "/var/lib/pet-proj/payloads"),
+			TTL:       getEnvAsDuration("CLAIM_CHECK_TTL", "168h"),
+		},
+		Dedup: config.DedupConfig{
+			Enabled: getEnvAsBool("DEDUP_ENABLED", true),
+			Window:  getEnvAsDuration("DEDUP_WINDOW", "24h"),
+			Lease:   getEnvAsDuration("DEDUP_LEASE", "5m"),
+		},
+		Transport: config.TransportConfig{
+			Type: getEnv("EVENT_TRANSPORT", "kafka"),
+			Streams: config.StreamsConfig{
+				MaxLen:        int64(getEnvAsInt("REDIS_STREAM_MAX_LEN", 1000000)),
+				BatchSize:     getEnvAsInt("REDIS_STREAM_BATCH_SIZE", 100),
+				Block:         getEnvAsDuration("REDIS_STREAM_BLOCK", "2s"),
+				ClaimIdle:     getEnvAsDuration("REDIS_STREAM_CLAIM_IDLE", "1m"),
+				ClaimInterval: getEnvAsDuration("REDIS_STREAM_CLAIM_INTERVAL", "30s"),
+				MaxDeliveries: int64(getEnvAsInt("REDIS_STREAM_MAX_DELIVERIES", 5)),
+			},
+		},
 	}
 
 	logrus.SetLevel(logrus.InfoLevel)
@@ -82,7 +169,10 @@ func main() {
 		logrus.Fatalf("Failed to create transaction table: %v", err)
 	}
 
-	redisClient := redis.NewClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, logrus.StandardLogger())
+	redisClient, err := config.NewRedisClient(cfg.Redis, logrus.StandardLogger())
+	if err != nil {
+		logrus.Fatalf("Failed to create Redis client: %v", err)
+	}
 	defer redisClient.Close()
 
 	ctx := context.Background()
@@ -90,17 +180,159 @@ func main() {
 		logrus.Fatalf("Failed to connect to Redis: %v", err)
 	}
 
-	kafkaConsumer, err := kafka.NewConsumer(cfg.Kafka.Brokers, cfg.Kafka.Topic, cfg.Kafka.GroupID, logrus.StandardLogger())
+	// Consumer читает выбранные топики из маршрутов или все, если выбор не задан
+	topicRouter, err := config.NewTopicRouter(cfg.Kafka)
 	if err != nil {
-		logrus.Fatalf("Failed to create Kafka consumer: %v", err)
+		logrus.Fatalf("Failed to create Kafka topic router: %v", err)
+	}
+	topics := cfg.Kafka.Topics
+	if len(topics) == 0 {
+		topics = topicRouter.Topics()
+	}
+	for _, topic := range topics {
+		if !slices.Contains(topicRouter.Topics(), topic) {
+			logrus.WithField("topic", topic).Warn("Subscribed topic is not a routing target")
+		}
 	}
-	defer kafkaConsumer.Close()
 
 	consumerService := services.NewConsumerService(redisClient, postgresClient, logrus.StandardLogger())
-	kafkaConsumer.SetHandler(consumerService)
+	consumerService.SetMaxBatchSize(cfg.Service.MaxBatchSize)
+
+	// Вынесенные producer payload загружаются до обработки события; хранилище
+	// подключаем всегда, чтобы прочитать сообщения, отправленные до его отключения
+	payloadStore, err := config.NewPayloadStore(cfg.ClaimCheck, redisClient)
+	if err != nil {
+		logrus.Fatalf("Failed to create payload store: %v", err)
+	}
+	consumerService.SetClaimCheck(payloadStore)
+
+	// Повторно доставленные после ребаланса события пропускаем по event_id
+	if cfg.Dedup.Enabled {
+		consumerService.SetDeduplicator(redis.NewDeduplicator(redisClient, cfg.Dedup.Window, cfg.Dedup.Lease))
+	}
+
+	// Читатели событий запускаются после gRPC сервера
+	var eventConsumers []namedConsumer
+	switch cfg.Transport.Type {
+	case config.TransportKafka:
+		// Все клиенты Kafka используют одни настройки TLS и SASL
+		security := config.KafkaSecurity(cfg.Kafka.Security)
+
+		// Создаем недостающие топики до подписки: читаемые, dead-letter и retry
+		provisionNames := append([]string{}, topics...)
+		if cfg.Kafka.DeadLetterTopic != "" {
+			provisionNames = append(provisionNames, cfg.Kafka.DeadLetterTopic)
+		}
+		for _, delay := range cfg.Kafka.RetryDelays {
+			provisionNames = append(provisionNames, kafka.RetryTopicName(cfg.Kafka.Topic, delay))
+		}
+		if err := config.ProvisionTopics(context.Background(), cfg.Kafka, provisionNames, logrus.StandardLogger()); err != nil {
+			logrus.Fatalf("Failed to provision Kafka topics: %v", err)
+		}
+
+		kafkaConsumer, err := kafka.NewConsumer(cfg.Kafka.Brokers, security, topics, cfg.Kafka.GroupID, logrus.StandardLogger())
+		if err != nil {
+			logrus.Fatalf("Failed to create Kafka consumer: %v", err)
+		}
+		defer kafkaConsumer.Close()
+
+		// Режим доставки задается для основной consumer group; retry group всегда
+		// передает неудачные сообщения на следующую ступень
+		if err := kafkaConsumer.SetDeliveryMode(cfg.Kafka.Delivery.Mode, cfg.Kafka.Delivery.Backoff, cfg.Kafka.Delivery.MaxBackoff); err != nil {
+			logrus.Fatalf("Failed to configure Kafka consumer: %v", err)
+		}
+		kafkaConsumer.SetWorkerPool(cfg.Kafka.Workers, cfg.Kafka.QueueDepth, cfg.Kafka.MessageTimeout)
+		logrus.WithFields(logrus.Fields{
+			"group_id":      cfg.Kafka.GroupID,
+			"topics":        topics,
+			"delivery_mode": cfg.Kafka.Delivery.Mode,
+			"workers":       cfg.Kafka.Workers,
+		}).Info("Kafka consumer created")
+		kafkaConsumer.SetHandler(consumerService)
+		eventConsumers = append(eventConsumers, namedConsumer{name: "Kafka consumer", consumer: kafkaConsumer})
+
+		// Необработанные сообщения перекладываем в dead-letter топик
+		var deadLetters kafka.DeadLetterQueueInterface
+		if cfg.Kafka.DeadLetterTopic != "" {
+			deadLetters, err = kafka.NewDeadLetterQueue(cfg.Kafka.Brokers, security, cfg.Kafka.DeadLetterTopic, cfg.Kafka.Topic, logrus.StandardLogger())
+			if err != nil {
+				logrus.Fatalf("Failed to create Kafka dead-letter queue: %v", err)
+			}
+			defer deadLetters.Close()
+
+			kafkaConsumer.SetDeadLetterQueue(deadLetters)
+			consumerService.SetDeadLetterQueue(deadLetters)
+		}
+
+		// Перед dead-letter топиком даем сообщению несколько попыток через retry топики;
+		// без dead-letter топика сообщение после последней попытки некуда переложить
+		var retryConsumer *kafka.Consumer
+		if len(cfg.Kafka.RetryDelays) > 0 {
+			if deadLetters == nil {
+				logrus.Fatal("Kafka retry topics require KAFKA_DEAD_LETTER_TOPIC")
+			}
+			retryTopics, err := kafka.NewRetryTopics(cfg.Kafka.Brokers, security, cfg.Kafka.Topic, cfg.Kafka.RetryDelays, cfg.Kafka.RetryMaxAttempts, deadLetters, logrus.StandardLogger())
+			if err != nil {
+				logrus.Fatalf("Failed to create Kafka retry topics: %v", err)
+			}
+			defer retryTopics.Close()
+
+			retryConsumer, err = kafka.NewRetryConsumer(cfg.Kafka.Brokers, security, retryTopics, cfg.Kafka.GroupID+"-retry", logrus.StandardLogger())
+			if err != nil {
+				logrus.Fatalf("Failed to create Kafka retry consumer: %v", err)
+			}
+			defer retryConsumer.Close()
+
+			kafkaConsumer.SetRetryTopics(retryTopics)
+			retryConsumer.SetHandler(consumerService)
+			// Retry топики обрабатываются последовательно, чтобы соблюдать задержки
+			retryConsumer.SetWorkerPool(1, 1, cfg.Kafka.MessageTimeout)
+			eventConsumers = append(eventConsumers, namedConsumer{name: "Kafka retry consumer", consumer: retryConsumer})
+		}
+
+		// Административные методы приостанавливают чтение основной и retry consumer group
+		if retryConsumer != nil {
+			consumerService.SetConsumers(kafkaConsumer, retryConsumer)
+		} else {
+			consumerService.SetConsumers(kafkaConsumer)
+		}
+
+	case config.TransportRedisStreams:
+		// Потоки создаются вместе с группой; retry ступеней и приостановки партиций нет,
+		// неподтвержденные записи забираются через ClaimIdle
+		streamConfig := config.RedisStreamConfig(cfg.Transport.Streams)
+		streamConfig.MessageTimeout = cfg.Kafka.MessageTimeout
+		streamConsumer, err := redisstream.NewConsumer(redisClient, streamConfig, topics, cfg.Kafka.GroupID, logrus.StandardLogger())
+		if err != nil {
+			logrus.Fatalf("Failed to create Redis stream consumer: %v", err)
+		}
+		defer streamConsumer.Close()
+
+		if err := streamConsumer.SetDeliveryMode(cfg.Kafka.Delivery.Mode); err != nil {
+			logrus.Fatalf("Failed to configure Redis stream consumer: %v", err)
+		}
+		// В режиме forward необработанную запись некуда переложить без dead-letter потока
+		if cfg.Kafka.DeadLetterTopic != "" {
+			streamConsumer.SetDeadLetterTopic(cfg.Kafka.DeadLetterTopic)
+		} else if cfg.Kafka.Delivery.Mode == kafka.DeliveryModeForward {
+			logrus.Fatal("Redis stream forward delivery mode requires KAFKA_DEAD_LETTER_TOPIC")
+		}
+		streamConsumer.SetHandler(consumerService)
+		logrus.WithFields(logrus.Fields{
+			"group_id":      cfg.Kafka.GroupID,
+			"topics":        topics,
+			"delivery_mode": cfg.Kafka.Delivery.Mode,
+		}).Info("Redis stream consumer created")
+		eventConsumers = append(eventConsumers, namedConsumer{name: "Redis stream consumer", consumer: streamConsumer})
+
+	default:
+		logrus.Fatalf("Unknown event transport: %s", cfg.Transport.Type)
+	}
 
 	// Настраиваем gRPC сервер
 	grpcConfig := grpc.DefaultServerConfig(cfg.Service.GRPCPort, logrus.StandardLogger())
+	grpcConfig.MaxRecvMsgSize = cfg.Service.GRPCMaxMessageSize
+	grpcConfig.MaxSendMsgSize = cfg.Service.GRPCMaxMessageSize
 	grpcServer := grpc.NewServer(grpcConfig)
 
 	// Регистрируем gRPC handlers
@@ -119,12 +351,14 @@ func main() {
 
 	logrus.Infof("Consumer Service started on gRPC port %d", cfg.Service.GRPCPort)
 
-	go func() {
-		logrus.Info("Starting Kafka consumer")
-		if err := kafkaConsumer.Start(ctx); err != nil {
-			logrus.WithError(err).Error("Kafka consumer stopped")
-		}
-	}()
+	for _, c := range eventConsumers {
+		go func(c namedConsumer) {
+			logrus.Info("Starting " + c.name)
+			if err := c.consumer.Start(ctx); err != nil {
+				logrus.WithError(err).Error(c.name + " stopped")
+			}
+		}(c)
+	}
 
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -167,3 +401,58 @@ func getEnvAsDuration(key, defaultValue string) time.Duration {
 	duration, _ := time.ParseDuration(defaultValue)
 	return duration
 }
+
+func getEnvAsDurations(key, defaultValue string) []time.Duration {
+	value := getEnv(key, defaultValue)
+
+	var durations []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(part); err == nil {
+			durations = append(durations, duration)
+		}
+	}
+	return durations
+}
+
+// получает список значений через запятую из переменной окружения
+func getEnvAsSlice(key, defaultValue string) []string {
+	var result []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// получает маршруты событий вида "pattern=topic,pattern=topic" из переменной окружения
+func getEnvAsRoutes(key string) []config.TopicRoute {
+	routes, err := config.ParseTopicRoutes(os.Getenv(key))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return routes
+}
+
+// получает переменную окружения как bool или возвращает значение по умолчанию
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// получает спецификации топиков из переменной окружения
+func getEnvAsTopicSpecs(key string) []config.TopicSpec {
+	specs, err := config.ParseTopicSpecs(os.Getenv(key))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return specs
+}
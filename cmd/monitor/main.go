@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,7 +17,6 @@ import (
 	"pet-proj/internal/services"
 	"pet-proj/pkg/grpc"
 	"pet-proj/pkg/postgres"
-	"pet-proj/pkg/redis"
 	"pet-proj/proto/monitor"
 )
 
@@ -36,12 +36,40 @@ func main() {
 			Brokers: []string{getEnv("KAFKA_BROKERS", "kafka:29092")},
 			Topic:   getEnv("KAFKA_TOPIC", "user-events"),
 			GroupID: getEnv("KAFKA_GROUP_ID", "consumer-group"),
+			Security: config.SecurityConfig{
+				TLS: config.TLSConfig{
+					Enabled:            getEnvAsBool("KAFKA_TLS_ENABLED", false),
+					CAFile:             getEnv("KAFKA_TLS_CA_FILE", ""),
+					CertFile:           getEnv("KAFKA_TLS_CERT_FILE", ""),
+					KeyFile:            getEnv("KAFKA_TLS_KEY_FILE", ""),
+					ServerName:         getEnv("KAFKA_TLS_SERVER_NAME", ""),
+					InsecureSkipVerify: getEnvAsBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false),
+				},
+				SASL: config.SASLConfig{
+					Mechanism: getEnv("KAFKA_SASL_MECHANISM", ""),
+					Username:  getEnv("KAFKA_SASL_USERNAME", ""),
+					Password:  getEnv("KAFKA_SASL_PASSWORD", ""),
+				},
+			},
 		},
 		Redis: config.RedisConfig{
+			Mode:     getEnv("REDIS_MODE", "standalone"),
 			Addr:     getEnv("REDIS_ADDR", "redis:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
 			Timeout:  getEnvAsDuration("REDIS_TIMEOUT", "5s"),
+
+			ClusterAddrs:     getEnvAsSlice("REDIS_CLUSTER_ADDRS", ""),
+			MasterName:       getEnv("REDIS_MASTER_NAME", ""),
+			SentinelAddrs:    getEnvAsSlice("REDIS_SENTINEL_ADDRS", ""),
+			SentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+			ReadFrom:         getEnv("REDIS_READ_FROM", "primary"),
+
+			PoolStatsInterval: getEnvAsDuration("REDIS_POOL_STATS_INTERVAL", "15s"),
+
+			Codec:                getEnv("REDIS_CODEC", "json"),
+			Compression:          getEnv("REDIS_COMPRESSION", "none"),
+			CompressionThreshold: getEnvAsInt("REDIS_COMPRESSION_THRESHOLD", 1024),
 		},
 		Postgres: config.PostgresConfig{
 			Host:     getEnv("POSTGRES_HOST", "postgres"),
@@ -54,6 +82,8 @@ func main() {
 		Monitoring: config.MonitoringConfig{
 			PrometheusPort: getEnvAsInt("PROMETHEUS_PORT", 9090),
 			JaegerEndpoint: getEnv("JAEGER_ENDPOINT", "http://localhost:14268/api/traces"),
+			LagGroups:      getEnvAsSlice("KAFKA_LAG_GROUPS", "consumer-group"),
+			LagThreshold:   int64(getEnvAsInt("KAFKA_LAG_THRESHOLD", 1000)),
 		},
 	}
 
@@ -82,7 +112,14 @@ func main() {
 		logrus.Fatalf("Failed to create transaction table: %v", err)
 	}
 
-	redisClient := redis.NewClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, logrus.StandardLogger())
+	if err := postgresClient.CreateHealthCheckTable(); err != nil {
+		logrus.Fatalf("Failed to create health checks table: %v", err)
+	}
+
+	redisClient, err := config.NewRedisClient(cfg.Redis, logrus.StandardLogger())
+	if err != nil {
+		logrus.Fatalf("Failed to create Redis client: %v", err)
+	}
 	defer redisClient.Close()
 
 	ctx := context.Background()
@@ -95,11 +132,12 @@ func main() {
 		cfg.Postgres.Host, cfg.Postgres.Port, cfg.Postgres.Username, cfg.Postgres.Password, cfg.Postgres.Database, cfg.Postgres.SSLMode)
 
 	// Инициализируем сервисы
-	monitorService, err := services.NewMonitorService(postgresClient, redisClient, cfg.Kafka.Brokers, postgresDSN, logrus.StandardLogger())
+	monitorService, err := services.NewMonitorService(postgresClient, redisClient, cfg.Kafka.Brokers, config.KafkaSecurity(cfg.Kafka.Security), postgresDSN, logrus.StandardLogger())
 	if err != nil {
 		logrus.Fatalf("Failed to create monitor service: %v", err)
 	}
 	defer monitorService.Close()
+	monitorService.SetConsumerLagTracking(cfg.Monitoring.LagGroups, cfg.Monitoring.LagThreshold)
 
 	// Настраиваем gRPC сервер
 	grpcConfig := grpc.DefaultServerConfig(cfg.Service.GRPCPort, logrus.StandardLogger())
@@ -165,3 +203,22 @@ func getEnvAsDuration(key, defaultValue string) time.Duration {
 	return duration
 }
 
+func getEnvAsSlice(key, defaultValue string) []string {
+	var result []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// получает переменную окружения как bool или возвращает значение по умолчанию
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -16,6 +17,7 @@ import (
 	"pet-proj/pkg/grpc"
 	"pet-proj/pkg/kafka"
 	"pet-proj/pkg/redis"
+	"pet-proj/pkg/redisstream"
 	"pet-proj/proto/producer"
 )
 
@@ -31,17 +33,75 @@ func main() {
 			Name:     getEnv("SERVICE_NAME", "producer"),
 			Port:     getEnvAsInt("SERVICE_PORT", 8080),
 			GRPCPort: getEnvAsInt("GRPC_PORT", 9090),
+			// Крупные события приходят по gRPC целиком, до выноса payload
+			GRPCMaxMessageSize: getEnvAsInt("GRPC_MAX_MESSAGE_SIZE", 4*1024*1024),
+			MaxBatchSize:       getEnvAsInt("MAX_BATCH_SIZE", 100),
 		},
 		Kafka: config.KafkaConfig{
-			Brokers: []string{getEnv("KAFKA_BROKERS", "kafka:29092")},
-			Topic:   getEnv("KAFKA_TOPIC", "user-events"),
-			GroupID: getEnv("KAFKA_GROUP_ID", "consumer-group"),
+			Brokers:     []string{getEnv("KAFKA_BROKERS", "kafka:29092")},
+			Topic:       getEnv("KAFKA_TOPIC", "user-events"),
+			GroupID:     getEnv("KAFKA_GROUP_ID", "consumer-group"),
+			Routes:      getEnvAsRoutes("KAFKA_ROUTES"),
+			Codec:       getEnv("KAFKA_CODEC", "json"),
+			TopicCodecs: getEnvAsMap("KAFKA_TOPIC_CODECS"),
+			Security: config.SecurityConfig{
+				TLS: config.TLSConfig{
+					Enabled:            getEnvAsBool("KAFKA_TLS_ENABLED", false),
+					CAFile:             getEnv("KAFKA_TLS_CA_FILE", ""),
+					CertFile:           getEnv("KAFKA_TLS_CERT_FILE", ""),
+					KeyFile:            getEnv("KAFKA_TLS_KEY_FILE", ""),
+					ServerName:         getEnv("KAFKA_TLS_SERVER_NAME", ""),
+					InsecureSkipVerify: getEnvAsBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false),
+				},
+				SASL: config.SASLConfig{
+					Mechanism: getEnv("KAFKA_SASL_MECHANISM", ""),
+					Username:  getEnv("KAFKA_SASL_USERNAME", ""),
+					Password:  getEnv("KAFKA_SASL_PASSWORD", ""),
+				},
+			},
+			Provisioning: config.ProvisioningConfig{
+				Enabled: getEnvAsBool("KAFKA_PROVISION_ENABLED", true),
+				DryRun:  getEnvAsBool("KAFKA_PROVISION_DRY_RUN", false),
+				Defaults: config.TopicSpec{
+					Partitions:        getEnvAsInt("KAFKA_TOPIC_PARTITIONS", 3),
+					ReplicationFactor: getEnvAsInt("KAFKA_TOPIC_REPLICATION_FACTOR", 1),
+					Retention:         getEnvAsDuration("KAFKA_TOPIC_RETENTION", "168h"),
+					CleanupPolicy:     getEnv("KAFKA_TOPIC_CLEANUP_POLICY", "delete"),
+				},
+				Topics: getEnvAsTopicSpecs("KAFKA_PROVISION_TOPICS"),
+			},
+			Producer: config.ProducerConfig{
+				Mode:                  getEnv("KAFKA_PRODUCER_MODE", "sync"),
+				BatchSize:             getEnvAsInt("KAFKA_PRODUCER_BATCH_SIZE", 100),
+				BatchBytes:            getEnvAsInt("KAFKA_PRODUCER_BATCH_BYTES", 1048576),
+				Linger:                getEnvAsDuration("KAFKA_PRODUCER_LINGER", "10ms"),
+				Compression:           getEnv("KAFKA_PRODUCER_COMPRESSION", "none"),
+				MaxInFlight:           getEnvAsInt("KAFKA_PRODUCER_MAX_IN_FLIGHT", 5),
+				Idempotent:            getEnvAsBool("KAFKA_PRODUCER_IDEMPOTENT", true),
+				Transactional:         getEnvAsBool("KAFKA_PRODUCER_TRANSACTIONAL", false),
+				TransactionalIDPrefix: getEnv("KAFKA_PRODUCER_TRANSACTIONAL_ID_PREFIX", "producer"),
+				TransactionalID:       getEnv("KAFKA_PRODUCER_TRANSACTIONAL_ID", ""),
+				InstanceOrdinal:       getEnv("KAFKA_PRODUCER_INSTANCE_ORDINAL", ""),
+			},
 		},
 		Redis: config.RedisConfig{
+			Mode:     getEnv("REDIS_MODE", "standalone"),
 			Addr:     getEnv("REDIS_ADDR", "redis:6379"),
 			Password: getEnv("REDIS_PASSWORD", ""),
 			DB:       getEnvAsInt("REDIS_DB", 0),
 			Timeout:  getEnvAsDuration("REDIS_TIMEOUT", "5s"),
+
+			ClusterAddrs:     getEnvAsSlice("REDIS_CLUSTER_ADDRS", ""),
+			MasterName:       getEnv("REDIS_MASTER_NAME", ""),
+			SentinelAddrs:    getEnvAsSlice("REDIS_SENTINEL_ADDRS", ""),
+			SentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+			ReadFrom:         getEnv("REDIS_READ_FROM", "primary"),
+
+			PoolStatsInterval: getEnvAsDuration("REDIS_POOL_STATS_INTERVAL", "15s"),
+
+			Codec:                getEnv("REDIS_CODEC", "json"),
+			Compression:          getEnv("REDIS_COMPRESSION", "none"),
+			CompressionThreshold: getEnvAsInt("REDIS_COMPRESSION_THRESHOLD", 1024),
 		},
 		Postgres: config.PostgresConfig{
 			Host:     getEnv("POSTGRES_HOST", "postgres"),
@@ -55,6 +115,27 @@ func main() {
 			PrometheusPort: getEnvAsInt("PROMETHEUS_PORT", 9090),
 			JaegerEndpoint: getEnv("JAEGER_ENDPOINT", "http://localhost:14268/api/traces"),
 		},
+		ClaimCheck: config.ClaimCheckConfig{
+			Enabled:   getEnvAsBool("CLAIM_CHECK_ENABLED", true),
+			Threshold: getEnvAsInt("CLAIM_CHECK_THRESHOLD", 524288),
+			Store:     getEnv("CLAIM_CHECK_STORE", "redis"),
+			Dir:       getEnv("CLAIM_CHECK_DIR", "/var/lib/pet-proj/payloads"),
+			TTL:       getEnvAsDuration("CLAIM_CHECK_TTL", "168h"),
+		},
+		Idempotency: config.IdempotencyConfig{
+			Window: getEnvAsDuration("IDEMPOTENCY_WINDOW", "24h"),
+			Lease:  getEnvAsDuration("IDEMPOTENCY_LEASE", "30s"),
+		},
+		Transport: config.TransportConfig{
+			Type: getEnv("EVENT_TRANSPORT", "kafka"),
+			Streams: config.StreamsConfig{
+				MaxLen: int64(getEnvAsInt("REDIS_STREAM_MAX_LEN", 1000000)),
+			},
+		},
+		RateLimit: config.RateLimitConfig{
+			Enabled: getEnvAsBool("RATE_LIMIT_ENABLED", false),
+			Rules:   getEnvAsRateLimitRules("RATE_LIMIT_RULES"),
+		},
 	}
 
 	// Настраиваем логгер
@@ -66,15 +147,11 @@ func main() {
 		"service":    "producer",
 	}).Info("Starting Producer Service")
 
-	// Инициализируем Kafka producer
-	kafkaProducer, err := kafka.NewProducer(cfg.Kafka.Brokers, cfg.Kafka.Topic, logrus.StandardLogger())
+	// Инициализируем Redis клиент
+	redisClient, err := config.NewRedisClient(cfg.Redis, logrus.StandardLogger())
 	if err != nil {
-		logrus.Fatalf("Failed to create Kafka producer: %v", err)
+		logrus.Fatalf("Failed to create Redis client: %v", err)
 	}
-	defer kafkaProducer.Close()
-
-	// Инициализируем Redis клиент
-	redisClient := redis.NewClient(cfg.Redis.Addr, cfg.Redis.Password, cfg.Redis.DB, logrus.StandardLogger())
 	defer redisClient.Close()
 
 	// Проверяем подключение к Redis
@@ -83,11 +160,67 @@ func main() {
 		logrus.Fatalf("Failed to connect to Redis: %v", err)
 	}
 
+	// События передаются через Kafka или потоки Redis с одинаковыми кодеками
+	codecs, err := kafka.NewTopicCodecs(cfg.Kafka.Codec, cfg.Kafka.TopicCodecs)
+	if err != nil {
+		logrus.Fatalf("Failed to configure Kafka codecs: %v", err)
+	}
+
+	var eventProducer kafka.ProducerInterface
+	switch cfg.Transport.Type {
+	case config.TransportKafka:
+		eventProducer = newKafkaProducer(cfg.Kafka, codecs)
+	case config.TransportRedisStreams:
+		eventProducer = redisstream.NewProducer(redisClient, config.RedisStreamConfig(cfg.Transport.Streams), cfg.Kafka.Topic, codecs, logrus.StandardLogger())
+		logrus.WithField("max_len", cfg.Transport.Streams.MaxLen).Info("Redis stream producer created")
+	default:
+		logrus.Fatalf("Unknown event transport: %s", cfg.Transport.Type)
+	}
+	defer eventProducer.Close()
+
 	// Создаем сервисы
-	eventService := services.NewEventService(kafkaProducer, redisClient, logrus.StandardLogger())
+	eventService := services.NewEventService(eventProducer, redisClient, logrus.StandardLogger())
+	eventService.SetMaxBatchSize(cfg.Service.MaxBatchSize)
+
+	// Повторы запросов с тем же Idempotency-Key получают сохраненный ответ
+	eventService.SetIdempotency(redis.NewIdempotencyStore(redisClient, cfg.Idempotency.Window, cfg.Idempotency.Lease))
+
+	// Квоты считаются в Redis и общие для всех реплик producer
+	if cfg.RateLimit.Enabled {
+		if err := eventService.SetRateLimits(redis.NewRateLimiter(redisClient), rateLimitRules(cfg.RateLimit)); err != nil {
+			logrus.Fatalf("Failed to configure rate limits: %v", err)
+		}
+	}
+
+	// Крупные payload выносим из сообщений Kafka во внешнее хранилище
+	if cfg.ClaimCheck.Enabled {
+		payloadStore, err := config.NewPayloadStore(cfg.ClaimCheck, redisClient)
+		if err != nil {
+			logrus.Fatalf("Failed to create payload store: %v", err)
+		}
+		eventService.SetClaimCheck(payloadStore, cfg.ClaimCheck.Threshold)
+	}
+
+	// События маршрутизируются по топикам в зависимости от типа
+	topicRouter, err := config.NewTopicRouter(cfg.Kafka)
+	if err != nil {
+		logrus.Fatalf("Failed to create Kafka topic router: %v", err)
+	}
+	eventService.SetTopicRouter(topicRouter)
+	logrus.WithField("topics", topicRouter.Topics()).Info("Kafka topic routing configured")
+
+	// Создаем недостающие топики маршрутов до начала приема событий; потоки Redis
+	// создаются при первой записи
+	if cfg.Transport.Type == config.TransportKafka {
+		if err := config.ProvisionTopics(context.Background(), cfg.Kafka, topicRouter.Topics(), logrus.StandardLogger()); err != nil {
+			logrus.Fatalf("Failed to provision Kafka topics: %v", err)
+		}
+	}
 
 	// Настраиваем gRPC сервер
 	grpcConfig := grpc.DefaultServerConfig(cfg.Service.GRPCPort, logrus.StandardLogger())
+	grpcConfig.MaxRecvMsgSize = cfg.Service.GRPCMaxMessageSize
+	grpcConfig.MaxSendMsgSize = cfg.Service.GRPCMaxMessageSize
 	grpcServer := grpc.NewServer(grpcConfig)
 
 	// Регистрируем gRPC handlers
@@ -153,3 +286,116 @@ func getEnvAsDuration(key, defaultValue string) time.Duration {
 	return duration
 }
 
+// получает список значений через запятую из переменной окружения
+func getEnvAsSlice(key, defaultValue string) []string {
+	var result []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// получает переменную окружения как bool или возвращает значение по умолчанию
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// получает маршруты событий вида "pattern=topic,pattern=topic" из переменной окружения
+func getEnvAsRoutes(key string) []config.TopicRoute {
+	routes, err := config.ParseTopicRoutes(os.Getenv(key))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return routes
+}
+
+// получает пары "ключ=значение" через запятую из переменной окружения
+func getEnvAsMap(key string) map[string]string {
+	result := make(map[string]string)
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		name, value, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || name == "" {
+			continue
+		}
+		result[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return result
+}
+
+// создает Kafka producer в синхронном или асинхронном режиме
+func newKafkaProducer(cfg config.KafkaConfig, codecs *kafka.TopicCodecs) kafka.ProducerInterface {
+	producerConfig := kafka.DefaultProducerConfig(cfg.Brokers, cfg.Topic, logrus.StandardLogger())
+	producerConfig.BatchSize = cfg.Producer.BatchSize
+	producerConfig.BatchBytes = cfg.Producer.BatchBytes
+	producerConfig.Linger = cfg.Producer.Linger
+	producerConfig.Compression = cfg.Producer.Compression
+	producerConfig.MaxInFlight = cfg.Producer.MaxInFlight
+	producerConfig.Idempotent = cfg.Producer.Idempotent
+	producerConfig.Security = config.KafkaSecurity(cfg.Security)
+	producerConfig.Codecs = codecs
+	if cfg.Producer.Transactional {
+		transactionalID, err := kafka.InstanceTransactionalID(cfg.Producer.TransactionalID, cfg.Producer.TransactionalIDPrefix, cfg.Producer.InstanceOrdinal)
+		if err != nil {
+			logrus.Fatalf("Invalid Kafka producer transactional ID: %v", err)
+		}
+		producerConfig.TransactionalID = transactionalID
+	}
+
+	var kafkaProducer kafka.ProducerInterface
+	var err error
+	switch cfg.Producer.Mode {
+	case kafka.ProducerModeAsync:
+		kafkaProducer, err = kafka.NewAsyncProducer(producerConfig)
+	case kafka.ProducerModeSync:
+		kafkaProducer, err = kafka.NewProducer(producerConfig)
+	default:
+		logrus.Fatalf("Unknown Kafka producer mode: %s", cfg.Producer.Mode)
+	}
+	if err != nil {
+		logrus.Fatalf("Failed to create Kafka producer: %v", err)
+	}
+	logrus.WithFields(logrus.Fields{
+		"mode":             cfg.Producer.Mode,
+		"idempotent":       producerConfig.Idempotent,
+		"transactional_id": producerConfig.TransactionalID,
+	}).Info("Kafka producer created")
+	return kafkaProducer
+}
+
+// получает спецификации топиков из переменной окружения
+func getEnvAsTopicSpecs(key string) []config.TopicSpec {
+	specs, err := config.ParseTopicSpecs(os.Getenv(key))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return specs
+}
+
+// получает квоты отправки событий из переменной окружения
+func getEnvAsRateLimitRules(key string) []config.RateLimitRule {
+	rules, err := config.ParseRateLimitRules(os.Getenv(key))
+	if err != nil {
+		logrus.Fatalf("Invalid %s: %v", key, err)
+	}
+	return rules
+}
+
+func rateLimitRules(cfg config.RateLimitConfig) []services.RateLimitRule {
+	rules := make([]services.RateLimitRule, 0, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		rules = append(rules, services.RateLimitRule{
+			KeyBy:     rule.KeyBy,
+			EventType: rule.EventType,
+			Limit:     rule.Limit,
+			Window:    rule.Window,
+		})
+	}
+	return rules
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"pet-proj/internal/config"
+	"pet-proj/internal/models"
+	"pet-proj/internal/services"
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/postgres"
+)
+
+var (
+	version   = "dev"
+	buildTime = "unknown"
+)
+
+func main() {
+	// Подключения настраиваются так же, как у consumer; диапазон - флагами
+	cfg := &config.Config{
+		Kafka: config.KafkaConfig{
+			Brokers: []string{getEnv("KAFKA_BROKERS", "kafka:29092")},
+			Topic:   getEnv("KAFKA_TOPIC", "user-events"),
+			Security: config.SecurityConfig{
+				TLS: config.TLSConfig{
+					Enabled:            getEnvAsBool("KAFKA_TLS_ENABLED", false),
+					CAFile:             getEnv("KAFKA_TLS_CA_FILE", ""),
+					CertFile:           getEnv("KAFKA_TLS_CERT_FILE", ""),
+					KeyFile:            getEnv("KAFKA_TLS_KEY_FILE", ""),
+					ServerName:         getEnv("KAFKA_TLS_SERVER_NAME", ""),
+					InsecureSkipVerify: getEnvAsBool("KAFKA_TLS_INSECURE_SKIP_VERIFY", false),
+				},
+				SASL: config.SASLConfig{
+					Mechanism: getEnv("KAFKA_SASL_MECHANISM", ""),
+					Username:  getEnv("KAFKA_SASL_USERNAME", ""),
+					Password:  getEnv("KAFKA_SASL_PASSWORD", ""),
+				},
+			},
+		},
+		Redis: config.RedisConfig{
+			Mode:     getEnv("REDIS_MODE", "standalone"),
+			Addr:     getEnv("REDIS_ADDR", "redis:6379"),
+			Password: getEnv("REDIS_PASSWORD", ""),
+			DB:       getEnvAsInt("REDIS_DB", 0),
+			Timeout:  getEnvAsDuration("REDIS_TIMEOUT", "5s"),
+
+			ClusterAddrs:     getEnvAsSlice("REDIS_CLUSTER_ADDRS", ""),
+			MasterName:       getEnv("REDIS_MASTER_NAME", ""),
+			SentinelAddrs:    getEnvAsSlice("REDIS_SENTINEL_ADDRS", ""),
+			SentinelPassword: getEnv("REDIS_SENTINEL_PASSWORD", ""),
+			ReadFrom:         getEnv("REDIS_READ_FROM", "primary"),
+
+			PoolStatsInterval: getEnvAsDuration("REDIS_POOL_STATS_INTERVAL", "15s"),
+
+			Codec:                getEnv("REDIS_CODEC", "json"),
+			Compression:          getEnv("REDIS_COMPRESSION", "none"),
+			CompressionThreshold: getEnvAsInt("REDIS_COMPRESSION_THRESHOLD", 1024),
+		},
+		Postgres: config.PostgresConfig{
+			Host:     getEnv("POSTGRES_HOST", "postgres"),
+			Port:     getEnvAsInt("POSTGRES_PORT", 5432),
+			Database: getEnv("POSTGRES_DB", "microservices"),
+			Username: getEnv("POSTGRES_USER", "postgres"),
+			Password: getEnv("POSTGRES_PASSWORD", "password"),
+			SSLMode:  getEnv("POSTGRES_SSL_MODE", "disable"),
+		},
+		ClaimCheck: config.ClaimCheckConfig{
+			Enabled:   getEnvAsBool("CLAIM_CHECK_ENABLED", true),
+			Threshold: getEnvAsInt("CLAIM_CHECK_THRESHOLD", 524288),
+			Store:     getEnv("CLAIM_CHECK_STORE", "redis"),
+			Dir:       getEnv("CLAIM_CHECK_DIR", "/var/lib/pet-proj/payloads"),
+			TTL:       getEnvAsDuration("CLAIM_CHECK_TTL", "168h"),
+		},
+	}
+
+	var (
+		topic       = flag.String("topic", cfg.Kafka.Topic, "topic to replay")
+		groupID     = flag.String("group", fmt.Sprintf("replay-%d", time.Now().Unix()), "consumer group used for the replay")
+		fromOffset  = flag.Int64("from-offset", -1, "first offset to replay in every partition")
+		toOffset    = flag.Int64("to-offset", -1, "offset to stop at in every partition (exclusive)")
+		fromTime    = flag.String("from-time", "", "replay messages written at or after this time (RFC3339)")
+		toTime      = flag.String("to-time", "", "stop at messages written at or after this time (RFC3339)")
+		rate        = flag.Float64("rate", 0, "maximum messages per second, 0 for unlimited")
+		dryRun      = flag.Bool("dry-run", false, "count matching messages without processing them")
+		eventTypes  = flag.String("event-types", "", "comma-separated event types to replay, empty for all")
+		idleTimeout = flag.Duration("idle-timeout", 10*time.Second, "treat a partition as finished after this long without messages")
+	)
+	flag.Parse()
+
+	logrus.SetLevel(logrus.InfoLevel)
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+	logrus.WithFields(logrus.Fields{
+		"version":    version,
+		"build_time": buildTime,
+		"service":    "replay",
+	}).Info("Starting Replay")
+
+	replayConfig := kafka.ReplayConfig{
+		Topic:       *topic,
+		GroupID:     *groupID,
+		StartOffset: *fromOffset,
+		EndOffset:   *toOffset,
+		StartTime:   parseTimeFlag("from-time", *fromTime),
+		EndTime:     parseTimeFlag("to-time", *toTime),
+		Rate:        *rate,
+		DryRun:      *dryRun,
+		Filter:      eventTypeFilter(*eventTypes),
+		IdleTimeout: *idleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// В режиме dry-run обработчик не вызывается, хранилища не нужны
+	var handler kafka.MessageHandler
+	if !replayConfig.DryRun {
+		postgresClient, err := postgres.NewClient(
+			cfg.Postgres.Host,
+			cfg.Postgres.Port,
+			cfg.Postgres.Database,
+			cfg.Postgres.Username,
+			cfg.Postgres.Password,
+			logrus.StandardLogger(),
+		)
+		if err != nil {
+			logrus.Fatalf("Failed to create PostgreSQL client: %v", err)
+		}
+		defer postgresClient.Close()
+
+		redisClient, err := config.NewRedisClient(cfg.Redis, logrus.StandardLogger())
+		if err != nil {
+			logrus.Fatalf("Failed to create Redis client: %v", err)
+		}
+		defer redisClient.Close()
+
+		if err := redisClient.Ping(ctx); err != nil {
+			logrus.Fatalf("Failed to connect to Redis: %v", err)
+		}
+
+		// Тот же обработчик, что и у consumer
+		consumerService := services.NewConsumerService(redisClient, postgresClient, logrus.StandardLogger())
+		payloadStore, err := config.NewPayloadStore(cfg.ClaimCheck, redisClient)
+		if err != nil {
+			logrus.Fatalf("Failed to create payload store: %v", err)
+		}
+		consumerService.SetClaimCheck(payloadStore)
+		// Дедупликацию не подключаем: повторная обработка - цель replay
+		handler = consumerService
+	}
+
+	replayer, err := kafka.NewReplayer(cfg.Kafka.Brokers, config.KafkaSecurity(cfg.Kafka.Security), replayConfig, logrus.StandardLogger())
+	if err != nil {
+		logrus.Fatalf("Failed to create Kafka replayer: %v", err)
+	}
+	defer replayer.Close()
+
+	logrus.WithFields(logrus.Fields{
+		"topic":    replayConfig.Topic,
+		"group_id": replayConfig.GroupID,
+		"dry_run":  replayConfig.DryRun,
+		"rate":     replayConfig.Rate,
+	}).Info("Replaying messages")
+
+	report, err := replayer.Run(ctx, handler)
+	if report != nil {
+		printReport(report)
+	}
+	if err != nil {
+		logrus.WithError(err).Error("Replay stopped")
+		os.Exit(1)
+	}
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// печатает итоговый отчет в stdout
+func printReport(report *kafka.ReplayReport) {
+	logrus.WithFields(logrus.Fields{
+		"read":      report.Read,
+		"processed": report.Processed,
+		"skipped":   report.Skipped,
+		"failed":    report.Failed,
+		"completed": report.Completed,
+		"duration":  report.Duration.String(),
+	}).Info("Replay finished")
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		logrus.WithError(err).Error("Failed to print replay report")
+	}
+}
+
+// создает фильтр сообщений по типу события; nil, если типы не заданы
+func eventTypeFilter(value string) func(message *sarama.ConsumerMessage) bool {
+	var types []string
+	for _, eventType := range strings.Split(value, ",") {
+		if eventType = strings.TrimSpace(eventType); eventType != "" {
+			types = append(types, eventType)
+		}
+	}
+	if len(types) == 0 {
+		return nil
+	}
+
+	return func(message *sarama.ConsumerMessage) bool {
+		var event models.Event
+		if err := kafka.DecodeMessage(message, &event); err != nil {
+			// Невалидное сообщение отдаем обработчику, чтобы оно попало в отчет
+			return true
+		}
+		return slices.Contains(types, event.Type)
+	}
+}
+
+// разбирает время из флага; пустое значение - граница не задана
+func parseTimeFlag(name, value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logrus.Fatalf("Invalid -%s: %v", name, err)
+	}
+	return parsed
+}
+
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+func getEnvAsInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intValue, err := strconv.Atoi(value); err == nil {
+			return intValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsDuration(key, defaultValue string) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	duration, _ := time.ParseDuration(defaultValue)
+	return duration
+}
+
+// получает список значений через запятую из переменной окружения
+func getEnvAsSlice(key, defaultValue string) []string {
+	var result []string
+	for _, value := range strings.Split(getEnv(key, defaultValue), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// получает переменную окружения как bool или возвращает значение по умолчанию
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
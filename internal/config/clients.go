@@ -0,0 +1,130 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"pet-proj/pkg/claimcheck"
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/redis"
+	"pet-proj/pkg/redisstream"
+)
+
+// конвертирует настройки TLS и SASL из конфигурации для клиентов Kafka
+func KafkaSecurity(cfg SecurityConfig) *kafka.SecurityConfig {
+	return &kafka.SecurityConfig{
+		TLS: kafka.TLSConfig{
+			Enabled:            cfg.TLS.Enabled,
+			CAFile:             cfg.TLS.CAFile,
+			CertFile:           cfg.TLS.CertFile,
+			KeyFile:            cfg.TLS.KeyFile,
+			ServerName:         cfg.TLS.ServerName,
+			InsecureSkipVerify: cfg.TLS.InsecureSkipVerify,
+		},
+		SASL: kafka.SASLConfig{
+			Mechanism: cfg.SASL.Mechanism,
+			Username:  cfg.SASL.Username,
+			Password:  cfg.SASL.Password,
+		},
+	}
+}
+
+// создает маршрутизатор событий по топикам из конфигурации
+func NewTopicRouter(cfg KafkaConfig) (*kafka.TopicRouter, error) {
+	routes := make([]kafka.TopicRoute, 0, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routes = append(routes, kafka.TopicRoute{Pattern: route.Pattern, Topic: route.Topic})
+	}
+	return kafka.NewTopicRouter(cfg.Topic, routes)
+}
+
+// создает клиент Redis в режиме из конфигурации
+func NewRedisClient(cfg RedisConfig, logger *logrus.Logger) (*redis.Client, error) {
+	return redis.NewClientFromConfig(&redis.Config{
+		Mode:             cfg.Mode,
+		Addr:             cfg.Addr,
+		ClusterAddrs:     cfg.ClusterAddrs,
+		MasterName:       cfg.MasterName,
+		SentinelAddrs:    cfg.SentinelAddrs,
+		SentinelPassword: cfg.SentinelPassword,
+		Password:         cfg.Password,
+		DB:               cfg.DB,
+		ReadFrom:         cfg.ReadFrom,
+		Timeout:          cfg.Timeout,
+
+		PoolStatsInterval: cfg.PoolStatsInterval,
+
+		Codec:                cfg.Codec,
+		Compression:          cfg.Compression,
+		CompressionThreshold: cfg.CompressionThreshold,
+	}, logger)
+}
+
+// сверяет топики Kafka с конфигурацией, если сверка включена; топики names без
+// явной спецификации создаются с настройками по умолчанию
+func ProvisionTopics(ctx context.Context, cfg KafkaConfig, names []string, logger *logrus.Logger) error {
+	if !cfg.Provisioning.Enabled {
+		return nil
+	}
+
+	declared := make([]kafka.TopicSpec, 0, len(cfg.Provisioning.Topics))
+	for _, spec := range cfg.Provisioning.Topics {
+		declared = append(declared, kafkaTopicSpec(spec))
+	}
+	specs := kafka.TopicSpecsFor(names, kafkaTopicSpec(cfg.Provisioning.Defaults), declared)
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	report, err := kafka.ProvisionTopics(ctx, cfg.Brokers, KafkaSecurity(cfg.Security), specs, cfg.Provisioning.DryRun, logger)
+	if err != nil {
+		return err
+	}
+	logger.WithFields(logrus.Fields{
+		"dry_run": report.DryRun,
+		"created": report.Created,
+		"drift":   len(report.Drift),
+	}).Info("Kafka topics reconciled")
+	return nil
+}
+
+func kafkaTopicSpec(spec TopicSpec) kafka.TopicSpec {
+	return kafka.TopicSpec{
+		Name:              spec.Name,
+		Partitions:        int32(spec.Partitions),
+		ReplicationFactor: int16(spec.ReplicationFactor),
+		Retention:         spec.Retention,
+		CleanupPolicy:     spec.CleanupPolicy,
+	}
+}
+
+// конвертирует настройки потоков Redis из конфигурации
+func RedisStreamConfig(cfg StreamsConfig) *redisstream.Config {
+	return &redisstream.Config{
+		MaxLen:        cfg.MaxLen,
+		BatchSize:     int64(cfg.BatchSize),
+		Block:         cfg.Block,
+		ClaimIdle:     cfg.ClaimIdle,
+		ClaimInterval: cfg.ClaimInterval,
+		MaxDeliveries: cfg.MaxDeliveries,
+	}
+}
+
+// создает хранилище вынесенных payload событий
+func NewPayloadStore(cfg ClaimCheckConfig, redisClient redis.ClientInterface) (claimcheck.Store, error) {
+	switch cfg.Store {
+	case "redis":
+		return claimcheck.NewRedisStore(redisClient, cfg.TTL), nil
+	case "file":
+		store, err := claimcheck.NewFileStore(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown claim-check store: %s", cfg.Store)
+	}
+}
@@ -1,37 +1,143 @@
 package config
 
 import (
+	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Service    ServiceConfig    `mapstructure:"service"`
-	Kafka      KafkaConfig      `mapstructure:"kafka"`
-	Redis      RedisConfig      `mapstructure:"redis"`
-	Postgres   PostgresConfig   `mapstructure:"postgres"`
-	Monitoring MonitoringConfig `mapstructure:"monitoring"`
+	Service     ServiceConfig     `mapstructure:"service"`
+	Kafka       KafkaConfig       `mapstructure:"kafka"`
+	Redis       RedisConfig       `mapstructure:"redis"`
+	Postgres    PostgresConfig    `mapstructure:"postgres"`
+	Monitoring  MonitoringConfig  `mapstructure:"monitoring"`
+	ClaimCheck  ClaimCheckConfig  `mapstructure:"claim_check"`
+	Dedup       DedupConfig       `mapstructure:"dedup"`
+	Idempotency IdempotencyConfig `mapstructure:"idempotency"`
+	RateLimit   RateLimitConfig   `mapstructure:"rate_limit"`
+	Transport   TransportConfig   `mapstructure:"transport"`
 }
 
 type ServiceConfig struct {
 	Name     string `mapstructure:"name"`
 	Port     int    `mapstructure:"port"`
 	GRPCPort int    `mapstructure:"grpc_port"`
+	// Максимальный размер gRPC сообщения в байтах
+	GRPCMaxMessageSize int `mapstructure:"grpc_max_message_size"`
+	// Максимальное число ID в пакетных запросах событий
+	MaxBatchSize int `mapstructure:"max_batch_size"`
 }
 
 type KafkaConfig struct {
-	Brokers []string `mapstructure:"brokers"`
-	Topic   string   `mapstructure:"topic"`
-	GroupID string   `mapstructure:"group_id"`
+	Brokers          []string           `mapstructure:"brokers"`
+	Topic            string             `mapstructure:"topic"`
+	GroupID          string             `mapstructure:"group_id"`
+	DeadLetterTopic  string             `mapstructure:"dead_letter_topic"`
+	RetryDelays      []time.Duration    `mapstructure:"retry_delays"`
+	RetryMaxAttempts int                `mapstructure:"retry_max_attempts"`
+	Producer         ProducerConfig     `mapstructure:"producer"`
+	Delivery         DeliveryConfig     `mapstructure:"delivery"`
+	Workers          int                `mapstructure:"workers"`
+	QueueDepth       int                `mapstructure:"queue_depth"`
+	MessageTimeout   time.Duration      `mapstructure:"message_timeout"`
+	Routes           []TopicRoute       `mapstructure:"routes"`
+	Topics           []string           `mapstructure:"topics"`
+	Codec            string             `mapstructure:"codec"`
+	TopicCodecs      map[string]string  `mapstructure:"topic_codecs"`
+	Security         SecurityConfig     `mapstructure:"security"`
+	Provisioning     ProvisioningConfig `mapstructure:"provisioning"`
+}
+
+// сверка топиков при старте сервиса
+type ProvisioningConfig struct {
+	Enabled  bool        `mapstructure:"enabled"`
+	DryRun   bool        `mapstructure:"dry_run"`
+	Defaults TopicSpec   `mapstructure:"defaults"`
+	Topics   []TopicSpec `mapstructure:"topics"`
+}
+
+// желаемые параметры топика; для Defaults имя не задается
+type TopicSpec struct {
+	Name              string        `mapstructure:"name"`
+	Partitions        int           `mapstructure:"partitions"`
+	ReplicationFactor int           `mapstructure:"replication_factor"`
+	Retention         time.Duration `mapstructure:"retention"`
+	CleanupPolicy     string        `mapstructure:"cleanup_policy"`
+}
+
+// TLS и SASL подключения к Kafka
+type SecurityConfig struct {
+	TLS  TLSConfig  `mapstructure:"tls"`
+	SASL SASLConfig `mapstructure:"sasl"`
+}
+
+type TLSConfig struct {
+	Enabled            bool   `mapstructure:"enabled"`
+	CAFile             string `mapstructure:"ca_file"`
+	CertFile           string `mapstructure:"cert_file"`
+	KeyFile            string `mapstructure:"key_file"`
+	ServerName         string `mapstructure:"server_name"`
+	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+}
+
+// Mechanism: пусто (без SASL), PLAIN, SCRAM-SHA-256 или SCRAM-SHA-512
+type SASLConfig struct {
+	Mechanism string `mapstructure:"mechanism"`
+	Username  string `mapstructure:"username"`
+	Password  string `mapstructure:"password"`
+}
+
+// маршрут событий: тип события или glob шаблон и топик назначения;
+// события без маршрута уходят в Topic
+type TopicRoute struct {
+	Pattern string `mapstructure:"pattern"`
+	Topic   string `mapstructure:"topic"`
+}
+
+// режим доставки для consumer group из GroupID
+type DeliveryConfig struct {
+	Mode       string        `mapstructure:"mode"`
+	Backoff    time.Duration `mapstructure:"backoff"`
+	MaxBackoff time.Duration `mapstructure:"max_backoff"`
+}
+
+type ProducerConfig struct {
+	Mode                  string        `mapstructure:"mode"`
+	BatchSize             int           `mapstructure:"batch_size"`
+	BatchBytes            int           `mapstructure:"batch_bytes"`
+	Linger                time.Duration `mapstructure:"linger"`
+	Compression           string        `mapstructure:"compression"`
+	MaxInFlight           int           `mapstructure:"max_in_flight"`
+	Idempotent            bool          `mapstructure:"idempotent"`
+	Transactional         bool          `mapstructure:"transactional"`
+	TransactionalIDPrefix string        `mapstructure:"transactional_id_prefix"`
+	TransactionalID       string        `mapstructure:"transactional_id"` // Явный ID; иначе префикс и InstanceOrdinal
+	InstanceOrdinal       string        `mapstructure:"instance_ordinal"` // Номер pod в StatefulSet
 }
 
 type RedisConfig struct {
+	Mode     string        `mapstructure:"mode"` // standalone, sentinel или cluster
 	Addr     string        `mapstructure:"addr"`
 	Password string        `mapstructure:"password"`
 	DB       int           `mapstructure:"db"`
 	Timeout  time.Duration `mapstructure:"timeout"`
+
+	ClusterAddrs     []string `mapstructure:"cluster_addrs"`
+	MasterName       string   `mapstructure:"master_name"`
+	SentinelAddrs    []string `mapstructure:"sentinel_addrs"`
+	SentinelPassword string   `mapstructure:"sentinel_password"`
+	ReadFrom         string   `mapstructure:"read_from"` // primary, replica или nearest
+
+	PoolStatsInterval time.Duration `mapstructure:"pool_stats_interval"` // Период экспорта статистики пула
+
+	Codec                string `mapstructure:"codec"`                 // json, msgpack или protobuf
+	Compression          string `mapstructure:"compression"`           // none, zstd или snappy
+	CompressionThreshold int    `mapstructure:"compression_threshold"` // Размер значения в байтах, начиная с которого оно сжимается
 }
 
 type PostgresConfig struct {
@@ -43,9 +149,69 @@ type PostgresConfig struct {
 	SSLMode  string `mapstructure:"ssl_mode"`
 }
 
+// вынос крупных payload событий из сообщений Kafka во внешнее хранилище
+type ClaimCheckConfig struct {
+	Enabled   bool          `mapstructure:"enabled"`
+	Threshold int           `mapstructure:"threshold"` // Размер Data в байтах, начиная с которого payload выносится
+	Store     string        `mapstructure:"store"`     // redis или file
+	Dir       string        `mapstructure:"dir"`       // Каталог для file хранилища
+	TTL       time.Duration `mapstructure:"ttl"`       // Время хранения в Redis
+}
+
+// защита consumer от повторной обработки событий
+type DedupConfig struct {
+	Enabled bool          `mapstructure:"enabled"`
+	Window  time.Duration `mapstructure:"window"` // Сколько помнить обработанное событие
+	Lease   time.Duration `mapstructure:"lease"`  // Сколько событие занято обработчиком; больше message_timeout
+}
+
+// хранение ответов producer по ключу идемпотентности
+type IdempotencyConfig struct {
+	Window time.Duration `mapstructure:"window"` // Сколько хранить ответ для повторов
+	Lease  time.Duration `mapstructure:"lease"`  // Сколько ключ занят выполняющимся запросом
+}
+
+// ограничение частоты отправки событий в producer
+type RateLimitConfig struct {
+	Enabled bool            `mapstructure:"enabled"`
+	Rules   []RateLimitRule `mapstructure:"rules"`
+}
+
+// квота скользящего окна; пустой EventType - для событий любого типа
+type RateLimitRule struct {
+	KeyBy     string        `mapstructure:"key_by"` // user, source или client
+	EventType string        `mapstructure:"event_type"`
+	Limit     int           `mapstructure:"limit"`
+	Window    time.Duration `mapstructure:"window"`
+}
+
+// транспорты событий между producer и consumer
+const (
+	TransportKafka        = "kafka"
+	TransportRedisStreams = "redis-streams"
+)
+
+// выбор транспорта событий; топики Kafka и маршруты действуют для обоих
+type TransportConfig struct {
+	Type    string        `mapstructure:"type"` // kafka или redis-streams
+	Streams StreamsConfig `mapstructure:"streams"`
+}
+
+// настройки транспорта через Redis Streams
+type StreamsConfig struct {
+	MaxLen        int64         `mapstructure:"max_len"`        // Приблизительная длина потока
+	BatchSize     int           `mapstructure:"batch_size"`     // Сколько записей читать за раз
+	Block         time.Duration `mapstructure:"block"`          // Сколько ждать новых записей
+	ClaimIdle     time.Duration `mapstructure:"claim_idle"`     // Когда забирать неподтвержденную запись
+	ClaimInterval time.Duration `mapstructure:"claim_interval"` // Как часто искать такие записи
+	MaxDeliveries int64         `mapstructure:"max_deliveries"` // После скольких выдач запись уходит в dead-letter поток
+}
+
 type MonitoringConfig struct {
-	PrometheusPort int    `mapstructure:"prometheus_port"`
-	JaegerEndpoint string `mapstructure:"jaeger_endpoint"`
+	PrometheusPort int      `mapstructure:"prometheus_port"`
+	JaegerEndpoint string   `mapstructure:"jaeger_endpoint"`
+	LagGroups      []string `mapstructure:"lag_groups"`
+	LagThreshold   int64    `mapstructure:"lag_threshold"`
 }
 
 func Load() (*Config, error) {
@@ -59,14 +225,71 @@ func Load() (*Config, error) {
 	viper.SetDefault("kafka.brokers", []string{"localhost:9092"})
 	viper.SetDefault("kafka.topic", "user-events")
 	viper.SetDefault("kafka.group_id", "consumer-group")
+	viper.SetDefault("kafka.dead_letter_topic", "user-events.dlq")
+	viper.SetDefault("kafka.retry_delays", []string{"5s", "1m", "10m"})
+	viper.SetDefault("kafka.retry_max_attempts", 3)
+	viper.SetDefault("kafka.producer.mode", "sync")
+	viper.SetDefault("kafka.producer.batch_size", 100)
+	viper.SetDefault("kafka.producer.batch_bytes", 1048576)
+	viper.SetDefault("kafka.producer.linger", "10ms")
+	viper.SetDefault("kafka.producer.compression", "none")
+	viper.SetDefault("kafka.producer.max_in_flight", 5)
+	viper.SetDefault("kafka.producer.idempotent", true)
+	viper.SetDefault("kafka.producer.transactional", false)
+	viper.SetDefault("kafka.producer.transactional_id_prefix", "producer")
+	viper.SetDefault("kafka.producer.transactional_id", "")
+	viper.SetDefault("kafka.producer.instance_ordinal", "")
+	viper.SetDefault("kafka.delivery.mode", "forward")
+	viper.SetDefault("kafka.delivery.backoff", "500ms")
+	viper.SetDefault("kafka.delivery.max_backoff", "30s")
+	viper.SetDefault("kafka.workers", 1)
+	viper.SetDefault("kafka.queue_depth", 100)
+	viper.SetDefault("kafka.message_timeout", "30s")
+	viper.SetDefault("kafka.codec", "json")
+	viper.SetDefault("kafka.security.tls.enabled", false)
+	viper.SetDefault("kafka.security.sasl.mechanism", "")
+	viper.SetDefault("kafka.provisioning.enabled", true)
+	viper.SetDefault("kafka.provisioning.dry_run", false)
+	viper.SetDefault("kafka.provisioning.defaults.partitions", 3)
+	viper.SetDefault("kafka.provisioning.defaults.replication_factor", 1)
+	viper.SetDefault("kafka.provisioning.defaults.retention", "168h")
+	viper.SetDefault("kafka.provisioning.defaults.cleanup_policy", "delete")
+	viper.SetDefault("redis.mode", "standalone")
 	viper.SetDefault("redis.addr", "localhost:6379")
 	viper.SetDefault("redis.db", 0)
 	viper.SetDefault("redis.timeout", "5s")
+	viper.SetDefault("redis.read_from", "primary")
+	viper.SetDefault("redis.pool_stats_interval", "15s")
+	viper.SetDefault("redis.codec", "json")
+	viper.SetDefault("redis.compression", "none")
+	viper.SetDefault("redis.compression_threshold", 1024)
 	viper.SetDefault("postgres.host", "localhost")
 	viper.SetDefault("postgres.port", 5432)
 	viper.SetDefault("postgres.ssl_mode", "disable")
 	viper.SetDefault("monitoring.prometheus_port", 9090)
 	viper.SetDefault("monitoring.jaeger_endpoint", "http://localhost:14268/api/traces")
+	viper.SetDefault("monitoring.lag_groups", []string{"consumer-group"})
+	viper.SetDefault("monitoring.lag_threshold", 1000)
+	viper.SetDefault("service.grpc_max_message_size", 4194304)
+	viper.SetDefault("service.max_batch_size", 100)
+	viper.SetDefault("claim_check.enabled", true)
+	viper.SetDefault("claim_check.threshold", 524288)
+	viper.SetDefault("claim_check.store", "redis")
+	viper.SetDefault("claim_check.dir", "/var/lib/pet-proj/payloads")
+	viper.SetDefault("claim_check.ttl", "168h")
+	viper.SetDefault("dedup.enabled", true)
+	viper.SetDefault("dedup.window", "24h")
+	viper.SetDefault("dedup.lease", "5m")
+	viper.SetDefault("idempotency.window", "24h")
+	viper.SetDefault("idempotency.lease", "30s")
+	viper.SetDefault("rate_limit.enabled", false)
+	viper.SetDefault("transport.type", "kafka")
+	viper.SetDefault("transport.streams.max_len", 1000000)
+	viper.SetDefault("transport.streams.batch_size", 100)
+	viper.SetDefault("transport.streams.block", "2s")
+	viper.SetDefault("transport.streams.claim_idle", "1m")
+	viper.SetDefault("transport.streams.claim_interval", "30s")
+	viper.SetDefault("transport.streams.max_deliveries", 5)
 
 	viper.AutomaticEnv()
 
@@ -90,14 +313,71 @@ func LoadFromFile(filename string) (*Config, error) {
 	viper.SetDefault("kafka.brokers", []string{"localhost:9092"})
 	viper.SetDefault("kafka.topic", "user-events")
 	viper.SetDefault("kafka.group_id", "consumer-group")
+	viper.SetDefault("kafka.dead_letter_topic", "user-events.dlq")
+	viper.SetDefault("kafka.retry_delays", []string{"5s", "1m", "10m"})
+	viper.SetDefault("kafka.retry_max_attempts", 3)
+	viper.SetDefault("kafka.producer.mode", "sync")
+	viper.SetDefault("kafka.producer.batch_size", 100)
+	viper.SetDefault("kafka.producer.batch_bytes", 1048576)
+	viper.SetDefault("kafka.producer.linger", "10ms")
+	viper.SetDefault("kafka.producer.compression", "none")
+	viper.SetDefault("kafka.producer.max_in_flight", 5)
+	viper.SetDefault("kafka.producer.idempotent", true)
+	viper.SetDefault("kafka.producer.transactional", false)
+	viper.SetDefault("kafka.producer.transactional_id_prefix", "producer")
+	viper.SetDefault("kafka.producer.transactional_id", "")
+	viper.SetDefault("kafka.producer.instance_ordinal", "")
+	viper.SetDefault("kafka.delivery.mode", "forward")
+	viper.SetDefault("kafka.delivery.backoff", "500ms")
+	viper.SetDefault("kafka.delivery.max_backoff", "30s")
+	viper.SetDefault("kafka.workers", 1)
+	viper.SetDefault("kafka.queue_depth", 100)
+	viper.SetDefault("kafka.message_timeout", "30s")
+	viper.SetDefault("kafka.codec", "json")
+	viper.SetDefault("kafka.security.tls.enabled", false)
+	viper.SetDefault("kafka.security.sasl.mechanism", "")
+	viper.SetDefault("kafka.provisioning.enabled", true)
+	viper.SetDefault("kafka.provisioning.dry_run", false)
+	viper.SetDefault("kafka.provisioning.defaults.partitions", 3)
+	viper.SetDefault("kafka.provisioning.defaults.replication_factor", 1)
+	viper.SetDefault("kafka.provisioning.defaults.retention", "168h")
+	viper.SetDefault("kafka.provisioning.defaults.cleanup_policy", "delete")
+	viper.SetDefault("redis.mode", "standalone")
 	viper.SetDefault("redis.addr", "localhost:6379")
 	viper.SetDefault("redis.db", 0)
 	viper.SetDefault("redis.timeout", "5s")
+	viper.SetDefault("redis.read_from", "primary")
+	viper.SetDefault("redis.pool_stats_interval", "15s")
+	viper.SetDefault("redis.codec", "json")
+	viper.SetDefault("redis.compression", "none")
+	viper.SetDefault("redis.compression_threshold", 1024)
 	viper.SetDefault("postgres.host", "localhost")
 	viper.SetDefault("postgres.port", 5432)
 	viper.SetDefault("postgres.ssl_mode", "disable")
 	viper.SetDefault("monitoring.prometheus_port", 9090)
 	viper.SetDefault("monitoring.jaeger_endpoint", "http://localhost:14268/api/traces")
+	viper.SetDefault("monitoring.lag_groups", []string{"consumer-group"})
+	viper.SetDefault("monitoring.lag_threshold", 1000)
+	viper.SetDefault("service.grpc_max_message_size", 4194304)
+	viper.SetDefault("service.max_batch_size", 100)
+	viper.SetDefault("claim_check.enabled", true)
+	viper.SetDefault("claim_check.threshold", 524288)
+	viper.SetDefault("claim_check.store", "redis")
+	viper.SetDefault("claim_check.dir", "/var/lib/pet-proj/payloads")
+	viper.SetDefault("claim_check.ttl", "168h")
+	viper.SetDefault("dedup.enabled", true)
+	viper.SetDefault("dedup.window", "24h")
+	viper.SetDefault("dedup.lease", "5m")
+	viper.SetDefault("idempotency.window", "24h")
+	viper.SetDefault("idempotency.lease", "30s")
+	viper.SetDefault("rate_limit.enabled", false)
+	viper.SetDefault("transport.type", "kafka")
+	viper.SetDefault("transport.streams.max_len", 1000000)
+	viper.SetDefault("transport.streams.batch_size", 100)
+	viper.SetDefault("transport.streams.block", "2s")
+	viper.SetDefault("transport.streams.claim_idle", "1m")
+	viper.SetDefault("transport.streams.claim_interval", "30s")
+	viper.SetDefault("transport.streams.max_deliveries", 5)
 
 	viper.AutomaticEnv()
 
@@ -112,3 +392,92 @@ func LoadFromFile(filename string) (*Config, error) {
 
 	return &config, nil
 }
+
+// разбирает маршруты событий вида "pattern=topic" через запятую
+func ParseTopicRoutes(value string) ([]TopicRoute, error) {
+	var routes []TopicRoute
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		pattern, topic, ok := strings.Cut(item, "=")
+		pattern, topic = strings.TrimSpace(pattern), strings.TrimSpace(topic)
+		if !ok || pattern == "" || topic == "" {
+			return nil, fmt.Errorf("invalid topic route %q", item)
+		}
+		routes = append(routes, TopicRoute{Pattern: pattern, Topic: topic})
+	}
+	return routes, nil
+}
+
+// разбирает спецификации топиков вида "name:partitions:replication:retention:policy"
+// через запятую; retention и policy можно опустить
+func ParseTopicSpecs(value string) ([]TopicSpec, error) {
+	var specs []TopicSpec
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		parts := strings.Split(item, ":")
+		if len(parts) < 3 || len(parts) > 5 {
+			return nil, fmt.Errorf("invalid topic spec %q", item)
+		}
+
+		spec := TopicSpec{Name: parts[0]}
+		var err error
+		if spec.Partitions, err = strconv.Atoi(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid partitions in topic spec %q: %w", item, err)
+		}
+		if spec.ReplicationFactor, err = strconv.Atoi(parts[2]); err != nil {
+			return nil, fmt.Errorf("invalid replication factor in topic spec %q: %w", item, err)
+		}
+		if len(parts) > 3 && parts[3] != "" {
+			if spec.Retention, err = time.ParseDuration(parts[3]); err != nil {
+				return nil, fmt.Errorf("invalid retention in topic spec %q: %w", item, err)
+			}
+		}
+		if len(parts) > 4 {
+			spec.CleanupPolicy = parts[4]
+		}
+
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// разбирает квоты вида "key_by[:event_type]=limit/window" через запятую
+func ParseRateLimitRules(value string) ([]RateLimitRule, error) {
+	var rules []RateLimitRule
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		key, quota, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit rule %q", item)
+		}
+		limit, window, ok := strings.Cut(quota, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid rate limit quota in rule %q", item)
+		}
+
+		var rule RateLimitRule
+		rule.KeyBy, rule.EventType, _ = strings.Cut(key, ":")
+		var err error
+		if rule.Limit, err = strconv.Atoi(limit); err != nil {
+			return nil, fmt.Errorf("invalid limit in rate limit rule %q: %w", item, err)
+		}
+		if rule.Window, err = time.ParseDuration(window); err != nil {
+			return nil, fmt.Errorf("invalid window in rate limit rule %q: %w", item, err)
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
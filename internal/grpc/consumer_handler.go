@@ -2,10 +2,14 @@ package grpc
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
 	"time"
 
 	"pet-proj/internal/services"
+	"pet-proj/pkg/kafka"
 	"pet-proj/proto/common"
 	"pet-proj/proto/consumer"
 	"github.com/sirupsen/logrus"
@@ -40,32 +44,64 @@ func (h *ConsumerHandler) GetProcessedEvent(ctx context.Context, req *consumer.G
 		return nil, status.Error(codes.NotFound, "processed event not found")
 	}
 
-	// Извлекаем данные из processedEvent
-	var event *common.Event
-	var processedAt string
-	var statusStr string
+	processed := processedEventToProto(processedEvent)
+
+	return &consumer.GetProcessedEventResponse{
+		Success:     true,
+		Event:       processed.Event,
+		ProcessedAt: processed.ProcessedAt,
+		Status:      processed.Status,
+		Message:     "Processed event retrieved successfully",
+	}, nil
+}
+
+// BatchGetProcessedEvents получает обработанные события по списку ID одним запросом к Redis
+func (h *ConsumerHandler) BatchGetProcessedEvents(ctx context.Context, req *consumer.BatchGetProcessedEventsRequest) (*consumer.BatchGetProcessedEventsResponse, error) {
+	if req == nil || len(req.EventIds) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "event_ids is required")
+	}
+
+	processedEvents, missing, err := h.consumerService.GetProcessedEvents(ctx, req.EventIds)
+	if err != nil {
+		if errors.Is(err, services.ErrBatchTooLarge) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h.logger.WithError(err).WithField("events", len(req.EventIds)).Error("Failed to get processed events")
+		return nil, status.Error(codes.Internal, "failed to get processed events")
+	}
+
+	events := make([]*consumer.ProcessedEvent, 0, len(processedEvents))
+	for _, processedEvent := range processedEvents {
+		events = append(events, processedEventToProto(processedEvent))
+	}
+
+	return &consumer.BatchGetProcessedEventsResponse{
+		Success:    true,
+		Events:     events,
+		MissingIds: missing,
+		Message:    "Processed events retrieved successfully",
+	}, nil
+}
+
+// processedEventToProto извлекает событие, время и статус обработки из кэшированного значения
+func processedEventToProto(processedEvent map[string]interface{}) *consumer.ProcessedEvent {
+	processed := &consumer.ProcessedEvent{}
 
 	if eventData, ok := processedEvent["event"].(map[string]interface{}); ok {
-		event = mapToProtoEvent(eventData)
+		processed.Event = mapToProtoEvent(eventData)
 	}
 
 	if pa, ok := processedEvent["processed_at"].(string); ok {
-		processedAt = pa
+		processed.ProcessedAt = pa
 	} else if pa, ok := processedEvent["processed_at"].(time.Time); ok {
-		processedAt = pa.Format(time.RFC3339)
+		processed.ProcessedAt = pa.Format(time.RFC3339)
 	}
 
 	if s, ok := processedEvent["status"].(string); ok {
-		statusStr = s
+		processed.Status = s
 	}
 
-	return &consumer.GetProcessedEventResponse{
-		Success:     true,
-		Event:       event,
-		ProcessedAt: processedAt,
-		Status:      statusStr,
-		Message:     "Processed event retrieved successfully",
-	}, nil
+	return processed
 }
 
 // GetStats возвращает статистику транзакций
@@ -110,6 +146,169 @@ func (h *ConsumerHandler) HealthCheck(ctx context.Context, req *consumer.HealthC
 	}, nil
 }
 
+// ListDeadLetters возвращает последние сообщения из dead-letter топика
+func (h *ConsumerHandler) ListDeadLetters(ctx context.Context, req *consumer.ListDeadLettersRequest) (*consumer.ListDeadLettersResponse, error) {
+	limit := 100 // default
+	if req != nil && req.Limit > 0 {
+		limit = int(req.Limit)
+	}
+
+	messages, err := h.consumerService.ListDeadLetters(ctx, limit)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to list dead letters")
+		return nil, deadLetterError(err)
+	}
+
+	protoMessages := make([]*consumer.DeadLetter, 0, len(messages))
+	for _, message := range messages {
+		protoMessages = append(protoMessages, deadLetterToProto(message))
+	}
+
+	return &consumer.ListDeadLettersResponse{
+		Success:  true,
+		Messages: protoMessages,
+		Message:  fmt.Sprintf("Retrieved %d dead letters", len(protoMessages)),
+	}, nil
+}
+
+// GetDeadLetter возвращает сообщение из dead-letter топика по партиции и смещению
+func (h *ConsumerHandler) GetDeadLetter(ctx context.Context, req *consumer.GetDeadLetterRequest) (*consumer.GetDeadLetterResponse, error) {
+	if req == nil || req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "partition and offset are required")
+	}
+
+	message, err := h.consumerService.GetDeadLetter(ctx, req.Partition, req.Offset)
+	if err != nil {
+		h.logger.WithError(err).WithField("offset", req.Offset).Error("Failed to get dead letter")
+		return nil, deadLetterError(err)
+	}
+
+	return &consumer.GetDeadLetterResponse{
+		Success:    true,
+		DeadLetter: deadLetterToProto(message),
+		Message:    "Dead letter retrieved successfully",
+	}, nil
+}
+
+// RequeueDeadLetter возвращает сообщение из dead-letter топика в основной топик
+func (h *ConsumerHandler) RequeueDeadLetter(ctx context.Context, req *consumer.RequeueDeadLetterRequest) (*consumer.RequeueDeadLetterResponse, error) {
+	if req == nil || req.Offset < 0 {
+		return nil, status.Error(codes.InvalidArgument, "partition and offset are required")
+	}
+
+	if err := h.consumerService.RequeueDeadLetter(ctx, req.Partition, req.Offset); err != nil {
+		return nil, deadLetterError(err)
+	}
+
+	return &consumer.RequeueDeadLetterResponse{
+		Success: true,
+		Message: "Dead letter requeued successfully",
+	}, nil
+}
+
+// PauseConsumption приостанавливает чтение всех или выбранных партиций
+func (h *ConsumerHandler) PauseConsumption(ctx context.Context, req *consumer.PauseConsumptionRequest) (*consumer.PauseConsumptionResponse, error) {
+	partitions, err := partitionsFromProto(req.GetPartitions())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.consumerService.PauseConsumption(ctx, partitions); err != nil {
+		return nil, consumptionError(err)
+	}
+
+	allPaused, paused := h.pausedPartitions()
+	return &consumer.PauseConsumptionResponse{
+		Success:   true,
+		AllPaused: allPaused,
+		Paused:    paused,
+		Message:   "Consumption paused",
+	}, nil
+}
+
+// ResumeConsumption возобновляет чтение всех или выбранных партиций
+func (h *ConsumerHandler) ResumeConsumption(ctx context.Context, req *consumer.ResumeConsumptionRequest) (*consumer.ResumeConsumptionResponse, error) {
+	partitions, err := partitionsFromProto(req.GetPartitions())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.consumerService.ResumeConsumption(ctx, partitions); err != nil {
+		return nil, consumptionError(err)
+	}
+
+	allPaused, paused := h.pausedPartitions()
+	return &consumer.ResumeConsumptionResponse{
+		Success:   true,
+		AllPaused: allPaused,
+		Paused:    paused,
+		Message:   "Consumption resumed",
+	}, nil
+}
+
+// pausedPartitions возвращает текущие приостановки в формате proto
+func (h *ConsumerHandler) pausedPartitions() (bool, []*consumer.TopicPartitions) {
+	allPaused, partitions := h.consumerService.PausedPartitions()
+
+	paused := make([]*consumer.TopicPartitions, 0, len(partitions))
+	for _, topic := range slices.Sorted(maps.Keys(partitions)) {
+		paused = append(paused, &consumer.TopicPartitions{Topic: topic, Partitions: partitions[topic]})
+	}
+	return allPaused, paused
+}
+
+// partitionsFromProto конвертирует список партиций из запроса
+func partitionsFromProto(items []*consumer.TopicPartitions) (map[string][]int32, error) {
+	partitions := make(map[string][]int32, len(items))
+	for _, item := range items {
+		if item.GetTopic() == "" || len(item.GetPartitions()) == 0 {
+			return nil, status.Error(codes.InvalidArgument, "topic and partitions are required")
+		}
+		partitions[item.GetTopic()] = append(partitions[item.GetTopic()], item.GetPartitions()...)
+	}
+	return partitions, nil
+}
+
+// consumptionError конвертирует ошибку управления чтением в gRPC статус
+func consumptionError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrConsumerControlDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, kafka.ErrUnknownTopic):
+		return status.Error(codes.InvalidArgument, err.Error())
+	default:
+		return status.Error(codes.Internal, "failed to change consumption state")
+	}
+}
+
+// deadLetterError конвертирует ошибку dead-letter очереди в gRPC статус
+func deadLetterError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrDeadLetterQueueDisabled):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, kafka.ErrDeadLetterNotFound):
+		return status.Error(codes.NotFound, "dead letter not found")
+	default:
+		return status.Error(codes.Internal, "dead-letter queue operation failed")
+	}
+}
+
+// deadLetterToProto конвертирует kafka.DeadLetterMessage в proto DeadLetter
+func deadLetterToProto(message *kafka.DeadLetterMessage) *consumer.DeadLetter {
+	return &consumer.DeadLetter{
+		Partition:         message.Partition,
+		Offset:            message.Offset,
+		Key:               message.Key,
+		Value:             message.Value,
+		OriginalTopic:     message.OriginalTopic,
+		OriginalPartition: message.OriginalPartition,
+		OriginalOffset:    message.OriginalOffset,
+		Error:             message.Error,
+		Attempt:           int32(message.Attempt),
+		FailedAt:          message.FailedAt.Format(time.RFC3339),
+	}
+}
+
 // mapToProtoEvent конвертирует map[string]interface{} в proto Event
 func mapToProtoEvent(data map[string]interface{}) *common.Event {
 	event := &common.Event{
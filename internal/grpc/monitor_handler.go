@@ -7,6 +7,7 @@ import (
 
 	"pet-proj/internal/models"
 	"pet-proj/internal/services"
+	"pet-proj/pkg/kafka"
 	"pet-proj/proto/common"
 	"pet-proj/proto/monitor"
 	"github.com/sirupsen/logrus"
@@ -44,10 +45,66 @@ func (h *MonitorHandler) GetHealth(ctx context.Context, req *monitor.GetHealthRe
 		protoHealth.Services = services
 	}
 
-	return &monitor.GetHealthResponse{
+	response := &monitor.GetHealthResponse{
 		Success: true,
 		Health:  protoHealth,
-	}, nil
+	}
+	if report, ok := health["kafka_report"].(*kafka.HealthReport); ok && report != nil {
+		response.Kafka = kafkaHealthToProto(report)
+	}
+
+	return response, nil
+}
+
+// kafkaHealthToProto конвертирует kafka.HealthReport в proto KafkaHealthReport
+func kafkaHealthToProto(report *kafka.HealthReport) *monitor.KafkaHealthReport {
+	protoReport := &monitor.KafkaHealthReport{
+		Status:         report.Status,
+		CheckedAt:      report.CheckedAt.Format(time.RFC3339),
+		DurationMs:     report.Duration.Milliseconds(),
+		ControllerId:   report.ControllerID,
+		TopicCount:     int32(report.TopicCount),
+		PartitionCount: int32(report.PartitionCount),
+		Errors:         report.Errors,
+	}
+
+	for _, broker := range report.Brokers {
+		protoReport.Brokers = append(protoReport.Brokers, &monitor.KafkaBrokerHealth{
+			Id:        broker.ID,
+			Addr:      broker.Addr,
+			Reachable: broker.Reachable,
+			LatencyMs: broker.Latency.Milliseconds(),
+			Error:     broker.Error,
+		})
+	}
+	for _, partition := range report.UnderReplicated {
+		protoReport.UnderReplicated = append(protoReport.UnderReplicated, partitionHealthToProto(partition))
+	}
+	for _, partition := range report.Offline {
+		protoReport.Offline = append(protoReport.Offline, partitionHealthToProto(partition))
+	}
+	for _, shrink := range report.ISRShrinks {
+		protoReport.IsrShrinks = append(protoReport.IsrShrinks, &monitor.KafkaISRShrink{
+			Topic:       shrink.Topic,
+			Partition:   shrink.Partition,
+			PreviousIsr: int32(shrink.PreviousISR),
+			CurrentIsr:  int32(shrink.CurrentISR),
+			DetectedAt:  shrink.DetectedAt.Format(time.RFC3339),
+		})
+	}
+
+	return protoReport
+}
+
+// partitionHealthToProto конвертирует kafka.PartitionHealth в proto KafkaPartitionHealth
+func partitionHealthToProto(partition *kafka.PartitionHealth) *monitor.KafkaPartitionHealth {
+	return &monitor.KafkaPartitionHealth{
+		Topic:     partition.Topic,
+		Partition: partition.Partition,
+		Leader:    partition.Leader,
+		Replicas:  partition.Replicas,
+		Isr:       partition.ISR,
+	}
 }
 
 // GetTransactions возвращает список транзакций
@@ -164,6 +221,46 @@ func (h *MonitorHandler) HealthCheck(ctx context.Context, req *monitor.HealthChe
 	}, nil
 }
 
+// GetConsumerLag возвращает отставание consumer groups
+func (h *MonitorHandler) GetConsumerLag(ctx context.Context, req *monitor.GetConsumerLagRequest) (*monitor.GetConsumerLagResponse, error) {
+	var groups []string
+	if req != nil {
+		groups = req.Groups
+	}
+
+	lags, err := h.monitorService.GetConsumerLag(ctx, groups)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to get consumer lag")
+		return nil, status.Error(codes.Internal, "failed to get consumer lag")
+	}
+
+	protoGroups := make([]*monitor.ConsumerGroupLag, 0, len(lags))
+	for _, groupLag := range lags {
+		protoGroup := &monitor.ConsumerGroupLag{
+			Group:      groupLag.Group,
+			TotalLag:   groupLag.TotalLag,
+			Degraded:   h.monitorService.IsLagDegraded(groupLag),
+			Partitions: make([]*monitor.PartitionLag, 0, len(groupLag.Partitions)),
+		}
+		for _, partition := range groupLag.Partitions {
+			protoGroup.Partitions = append(protoGroup.Partitions, &monitor.PartitionLag{
+				Topic:           partition.Topic,
+				Partition:       partition.Partition,
+				CommittedOffset: partition.CommittedOffset,
+				LatestOffset:    partition.LatestOffset,
+				Lag:             partition.Lag,
+			})
+		}
+		protoGroups = append(protoGroups, protoGroup)
+	}
+
+	return &monitor.GetConsumerLagResponse{
+		Success: true,
+		Groups:  protoGroups,
+		Message: fmt.Sprintf("Retrieved lag for %d consumer groups", len(protoGroups)),
+	}, nil
+}
+
 // transactionToProto конвертирует models.Transaction в proto Transaction
 func transactionToProto(tx *models.Transaction) *common.Transaction {
 	return &common.Transaction{
@@ -175,6 +272,7 @@ func transactionToProto(tx *models.Transaction) *common.Transaction {
 		Service:     tx.Service,
 		EventId:     tx.EventID,
 		ErrorMsg:    tx.ErrorMsg,
+		RequestId:   tx.RequestID,
 		CreatedAt:   tx.CreatedAt.Format(time.RFC3339),
 		UpdatedAt:   tx.UpdatedAt.Format(time.RFC3339),
 	}
@@ -2,7 +2,9 @@ package grpc
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"math"
+	"strconv"
 	"time"
 
 	"pet-proj/internal/models"
@@ -10,10 +12,24 @@ import (
 	"pet-proj/proto/common"
 	"pet-proj/proto/producer"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// ключ метаданных с ключом идемпотентности запроса
+const idempotencyKeyMetadata = "idempotency-key"
+
+// максимальная длина ключа идемпотентности
+const maxIdempotencyKeyLength = 255
+
+// ключ метаданных с идентификатором API клиента для квот по client
+const clientIDMetadata = "x-client-id"
+
+// ключ trailer с числом секунд до освобождения квоты
+const retryAfterMetadata = "retry-after"
+
 // ProducerHandler обрабатывает gRPC запросы для Producer Service
 type ProducerHandler struct {
 	producer.UnimplementedProducerServiceServer
@@ -35,27 +51,68 @@ func (h *ProducerHandler) SendEvent(ctx context.Context, req *producer.SendEvent
 		return nil, status.Error(codes.InvalidArgument, "event is required")
 	}
 
-	start := time.Now()
+	key := metadataValue(ctx, idempotencyKeyMetadata)
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, status.Error(codes.InvalidArgument, "idempotency key is too long")
+	}
 
 	// Конвертируем proto Event в models.Event
 	event := protoToEvent(req.Event)
+	// Время события без timestamp проставит EventService после сравнения повтора
+	// с первым запросом, как и для HTTP
+	if req.Event.Timestamp == "" {
+		event.Timestamp = time.Time{}
+	}
 
 	// Отправляем событие
-	if err := h.eventService.SendEvent(ctx, event); err != nil {
-		h.logger.WithError(err).Error("Failed to send event via gRPC")
-		return nil, status.Error(codes.Internal, "failed to send event")
+	ctx = services.WithClientID(ctx, metadataValue(ctx, clientIDMetadata))
+	result, err := h.eventService.SendEventIdempotent(ctx, key, event)
+	if err != nil {
+		h.logger.WithError(err).WithField("idempotency_key", key).Error("Failed to send event via gRPC")
+		return nil, sendEventError(ctx, err)
 	}
 
-	duration := time.Since(start).Milliseconds()
+	message := "Event sent successfully"
+	if result.Replayed {
+		message = "Event already sent"
+	}
 
 	return &producer.SendEventResponse{
 		Success:    true,
-		EventId:    event.ID,
-		DurationMs: duration,
-		Message:    "Event sent successfully",
+		EventId:    result.EventID,
+		DurationMs: result.DurationMs,
+		Message:    message,
 	}, nil
 }
 
+// metadataValue возвращает первое значение ключа из метаданных запроса
+func metadataValue(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// sendEventError конвертирует ошибку отправки события в gRPC статус
+func sendEventError(ctx context.Context, err error) error {
+	var rateLimitErr *services.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		retryAfter := strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds())))
+		grpc.SetTrailer(ctx, metadata.Pairs(retryAfterMetadata, retryAfter))
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	switch {
+	case errors.Is(err, services.ErrIdempotencyConflict):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, services.ErrIdempotencyInProgress):
+		return status.Error(codes.Aborted, err.Error())
+	default:
+		return status.Error(codes.Internal, "failed to send event")
+	}
+}
+
 // GetEvent получает событие по ID из кэша
 func (h *ProducerHandler) GetEvent(ctx context.Context, req *producer.GetEventRequest) (*producer.GetEventResponse, error) {
 	if req == nil || req.EventId == "" {
@@ -75,6 +132,34 @@ func (h *ProducerHandler) GetEvent(ctx context.Context, req *producer.GetEventRe
 	}, nil
 }
 
+// BatchGetEvents получает события по списку ID из кэша одним запросом к Redis
+func (h *ProducerHandler) BatchGetEvents(ctx context.Context, req *producer.BatchGetEventsRequest) (*producer.BatchGetEventsResponse, error) {
+	if req == nil || len(req.EventIds) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "event_ids is required")
+	}
+
+	events, missing, err := h.eventService.GetEvents(ctx, req.EventIds)
+	if err != nil {
+		if errors.Is(err, services.ErrBatchTooLarge) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		h.logger.WithError(err).WithField("events", len(req.EventIds)).Error("Failed to get events")
+		return nil, status.Error(codes.Internal, "failed to get events")
+	}
+
+	protoEvents := make([]*common.Event, 0, len(events))
+	for _, event := range events {
+		protoEvents = append(protoEvents, eventToProto(event))
+	}
+
+	return &producer.BatchGetEventsResponse{
+		Success:    true,
+		Events:     protoEvents,
+		MissingIds: missing,
+		Message:    "Events retrieved successfully",
+	}, nil
+}
+
 // GetStats возвращает статистику сервиса
 func (h *ProducerHandler) GetStats(ctx context.Context, req *producer.GetStatsRequest) (*producer.GetStatsResponse, error) {
 	stats := &common.Stats{
@@ -106,53 +191,11 @@ func (h *ProducerHandler) HealthCheck(ctx context.Context, req *producer.HealthC
 
 // protoToEvent конвертирует proto Event в models.Event
 func protoToEvent(protoEvent *common.Event) *models.Event {
-	event := &models.Event{
-		ID:        protoEvent.Id,
-		Type:      protoEvent.Type,
-		UserID:    protoEvent.UserId,
-		Data:      make(map[string]interface{}),
-		Source:    protoEvent.Source,
-	}
-
-	// Конвертируем map[string]string в map[string]interface{}
-	for k, v := range protoEvent.Data {
-		event.Data[k] = v
-	}
-
-	// Парсим timestamp
-	if protoEvent.Timestamp != "" {
-		if t, err := time.Parse(time.RFC3339, protoEvent.Timestamp); err == nil {
-			event.Timestamp = t
-		} else {
-			event.Timestamp = time.Now()
-		}
-	} else {
-		event.Timestamp = time.Now()
-	}
-
-	return event
+	return models.EventFromProto(protoEvent)
 }
 
 // eventToProto конвертирует models.Event в proto Event
 func eventToProto(event *models.Event) *common.Event {
-	protoEvent := &common.Event{
-		Id:        event.ID,
-		Type:      event.Type,
-		UserId:    event.UserID,
-		Data:      make(map[string]string),
-		Timestamp: event.Timestamp.Format(time.RFC3339),
-		Source:    event.Source,
-	}
-
-	// Конвертируем map[string]interface{} в map[string]string
-	for k, v := range event.Data {
-		if str, ok := v.(string); ok {
-			protoEvent.Data[k] = str
-		} else {
-			protoEvent.Data[k] = fmt.Sprintf("%v", v)
-		}
-	}
-
-	return protoEvent
+	return models.EventToProto(event)
 }
 
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -24,10 +27,27 @@ func NewProducerHandlers(eventService *services.EventService, logger *logrus.Log
 	}
 }
 
+// заголовки идемпотентности: ключ запроса и признак повторного ответа
+const (
+	HeaderIdempotencyKey     = "Idempotency-Key"
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+)
+
+// заголовок с идентификатором API клиента для квот по client
+const HeaderClientID = "X-Client-ID"
+
 // принимает событие через HTTP POST и отправляет его в систему
 func (h *ProducerHandlers) SendEvent(c *gin.Context) {
 	start := time.Now()
 
+	key := c.GetHeader(HeaderIdempotencyKey)
+	if len(key) > maxIdempotencyKeyLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency key is too long"})
+		monitoring.HTTPRequestsTotal.WithLabelValues("POST", "/api/v1/events", "400").Inc()
+		return
+	}
+
 	var event models.Event
 	if err := c.ShouldBindJSON(&event); err != nil {
 		h.logger.WithError(err).Error("Failed to bind JSON")
@@ -41,10 +61,23 @@ func (h *ProducerHandlers) SendEvent(c *gin.Context) {
 		event.Source = models.SourceProducer
 	}
 
-	if err := h.eventService.SendEvent(c.Request.Context(), &event); err != nil {
-		h.logger.WithError(err).Error("Failed to send event")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send event"})
-		monitoring.HTTPRequestsTotal.WithLabelValues("POST", "/api/v1/events", "500").Inc()
+	ctx := services.WithClientID(c.Request.Context(), c.GetHeader(HeaderClientID))
+	result, err := h.eventService.SendEventIdempotent(ctx, key, &event)
+	if err != nil {
+		h.logger.WithError(err).WithField("idempotency_key", key).Error("Failed to send event")
+		var rateLimitErr *services.RateLimitError
+		switch {
+		case errors.As(err, &rateLimitErr):
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(rateLimitErr.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+			monitoring.HTTPRequestsTotal.WithLabelValues("POST", "/api/v1/events", "429").Inc()
+		case errors.Is(err, services.ErrIdempotencyConflict), errors.Is(err, services.ErrIdempotencyInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			monitoring.HTTPRequestsTotal.WithLabelValues("POST", "/api/v1/events", "409").Inc()
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send event"})
+			monitoring.HTTPRequestsTotal.WithLabelValues("POST", "/api/v1/events", "500").Inc()
+		}
 		return
 	}
 
@@ -52,10 +85,16 @@ func (h *ProducerHandlers) SendEvent(c *gin.Context) {
 	monitoring.HTTPRequestDuration.WithLabelValues("POST", "/api/v1/events").Observe(duration)
 	monitoring.HTTPRequestsTotal.WithLabelValues("POST", "/api/v1/events", "200").Inc()
 
+	message := "Event sent successfully"
+	if result.Replayed {
+		message = "Event already sent"
+		c.Header(HeaderIdempotentReplayed, "true")
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message":     "Event sent successfully",
-		"event_id":    event.ID,
-		"duration_ms": int64(duration * 1000),
+		"message":     message,
+		"event_id":    result.EventID,
+		"duration_ms": result.DurationMs,
 	})
 }
 
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"pet-proj/pkg/kafka"
 	"pet-proj/pkg/monitoring"
 	"github.com/sirupsen/logrus"
 )
@@ -61,7 +62,7 @@ func CORS() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
 		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, Idempotency-Key, X-Client-ID")
 		
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -81,6 +82,11 @@ func RequestID() gin.HandlerFunc {
 		
 		c.Header("X-Request-ID", requestID)
 		c.Set("request_id", requestID)
+
+		// Request ID и trace context передаются дальше в заголовках сообщений Kafka
+		ctx := kafka.WithRequestID(c.Request.Context(), requestID)
+		ctx = kafka.WithTraceContext(ctx, c.GetHeader("traceparent"), c.GetHeader("tracestate"))
+		c.Request = c.Request.WithContext(ctx)
 		c.Next()
 	}
 }
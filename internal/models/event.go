@@ -13,6 +13,8 @@ type Event struct {
 	Data      map[string]interface{} `json:"data"`
 	Timestamp time.Time              `json:"timestamp"`
 	Source    string                 `json:"source"`
+	// Ссылка на крупный payload во внешнем хранилище; Data при этом пустой
+	PayloadRef string `json:"payload_ref,omitempty"`
 }
 
 func NewEvent(eventType, userID, source string, data map[string]interface{}) *Event {
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"pet-proj/proto/common"
+)
+
+// конвертирует событие в proto Event; значения Data приводятся к строкам
+func EventToProto(event *Event) *common.Event {
+	protoEvent := &common.Event{
+		Id:         event.ID,
+		Type:       event.Type,
+		UserId:     event.UserID,
+		Data:       make(map[string]string, len(event.Data)),
+		Timestamp:  event.Timestamp.Format(time.RFC3339Nano),
+		Source:     event.Source,
+		PayloadRef: event.PayloadRef,
+	}
+
+	for k, v := range event.Data {
+		if str, ok := v.(string); ok {
+			protoEvent.Data[k] = str
+		} else {
+			protoEvent.Data[k] = fmt.Sprintf("%v", v)
+		}
+	}
+
+	return protoEvent
+}
+
+// конвертирует proto Event в событие; без валидного timestamp берется текущее время
+func EventFromProto(protoEvent *common.Event) *Event {
+	event := &Event{
+		ID:         protoEvent.Id,
+		Type:       protoEvent.Type,
+		UserID:     protoEvent.UserId,
+		Data:       make(map[string]interface{}, len(protoEvent.Data)),
+		Timestamp:  time.Now(),
+		Source:     protoEvent.Source,
+		PayloadRef: protoEvent.PayloadRef,
+	}
+
+	for k, v := range protoEvent.Data {
+		event.Data[k] = v
+	}
+
+	if protoEvent.Timestamp != "" {
+		if t, err := time.Parse(time.RFC3339Nano, protoEvent.Timestamp); err == nil {
+			event.Timestamp = t
+		}
+	}
+
+	return event
+}
+
+// кодирует событие в protobuf для отправки в Kafka
+func (e *Event) MarshalProto() ([]byte, error) {
+	return proto.Marshal(EventToProto(e))
+}
+
+// декодирует событие из protobuf сообщения Kafka
+func (e *Event) UnmarshalProto(data []byte) error {
+	var protoEvent common.Event
+	if err := proto.Unmarshal(data, &protoEvent); err != nil {
+		return err
+	}
+	*e = *EventFromProto(&protoEvent)
+	return nil
+}
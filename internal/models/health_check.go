@@ -0,0 +1,16 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type HealthCheck struct {
+	ID           int64           `json:"id" db:"id"`
+	ServiceName  string          `json:"service_name" db:"service_name"`
+	Status       string          `json:"status" db:"status"`
+	ResponseTime int64           `json:"response_time_ms" db:"response_time_ms"`
+	ErrorMsg     string          `json:"error_message" db:"error_message"`
+	Details      json.RawMessage `json:"details" db:"details"`
+	Timestamp    time.Time       `json:"timestamp" db:"timestamp"`
+}
@@ -11,6 +11,7 @@ type Transaction struct {
 	Service     string    `json:"service" db:"service"`
 	EventID     string    `json:"event_id" db:"event_id"`
 	ErrorMsg    string    `json:"error_msg" db:"error_msg"`
+	RequestID   string    `json:"request_id" db:"request_id"`
 	CreatedAt   time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+)
+
+// максимальное число ID в пакетном запросе по умолчанию
+const DefaultMaxBatchSize = 100
+
+var ErrBatchTooLarge = errors.New("batch is too large")
+
+// убирает пустые и повторяющиеся ID с сохранением порядка и проверяет размер пакета
+func batchIDs(ids []string, maxSize int) ([]string, error) {
+	seen := make(map[string]bool, len(ids))
+	unique := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		unique = append(unique, id)
+	}
+
+	if maxSize > 0 && len(unique) > maxSize {
+		return nil, fmt.Errorf("%w: %d ids, maximum is %d", ErrBatchTooLarge, len(unique), maxSize)
+	}
+	return unique, nil
+}
+
+// убирает префикс ключа кэша из ненайденных ключей
+func trimKeyPrefix(keys []string, prefix string) []string {
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, key[len(prefix):])
+	}
+	return ids
+}
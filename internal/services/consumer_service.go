@@ -3,21 +3,39 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"pet-proj/internal/models"
+	"pet-proj/pkg/claimcheck"
+	"pet-proj/pkg/kafka"
 	"pet-proj/pkg/monitoring"
 	"pet-proj/pkg/postgres"
 	"pet-proj/pkg/redis"
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrDeadLetterQueueDisabled = errors.New("dead-letter queue is not configured")
+	ErrConsumerControlDisabled = errors.New("consumer control is not configured")
+	ErrEventInProgress         = errors.New("event is being processed by another consumer")
+)
+
 // обрабатывает сообщения из Kafka и сохраняет транзакции в бд
 type ConsumerService struct {
 	redisClient    redis.ClientInterface
 	postgresClient postgres.ClientInterface
+	deadLetters    kafka.DeadLetterQueueInterface
+	consumers      []kafka.PartitionControllerInterface
+	payloads       claimcheck.Store
+	dedup          redis.DeduplicatorInterface
+	maxBatchSize   int
 	logger         *logrus.Logger
 }
 
@@ -25,22 +43,76 @@ func NewConsumerService(redisClient redis.ClientInterface, postgresClient postgr
 	return &ConsumerService{
 		redisClient:    redisClient,
 		postgresClient: postgresClient,
+		maxBatchSize:   DefaultMaxBatchSize,
 		logger:         logger,
 	}
 }
 
+// задает максимальное число ID в GetProcessedEvents
+func (s *ConsumerService) SetMaxBatchSize(size int) {
+	s.maxBatchSize = size
+}
+
+// подключает dead-letter очередь для административных методов
+func (s *ConsumerService) SetDeadLetterQueue(deadLetters kafka.DeadLetterQueueInterface) {
+	s.deadLetters = deadLetters
+}
+
+// подключает consumer, чтением которых можно управлять через административные методы
+func (s *ConsumerService) SetConsumers(consumers ...kafka.PartitionControllerInterface) {
+	s.consumers = consumers
+}
+
+// подключает хранилище, из которого загружаются вынесенные payload событий
+func (s *ConsumerService) SetClaimCheck(store claimcheck.Store) {
+	s.payloads = store
+}
+
+// включает защиту от повторной обработки событий, доставленных Kafka повторно
+func (s *ConsumerService) SetDeduplicator(dedup redis.DeduplicatorInterface) {
+	s.dedup = dedup
+}
+
 // обрабатывает сообщение из Kafka и создает транзакцию
 func (s *ConsumerService) HandleMessage(ctx context.Context, message *sarama.ConsumerMessage) error {
 	start := time.Now()
 
+	// Request ID исходного запроса восстанавливается consumer из заголовков сообщения
+	requestID := kafka.RequestIDFromContext(ctx)
+	logger := s.logger.WithField("request_id", requestID)
+
+	// Формат тела определяется заголовком content-type: JSON или protobuf
 	var event models.Event
-	if err := json.Unmarshal(message.Value, &event); err != nil {
-		s.logger.WithError(err).Error("Failed to unmarshal message")
-		monitoring.KafkaMessageDuration.WithLabelValues("user-events").Observe(time.Since(start).Seconds())
+	if err := kafka.DecodeMessage(message, &event); err != nil {
+		logger.WithError(err).Error("Failed to unmarshal message")
+		monitoring.KafkaMessageDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
+		// Повторная обработка не исправит невалидное сообщение
+		return kafka.Permanent(err)
+	}
+
+	// Повторно доставленное событие не обрабатываем и не записываем второй раз
+	token, duplicate, err := s.acquireEvent(ctx, &event)
+	if err != nil {
+		logger.WithError(err).WithField("event_id", event.ID).Warn("Failed to acquire event for processing")
+		monitoring.KafkaMessageDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
 		return err
 	}
+	if duplicate {
+		logger.WithField("event_id", event.ID).Info("Duplicate event skipped")
+		monitoring.EventsDuplicateTotal.WithLabelValues(event.Type).Inc()
+		monitoring.KafkaMessageDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
+		return nil
+	}
 
-	s.logger.WithFields(logrus.Fields{
+	// Крупный payload хранится отдельно, в сообщении только ссылка на него
+	if err := s.resolvePayload(ctx, &event); err != nil {
+		logger.WithError(err).WithField("payload_ref", event.PayloadRef).Error("Failed to resolve event payload")
+		s.finishEvent(ctx, event.ID, token, err)
+		monitoring.KafkaMessageDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
+		return err
+	}
+
+	logger.WithFields(logrus.Fields{
 		"event_id":   event.ID,
 		"event_type": event.Type,
 		"partition":  message.Partition,
@@ -59,23 +131,108 @@ func (s *ConsumerService) HandleMessage(ctx context.Context, message *sarama.Con
 		Service:     models.ServiceConsumer,
 		EventID:     event.ID,
 		ErrorMsg:    "",
+		RequestID:   requestID,
 	}
 
 	if err != nil {
 		transaction.ErrorMsg = err.Error()
-		s.logger.WithError(err).Error("Failed to process event")
+		logger.WithError(err).Error("Failed to process event")
 	}
 
-	// Сохраняем транзакцию в бд
-	if err := s.postgresClient.InsertTransaction(transaction); err != nil {
-		s.logger.WithError(err).Error("Failed to save transaction")
+	// Сохраняем транзакцию в бд; без записи аудита сообщение не считается обработанным
+	if insertErr := s.postgresClient.InsertTransaction(transaction); insertErr != nil {
+		logger.WithError(insertErr).Error("Failed to save transaction")
+		err = errors.Join(err, fmt.Errorf("failed to save transaction: %w", insertErr))
 	}
 
+	// Событие считается обработанным только вместе с записью транзакции
+	s.finishEvent(ctx, event.ID, token, err)
+
 	// Обновляем метрики производительности
-	monitoring.KafkaMessageDuration.WithLabelValues("user-events").Observe(time.Since(start).Seconds())
-	monitoring.EventsProcessedTotal.WithLabelValues(event.Type, models.ServiceConsumer, "success").Inc()
+	processStatus := "success"
+	if err != nil {
+		processStatus = "failed"
+	}
+	monitoring.KafkaMessageDuration.WithLabelValues(message.Topic).Observe(time.Since(start).Seconds())
+	monitoring.EventsProcessedTotal.WithLabelValues(event.Type, models.ServiceConsumer, processStatus).Inc()
 	monitoring.TransactionsTotal.WithLabelValues(models.ServiceConsumer, kafkaStatus, redisStatus).Inc()
 
+	// Ошибку возвращаем, чтобы сообщение ушло на повторную обработку
+	return err
+}
+
+// занимает событие для обработки; duplicate - событие уже обработано
+func (s *ConsumerService) acquireEvent(ctx context.Context, event *models.Event) (string, bool, error) {
+	if s.dedup == nil {
+		return "", false, nil
+	}
+
+	token, state, err := s.dedup.Acquire(ctx, event.ID)
+	if err != nil {
+		return "", false, err
+	}
+
+	switch state {
+	case redis.DedupDuplicate:
+		return "", true, nil
+	case redis.DedupInProgress:
+		// Обработчик другого consumer еще держит аренду; если он упадет,
+		// аренда истечет и событие будет обработано при повторе
+		return "", false, ErrEventInProgress
+	default:
+		return token, false, nil
+	}
+}
+
+// помечает событие обработанным после успеха или освобождает его после ошибки
+func (s *ConsumerService) finishEvent(ctx context.Context, eventID, token string, processErr error) {
+	if s.dedup == nil || token == "" {
+		return
+	}
+
+	logger := s.logger.WithField("event_id", eventID)
+	if processErr != nil {
+		if err := s.dedup.Release(ctx, eventID, token); err != nil {
+			logger.WithError(err).Error("Failed to release event")
+		}
+		return
+	}
+
+	completed, err := s.dedup.Complete(ctx, eventID, token)
+	if err != nil {
+		logger.WithError(err).Error("Failed to mark event as processed")
+		return
+	}
+	if !completed {
+		logger.Warn("Event lease expired before processing completed")
+	}
+}
+
+// загружает вынесенный payload в Data события
+func (s *ConsumerService) resolvePayload(ctx context.Context, event *models.Event) error {
+	if event.PayloadRef == "" {
+		return nil
+	}
+	if s.payloads == nil {
+		return kafka.Permanent(fmt.Errorf("payload store is not configured for %s", event.PayloadRef))
+	}
+
+	payload, err := claimcheck.Resolve(ctx, s.payloads, event.PayloadRef)
+	if err != nil {
+		// Потерянный или поврежденный payload не появится при повторной обработке
+		if errors.Is(err, claimcheck.ErrPayloadNotFound) || errors.Is(err, claimcheck.ErrPayloadCorrupted) {
+			return kafka.Permanent(err)
+		}
+		return err
+	}
+
+	var data map[string]interface{}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return kafka.Permanent(fmt.Errorf("failed to unmarshal payload %s: %w", event.PayloadRef, err))
+	}
+
+	event.Data = data
+	event.PayloadRef = ""
 	return nil
 }
 
@@ -90,8 +247,10 @@ func (s *ConsumerService) ProcessEvent(ctx context.Context, event *models.Event)
 		"status":       "processed",
 	}
 
+	var cacheErr error
 	if err := s.redisClient.Set(ctx, cacheKey, processedEvent, 30*time.Minute); err != nil {
 		redisStatus = models.StatusBad
+		cacheErr = fmt.Errorf("failed to cache processed event: %w", err)
 		s.logger.WithError(err).Error("Failed to cache processed event")
 	}
 
@@ -107,7 +266,7 @@ func (s *ConsumerService) ProcessEvent(ctx context.Context, event *models.Event)
 		s.logger.WithField("event_type", event.Type).Warn("Unknown event type")
 	}
 
-	return models.StatusOK, redisStatus, nil
+	return models.StatusOK, redisStatus, cacheErr
 }
 
 // обрабатывает действия пользователя
@@ -151,6 +310,39 @@ func (s *ConsumerService) GetProcessedEvent(ctx context.Context, eventID string)
 	return processedEvent, nil
 }
 
+// получает обработанные события из кэша Redis одним запросом; возвращает найденные
+// события в порядке ids и ID, которых нет в кэше
+func (s *ConsumerService) GetProcessedEvents(ctx context.Context, ids []string) ([]map[string]interface{}, []string, error) {
+	ids, err := batchIDs(ids, s.maxBatchSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, "processed_event:"+id)
+	}
+
+	found := make(map[string]*map[string]interface{}, len(keys))
+	missingKeys, err := s.redisClient.GetMany(ctx, keys, func(key string) interface{} {
+		processedEvent := &map[string]interface{}{}
+		found[key] = processedEvent
+		return processedEvent
+	})
+	if err != nil {
+		s.logger.WithError(err).WithField("events", len(ids)).Error("Failed to get processed events from cache")
+		return nil, nil, err
+	}
+
+	processedEvents := make([]map[string]interface{}, 0, len(found))
+	for _, key := range keys {
+		if processedEvent, ok := found[key]; ok {
+			processedEvents = append(processedEvents, *processedEvent)
+		}
+	}
+	return processedEvents, trimKeyPrefix(missingKeys, "processed_event:"), nil
+}
+
 // возвращает статистику транзакций из бд
 func (s *ConsumerService) GetStats(ctx context.Context) (map[string]interface{}, error) {
 	stats, err := s.postgresClient.GetTransactionStats()
@@ -159,10 +351,141 @@ func (s *ConsumerService) GetStats(ctx context.Context) (map[string]interface{},
 		return nil, err
 	}
 
+	if len(s.consumers) > 0 {
+		stats["paused_partitions"] = s.pausedPartitionsSummary()
+	}
+
 	return stats, nil
 }
 
+// приостанавливает чтение выбранных партиций; пустой набор - всех партиций всех consumer
+func (s *ConsumerService) PauseConsumption(ctx context.Context, partitions map[string][]int32) error {
+	return s.controlConsumption(partitions, "Consumption paused", kafka.PartitionControllerInterface.PausePartitions)
+}
+
+// возобновляет чтение выбранных партиций; пустой набор - всех партиций всех consumer
+func (s *ConsumerService) ResumeConsumption(ctx context.Context, partitions map[string][]int32) error {
+	return s.controlConsumption(partitions, "Consumption resumed", kafka.PartitionControllerInterface.ResumePartitions)
+}
+
+// возвращает приостановки чтения по всем consumer; топик без партиций
+// приостановлен целиком
+func (s *ConsumerService) PausedPartitions() (bool, map[string][]int32) {
+	all := len(s.consumers) > 0
+	partitions := make(map[string][]int32)
+	for _, consumer := range s.consumers {
+		state := consumer.PausedPartitions()
+		all = all && state.All
+		if state.All {
+			for _, topic := range consumer.Topics() {
+				partitions[topic] = nil
+			}
+			continue
+		}
+		for topic, ids := range state.Partitions {
+			partitions[topic] = append(partitions[topic], ids...)
+		}
+	}
+	return all, partitions
+}
+
+// раздает партиции consumer, читающим их топики, и применяет к ним операцию
+func (s *ConsumerService) controlConsumption(partitions map[string][]int32, action string, apply func(kafka.PartitionControllerInterface, map[string][]int32) error) error {
+	if len(s.consumers) == 0 {
+		return ErrConsumerControlDisabled
+	}
+
+	// Проверяем все топики до изменения состояния, чтобы не применить запрос частично
+	selected := make([]map[string][]int32, len(s.consumers))
+	for topic, ids := range partitions {
+		found := false
+		for i, consumer := range s.consumers {
+			if slices.Contains(consumer.Topics(), topic) {
+				if selected[i] == nil {
+					selected[i] = make(map[string][]int32)
+				}
+				selected[i][topic] = ids
+				found = true
+			}
+		}
+		if !found {
+			return fmt.Errorf("%w: %s", kafka.ErrUnknownTopic, topic)
+		}
+	}
+
+	for i, consumer := range s.consumers {
+		if len(partitions) > 0 && selected[i] == nil {
+			continue
+		}
+		if err := apply(consumer, selected[i]); err != nil {
+			s.logger.WithError(err).Error("Failed to change consumption state")
+			return err
+		}
+	}
+
+	s.logger.WithField("partitions", partitions).Warn(action)
+	return nil
+}
+
+// описывает приостановки чтения одной строкой для статистики
+func (s *ConsumerService) pausedPartitionsSummary() string {
+	all, partitions := s.PausedPartitions()
+	if all {
+		return "all"
+	}
+	if len(partitions) == 0 {
+		return "none"
+	}
+
+	var parts []string
+	for _, topic := range slices.Sorted(maps.Keys(partitions)) {
+		if len(partitions[topic]) == 0 {
+			parts = append(parts, topic+":all")
+			continue
+		}
+		ids := make([]string, 0, len(partitions[topic]))
+		for _, partition := range partitions[topic] {
+			ids = append(ids, strconv.Itoa(int(partition)))
+		}
+		parts = append(parts, topic+":"+strings.Join(ids, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
 // сохраняет транзакцию в бд
 func (s *ConsumerService) InsertTransaction(tx *models.Transaction) error {
 	return s.postgresClient.InsertTransaction(tx)
 }
+
+// возвращает последние сообщения из dead-letter топика
+func (s *ConsumerService) ListDeadLetters(ctx context.Context, limit int) ([]*kafka.DeadLetterMessage, error) {
+	if s.deadLetters == nil {
+		return nil, ErrDeadLetterQueueDisabled
+	}
+	return s.deadLetters.List(ctx, limit)
+}
+
+// возвращает сообщение из dead-letter топика по партиции и смещению
+func (s *ConsumerService) GetDeadLetter(ctx context.Context, partition int32, offset int64) (*kafka.DeadLetterMessage, error) {
+	if s.deadLetters == nil {
+		return nil, ErrDeadLetterQueueDisabled
+	}
+	return s.deadLetters.Get(ctx, partition, offset)
+}
+
+// возвращает сообщение из dead-letter топика обратно в основной топик
+func (s *ConsumerService) RequeueDeadLetter(ctx context.Context, partition int32, offset int64) error {
+	if s.deadLetters == nil {
+		return ErrDeadLetterQueueDisabled
+	}
+
+	if err := s.deadLetters.Requeue(ctx, partition, offset); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{
+			"partition": partition,
+			"offset":    offset,
+		}).Error("Failed to requeue dead-letter message")
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/internal/models"
+	"pet-proj/pkg/monitoring"
+	"pet-proj/pkg/redis"
+)
+
+// возвращает заданное состояние события и запоминает вызовы
+type fakeDeduplicator struct {
+	state    redis.DedupState
+	err      error
+	acquired []string
+}
+
+func (d *fakeDeduplicator) Acquire(ctx context.Context, eventID string) (string, redis.DedupState, error) {
+	d.acquired = append(d.acquired, eventID)
+	if d.err != nil || d.state != redis.DedupAcquired {
+		return "", d.state, d.err
+	}
+	return "token", d.state, nil
+}
+
+func (d *fakeDeduplicator) Complete(ctx context.Context, eventID, token string) (bool, error) {
+	return true, nil
+}
+
+func (d *fakeDeduplicator) Release(ctx context.Context, eventID, token string) error {
+	return nil
+}
+
+func TestHandleMessageDeduplication(t *testing.T) {
+	tests := []struct {
+		name          string
+		dedup         *fakeDeduplicator
+		wantErr       error
+		wantDuplicate float64
+	}{
+		{
+			// Postgres and Redis clients are nil: a duplicate must not reach them
+			name:          "DuplicateSkipped",
+			dedup:         &fakeDeduplicator{state: redis.DedupDuplicate},
+			wantDuplicate: 1,
+		},
+		{
+			name:    "InProgressRetried",
+			dedup:   &fakeDeduplicator{state: redis.DedupInProgress},
+			wantErr: ErrEventInProgress,
+		},
+		{
+			name:    "AcquireError",
+			dedup:   &fakeDeduplicator{err: errors.New("redis unavailable")},
+			wantErr: errors.New("redis unavailable"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewConsumerService(nil, nil, testLogger())
+			service.SetDeduplicator(tt.dedup)
+
+			event := models.NewEvent(models.EventTypeUserAction, "user_1", models.SourceProducer, nil)
+			value, err := json.Marshal(event)
+			require.NoError(t, err)
+
+			duplicates := monitoring.EventsDuplicateTotal.WithLabelValues(event.Type)
+			before := testutil.ToFloat64(duplicates)
+
+			err = service.HandleMessage(context.Background(), &sarama.ConsumerMessage{Topic: "user-events", Value: value})
+			if tt.wantErr != nil {
+				assert.EqualError(t, err, tt.wantErr.Error())
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, []string{event.ID}, tt.dedup.acquired)
+			assert.Equal(t, tt.wantDuplicate, testutil.ToFloat64(duplicates)-before)
+		})
+	}
+}
@@ -2,31 +2,158 @@ package services
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
 	"pet-proj/internal/models"
+	"pet-proj/pkg/claimcheck"
 	"pet-proj/pkg/kafka"
 	"pet-proj/pkg/monitoring"
 	"pet-proj/pkg/redis"
+	"github.com/google/uuid"
 	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+)
+
+var (
+	ErrIdempotencyConflict   = errors.New("idempotency key was already used with a different request")
+	ErrIdempotencyInProgress = errors.New("request with this idempotency key is still in progress")
 )
 
 // обрабатывает события: отправляет в Kafka и кэширует в Redis
 type EventService struct {
 	kafkaProducer kafka.ProducerInterface
 	redisClient   redis.ClientInterface
+	router        *kafka.TopicRouter
+	payloads      claimcheck.Store
+	payloadLimit  int
+	idempotency   redis.IdempotencyStoreInterface
+	limiter       redis.RateLimiterInterface
+	rateLimits    []RateLimitRule
+	maxBatchSize  int
 	logger        *logrus.Logger
 }
 
+// ответ на отправку события; сохраняется для повторов с тем же ключом идемпотентности
+type SendEventResult struct {
+	EventID    string `json:"event_id"`
+	DurationMs int64  `json:"duration_ms"`
+	// Ответ взят из сохраненного результата первого запроса
+	Replayed bool `json:"-"`
+}
+
 func NewEventService(kafkaProducer kafka.ProducerInterface, redisClient redis.ClientInterface, logger *logrus.Logger) *EventService {
 	return &EventService{
 		kafkaProducer: kafkaProducer,
 		redisClient:   redisClient,
+		maxBatchSize:  DefaultMaxBatchSize,
 		logger:        logger,
 	}
 }
 
+// задает максимальное число ID в GetEvents
+func (s *EventService) SetMaxBatchSize(size int) {
+	s.maxBatchSize = size
+}
+
+// включает маршрутизацию событий по топикам в зависимости от типа
+func (s *EventService) SetTopicRouter(router *kafka.TopicRouter) {
+	s.router = router
+}
+
+// включает вынос Data размером больше limit байт во внешнее хранилище;
+// в Kafka отправляется событие со ссылкой на payload
+func (s *EventService) SetClaimCheck(store claimcheck.Store, limit int) {
+	s.payloads = store
+	s.payloadLimit = limit
+}
+
+// включает хранение ответов по ключу идемпотентности
+func (s *EventService) SetIdempotency(store redis.IdempotencyStoreInterface) {
+	s.idempotency = store
+}
+
+// отправляет событие не более одного раза на ключ идемпотентности API клиента из
+// контекста: повтор с тем же ключом и тем же событием возвращает сохраненный ответ
+// первого, а с другим событием - ErrIdempotencyConflict; пустой ключ отключает проверку
+func (s *EventService) SendEventIdempotent(ctx context.Context, key string, event *models.Event) (*SendEventResult, error) {
+	if key == "" || s.idempotency == nil {
+		return s.sendEvent(ctx, event)
+	}
+
+	// Отпечаток считается до того, как SendEvent заполнит ID и время события
+	fingerprint, err := eventFingerprint(event)
+	if err != nil {
+		return nil, err
+	}
+
+	client := ClientIDFromContext(ctx)
+	record, acquired, err := s.idempotency.Begin(ctx, client, key, fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	if !acquired {
+		return storedResult(record, fingerprint)
+	}
+
+	result, err := s.sendEvent(ctx, event)
+	if err != nil {
+		// Неудачный запрос не сохраняем, клиент может повторить его с тем же ключом
+		if abortErr := s.idempotency.Abort(ctx, client, key, fingerprint); abortErr != nil {
+			s.logger.WithError(abortErr).WithField("idempotency_key", key).Error("Failed to release idempotency key")
+		}
+		return nil, err
+	}
+
+	if err := s.idempotency.Save(ctx, client, key, fingerprint, result); err != nil {
+		s.logger.WithError(err).WithField("idempotency_key", key).Error("Failed to save idempotent response")
+	}
+	return result, nil
+}
+
+// возвращает SHA-256 события в proto представлении: HTTP и gRPC запросы с одним
+// событием дают один отпечаток независимо от порядка полей и пробелов в JSON
+func eventFingerprint(event *models.Event) (string, error) {
+	normalized := *event
+	normalized.Timestamp = event.Timestamp.UTC()
+
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(models.EventToProto(&normalized))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// возвращает сохраненный ответ первого запроса с тем же ключом
+func storedResult(record *redis.IdempotencyRecord, fingerprint string) (*SendEventResult, error) {
+	if record.Fingerprint != fingerprint {
+		return nil, ErrIdempotencyConflict
+	}
+	if len(record.Response) == 0 {
+		return nil, ErrIdempotencyInProgress
+	}
+
+	var result SendEventResult
+	if err := json.Unmarshal(record.Response, &result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored response: %w", err)
+	}
+	result.Replayed = true
+	return &result, nil
+}
+
+func (s *EventService) sendEvent(ctx context.Context, event *models.Event) (*SendEventResult, error) {
+	start := time.Now()
+	if err := s.SendEvent(ctx, event); err != nil {
+		return nil, err
+	}
+	return &SendEventResult{EventID: event.ID, DurationMs: time.Since(start).Milliseconds()}, nil
+}
+
 // отправляет событие в Kafka и кэширует в Redis
 func (s *EventService) SendEvent(ctx context.Context, event *models.Event) error {
 	start := time.Now()
@@ -35,15 +162,36 @@ func (s *EventService) SendEvent(ctx context.Context, event *models.Event) error
 		return fmt.Errorf("event cannot be nil")
 	}
 
-	// Отправляем событие в Kafka
+	// Событие без ID нельзя найти в кэше и дедуплицировать в consumer
+	if event.ID == "" {
+		event.ID = uuid.New().String()
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	// Квоты общие для всех реплик producer
+	if err := s.checkRateLimits(ctx, event); err != nil {
+		return err
+	}
+
+	// Крупный payload заменяем ссылкой, чтобы не превысить лимит размера сообщения Kafka
+	message, err := s.offloadPayload(ctx, event)
+	if err != nil {
+		s.logger.WithError(err).WithField("event_id", event.ID).Error("Failed to offload event payload")
+		return err
+	}
+
+	// Отправляем событие в Kafka, в топик по типу события
 	kafkaStatus := models.StatusOK
-	if err := s.kafkaProducer.SendMessage(ctx, event.ID, event); err != nil {
+	topic, err := s.sendToKafka(ctx, message)
+	if err != nil {
 		kafkaStatus = models.StatusBad
-		s.logger.WithError(err).Error("Failed to send event to Kafka")
-		monitoring.KafkaMessagesTotal.WithLabelValues("user-events", "failed").Inc()
+		s.logger.WithError(err).WithField("topic", topic).Error("Failed to send event to Kafka")
+		monitoring.KafkaMessagesTotal.WithLabelValues(topic, "failed").Inc()
 		return err
 	}
-	monitoring.KafkaMessagesTotal.WithLabelValues("user-events", "success").Inc()
+	monitoring.KafkaMessagesTotal.WithLabelValues(topic, "success").Inc()
 
 	// Кэшируем событие в Redis на 10 минут
 	redisStatus := models.StatusOK
@@ -52,7 +200,6 @@ func (s *EventService) SendEvent(ctx context.Context, event *models.Event) error
 		redisStatus = models.StatusBad
 		s.logger.WithError(err).Error("Failed to cache event in Redis")
 	}
-	monitoring.RedisOperationsTotal.WithLabelValues("set", redisStatus).Inc()
 
 	// Записываем метрики производительности
 	duration := time.Since(start).Milliseconds()
@@ -62,6 +209,8 @@ func (s *EventService) SendEvent(ctx context.Context, event *models.Event) error
 	s.logger.WithFields(logrus.Fields{
 		"event_id":     event.ID,
 		"event_type":   event.Type,
+		"topic":        topic,
+		"request_id":   kafka.RequestIDFromContext(ctx),
 		"kafka_status": kafkaStatus,
 		"redis_status": redisStatus,
 		"duration_ms":  duration,
@@ -70,6 +219,48 @@ func (s *EventService) SendEvent(ctx context.Context, event *models.Event) error
 	return nil
 }
 
+// отправляет событие в топик по маршруту и возвращает имя топика
+func (s *EventService) sendToKafka(ctx context.Context, event *models.Event) (string, error) {
+	// Без маршрутизации producer отправляет в свой топик по умолчанию
+	if s.router == nil {
+		return s.kafkaProducer.Topic(), s.kafkaProducer.SendMessage(ctx, event.ID, event)
+	}
+
+	topic := s.router.Route(event.Type)
+	return topic, s.kafkaProducer.SendMessageToTopic(ctx, topic, event.ID, event)
+}
+
+// возвращает событие для отправки в Kafka: исходное или копию со ссылкой на payload
+func (s *EventService) offloadPayload(ctx context.Context, event *models.Event) (*models.Event, error) {
+	if s.payloads == nil || len(event.Data) == 0 {
+		return event, nil
+	}
+
+	payload, err := json.Marshal(event.Data)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) <= s.payloadLimit {
+		return event, nil
+	}
+
+	ref, err := claimcheck.Offload(ctx, s.payloads, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"event_id":    event.ID,
+		"payload_ref": ref,
+		"size":        len(payload),
+	}).Info("Event payload offloaded")
+
+	message := *event
+	message.Data = nil
+	message.PayloadRef = ref
+	return &message, nil
+}
+
 // получает событие из кэша Redis по ID
 func (s *EventService) GetEvent(ctx context.Context, eventID string) (*models.Event, error) {
 	cacheKey := fmt.Sprintf("event:%s", eventID)
@@ -82,3 +273,36 @@ func (s *EventService) GetEvent(ctx context.Context, eventID string) (*models.Ev
 
 	return &event, nil
 }
+
+// получает события из кэша Redis одним запросом; возвращает найденные события
+// в порядке ids и ID, которых нет в кэше
+func (s *EventService) GetEvents(ctx context.Context, ids []string) ([]*models.Event, []string, error) {
+	ids, err := batchIDs(ids, s.maxBatchSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]string, 0, len(ids))
+	for _, id := range ids {
+		keys = append(keys, "event:"+id)
+	}
+
+	found := make(map[string]*models.Event, len(keys))
+	missingKeys, err := s.redisClient.GetMany(ctx, keys, func(key string) interface{} {
+		event := &models.Event{}
+		found[key] = event
+		return event
+	})
+	if err != nil {
+		s.logger.WithError(err).WithField("events", len(ids)).Error("Failed to get events from cache")
+		return nil, nil, err
+	}
+
+	events := make([]*models.Event, 0, len(found))
+	for _, key := range keys {
+		if event, ok := found[key]; ok {
+			events = append(events, event)
+		}
+	}
+	return events, trimKeyPrefix(missingKeys, "event:"), nil
+}
@@ -0,0 +1,182 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/internal/models"
+	"pet-proj/pkg/redis"
+)
+
+// хранит записи идемпотентности в памяти по клиенту и ключу
+type fakeIdempotencyStore struct {
+	records map[string]*redis.IdempotencyRecord
+	aborted []string
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{records: make(map[string]*redis.IdempotencyRecord)}
+}
+
+func (s *fakeIdempotencyStore) Begin(ctx context.Context, client, key, fingerprint string) (*redis.IdempotencyRecord, bool, error) {
+	if record, ok := s.records[client+"/"+key]; ok {
+		return record, false, nil
+	}
+	s.records[client+"/"+key] = &redis.IdempotencyRecord{Fingerprint: fingerprint}
+	return nil, true, nil
+}
+
+func (s *fakeIdempotencyStore) Save(ctx context.Context, client, key, fingerprint string, response interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	s.records[client+"/"+key] = &redis.IdempotencyRecord{Fingerprint: fingerprint, Response: data}
+	return nil
+}
+
+func (s *fakeIdempotencyStore) Abort(ctx context.Context, client, key, fingerprint string) error {
+	s.aborted = append(s.aborted, client+"/"+key)
+	delete(s.records, client+"/"+key)
+	return nil
+}
+
+// запоминает отправленные события
+type fakeProducer struct {
+	err  error
+	sent []string
+}
+
+func (p *fakeProducer) Topic() string {
+	return "events"
+}
+
+func (p *fakeProducer) SendMessage(ctx context.Context, key string, value interface{}) error {
+	return p.SendMessageToTopic(ctx, p.Topic(), key, value)
+}
+
+func (p *fakeProducer) SendMessageToTopic(ctx context.Context, topic, key string, value interface{}) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.sent = append(p.sent, key)
+	return nil
+}
+
+func (p *fakeProducer) Close() error {
+	return nil
+}
+
+func newIdempotentService(t *testing.T, producer *fakeProducer, store *fakeIdempotencyStore) *EventService {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(mr.Addr(), "", 0, testLogger())
+	t.Cleanup(func() { client.Close() })
+
+	service := NewEventService(producer, client, testLogger())
+	service.SetIdempotency(store)
+	return service
+}
+
+func TestSendEventIdempotent(t *testing.T) {
+	newEvent := func(value string) *models.Event {
+		return &models.Event{Type: "click", Source: "web", Data: map[string]interface{}{"value": value}}
+	}
+
+	t.Run("Replay", func(t *testing.T) {
+		producer := &fakeProducer{}
+		service := newIdempotentService(t, producer, newFakeIdempotencyStore())
+		ctx := WithClientID(context.Background(), "mobile")
+
+		first, err := service.SendEventIdempotent(ctx, "1", newEvent("a"))
+		require.NoError(t, err)
+		assert.False(t, first.Replayed)
+
+		second, err := service.SendEventIdempotent(ctx, "1", newEvent("a"))
+		require.NoError(t, err)
+		assert.True(t, second.Replayed)
+		assert.Equal(t, first.EventID, second.EventID)
+		assert.Len(t, producer.sent, 1)
+	})
+
+	t.Run("Conflict", func(t *testing.T) {
+		producer := &fakeProducer{}
+		service := newIdempotentService(t, producer, newFakeIdempotencyStore())
+		ctx := WithClientID(context.Background(), "mobile")
+
+		_, err := service.SendEventIdempotent(ctx, "1", newEvent("a"))
+		require.NoError(t, err)
+
+		_, err = service.SendEventIdempotent(ctx, "1", newEvent("b"))
+		assert.ErrorIs(t, err, ErrIdempotencyConflict)
+		assert.Len(t, producer.sent, 1)
+	})
+
+	t.Run("InProgress", func(t *testing.T) {
+		producer := &fakeProducer{}
+		store := newFakeIdempotencyStore()
+		service := newIdempotentService(t, producer, store)
+
+		fingerprint, err := eventFingerprint(newEvent("a"))
+		require.NoError(t, err)
+		store.records["/1"] = &redis.IdempotencyRecord{Fingerprint: fingerprint}
+
+		_, err = service.SendEventIdempotent(context.Background(), "1", newEvent("a"))
+		assert.ErrorIs(t, err, ErrIdempotencyInProgress)
+		assert.Empty(t, producer.sent)
+	})
+
+	t.Run("KeysScopedByClient", func(t *testing.T) {
+		producer := &fakeProducer{}
+		service := newIdempotentService(t, producer, newFakeIdempotencyStore())
+
+		for _, client := range []string{"mobile", "web"} {
+			result, err := service.SendEventIdempotent(WithClientID(context.Background(), client), "1", newEvent("a"))
+			require.NoError(t, err)
+			assert.False(t, result.Replayed)
+		}
+		assert.Len(t, producer.sent, 2)
+	})
+
+	t.Run("FailedSendReleasesKey", func(t *testing.T) {
+		producer := &fakeProducer{err: errors.New("broker unavailable")}
+		store := newFakeIdempotencyStore()
+		service := newIdempotentService(t, producer, store)
+
+		_, err := service.SendEventIdempotent(context.Background(), "1", newEvent("a"))
+		require.Error(t, err)
+		assert.Equal(t, []string{"/1"}, store.aborted)
+
+		producer.err = nil
+		result, err := service.SendEventIdempotent(context.Background(), "1", newEvent("a"))
+		require.NoError(t, err)
+		assert.False(t, result.Replayed)
+	})
+}
+
+func TestEventFingerprint(t *testing.T) {
+	timestamp := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// HTTP decodes JSON numbers as float64, gRPC carries every value as a string
+	httpEvent := &models.Event{Type: "click", Data: map[string]interface{}{"n": float64(1), "s": "x"}, Timestamp: timestamp}
+	grpcEvent := &models.Event{Type: "click", Data: map[string]interface{}{"s": "x", "n": "1"}, Timestamp: timestamp.In(time.FixedZone("MSK", 3*60*60))}
+
+	httpFingerprint, err := eventFingerprint(httpEvent)
+	require.NoError(t, err)
+	grpcFingerprint, err := eventFingerprint(grpcEvent)
+	require.NoError(t, err)
+	assert.Equal(t, httpFingerprint, grpcFingerprint)
+
+	changed := *httpEvent
+	changed.Type = "view"
+	changedFingerprint, err := eventFingerprint(&changed)
+	require.NoError(t, err)
+	assert.NotEqual(t, httpFingerprint, changedFingerprint)
+}
@@ -2,7 +2,10 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"pet-proj/internal/models"
@@ -20,11 +23,18 @@ type MonitorService struct {
 	kafkaHealth    *kafka.HealthChecker
 	postgresHealth *postgres.HealthChecker
 	logger         *logrus.Logger
+
+	// consumer groups, отставание которых отслеживается, и порог деградации
+	lagGroups    []string
+	lagThreshold int64
 }
 
-func NewMonitorService(postgresClient postgres.ClientInterface, redisClient redis.ClientInterface, kafkaBrokers []string, postgresDSN string, logger *logrus.Logger) (*MonitorService, error) {
+// статус consumer group с отставанием выше порога
+const StatusDegraded = "degraded"
+
+func NewMonitorService(postgresClient postgres.ClientInterface, redisClient redis.ClientInterface, kafkaBrokers []string, kafkaSecurity *kafka.SecurityConfig, postgresDSN string, logger *logrus.Logger) (*MonitorService, error) {
 	// Создаем Kafka health checker
-	kafkaHealth, err := kafka.NewHealthChecker(kafkaBrokers, logger)
+	kafkaHealth, err := kafka.NewHealthChecker(kafkaBrokers, kafkaSecurity, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Kafka health checker: %w", err)
 	}
@@ -45,6 +55,13 @@ func NewMonitorService(postgresClient postgres.ClientInterface, redisClient redi
 	}, nil
 }
 
+// включает отслеживание отставания consumer groups; при отставании любой
+// группы выше threshold сообщений система считается деградировавшей
+func (s *MonitorService) SetConsumerLagTracking(groups []string, threshold int64) {
+	s.lagGroups = groups
+	s.lagThreshold = threshold
+}
+
 // запускает мониторинг системы каждую минуту
 func (s *MonitorService) StartMonitoring(ctx context.Context) {
 	ticker := time.NewTicker(1 * time.Minute)
@@ -67,10 +84,19 @@ func (s *MonitorService) StartMonitoring(ctx context.Context) {
 func (s *MonitorService) recordSystemMetrics(ctx context.Context) {
 	start := time.Now()
 
-	// Проверяем состояние всех компонентов системы
-	kafkaStatus := s.checkKafkaHealth(ctx)
+	// Проверяем состояние всех компонентов системы; отчет Kafka сохраняется
+	// только здесь, чтобы запросы GetHealth не добавляли строки в health_checks
+	kafkaState, kafkaReport := s.checkKafkaHealth(ctx)
+	s.saveHealthReport(kafkaReport)
 	redisStatus := s.checkRedisHealth(ctx)
 	postgresStatus := s.checkPostgresHealth(ctx)
+	lagStatus := s.checkConsumerLag(ctx)
+
+	// В транзакции деградировавший, но доступный кластер считается рабочим
+	kafkaStatus := kafkaState
+	if kafkaStatus == StatusDegraded {
+		kafkaStatus = models.StatusOK
+	}
 
 	// Создаем транзакцию с результатами мониторинга
 	transaction := &models.Transaction{
@@ -92,19 +118,113 @@ func (s *MonitorService) recordSystemMetrics(ctx context.Context) {
 	monitoring.TransactionsTotal.WithLabelValues(models.ServiceMonitor, kafkaStatus, redisStatus).Inc()
 
 	s.logger.WithFields(logrus.Fields{
-		"kafka_status":    kafkaStatus,
+		"kafka_status":    kafkaState,
 		"redis_status":    redisStatus,
 		"postgres_status": postgresStatus,
+		"lag_status":      lagStatus,
 		"duration_ms":     time.Since(start).Milliseconds(),
 	}).Info("System metrics recorded")
 }
 
-// проверяет состояние Kafka
-func (s *MonitorService) checkKafkaHealth(ctx context.Context) string {
-	if err := s.kafkaHealth.CheckHealth(ctx); err != nil {
+// проверяет состояние Kafka кластера и возвращает отчет
+func (s *MonitorService) GetKafkaHealth(ctx context.Context) *kafka.HealthReport {
+	report, err := s.kafkaHealth.CheckHealth(ctx)
+	if err != nil {
 		s.logger.WithError(err).Error("Kafka health check failed")
+	} else if report.Status != kafka.HealthStatusHealthy {
+		s.logger.WithFields(logrus.Fields{
+			"status":           report.Status,
+			"under_replicated": len(report.UnderReplicated),
+			"offline":          len(report.Offline),
+			"isr_shrinks":      len(report.ISRShrinks),
+		}).Warn("Kafka cluster is not healthy")
+	}
+
+	return report
+}
+
+// сохраняет отчет о состоянии Kafka в таблицу health_checks
+func (s *MonitorService) saveHealthReport(report *kafka.HealthReport) {
+	details, err := json.Marshal(report)
+	if err != nil {
+		s.logger.WithError(err).Error("Failed to marshal Kafka health report")
+		return
+	}
+
+	check := &models.HealthCheck{
+		ServiceName:  "kafka",
+		Status:       report.Status,
+		ResponseTime: report.Duration.Milliseconds(),
+		ErrorMsg:     strings.Join(report.Errors, "; "),
+		Details:      details,
+		Timestamp:    report.CheckedAt,
+	}
+	if err := s.postgresClient.InsertHealthCheck(check); err != nil {
+		s.logger.WithError(err).Error("Failed to save Kafka health report")
+	}
+}
+
+// проверяет состояние Kafka; доступный кластер с проблемами репликации - degraded
+func (s *MonitorService) checkKafkaHealth(ctx context.Context) (string, *kafka.HealthReport) {
+	report := s.GetKafkaHealth(ctx)
+	switch report.Status {
+	case kafka.HealthStatusHealthy:
+		return models.StatusOK, report
+	case kafka.HealthStatusDegraded:
+		return StatusDegraded, report
+	default:
+		return models.StatusBad, report
+	}
+}
+
+// возвращает отставание отслеживаемых consumer groups и обновляет метрики
+func (s *MonitorService) GetConsumerLag(ctx context.Context, groups []string) ([]*kafka.ConsumerGroupLag, error) {
+	if len(groups) == 0 {
+		groups = s.lagGroups
+	}
+
+	lags, err := s.kafkaHealth.ConsumerLag(ctx, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, groupLag := range lags {
+		monitoring.KafkaConsumerGroupLag.WithLabelValues(groupLag.Group).Set(float64(groupLag.TotalLag))
+		for _, partition := range groupLag.Partitions {
+			monitoring.KafkaConsumerLag.WithLabelValues(groupLag.Group, partition.Topic, strconv.FormatInt(int64(partition.Partition), 10)).Set(float64(partition.Lag))
+		}
+	}
+
+	return lags, nil
+}
+
+// проверяет, превышает ли отставание группы порог
+func (s *MonitorService) IsLagDegraded(groupLag *kafka.ConsumerGroupLag) bool {
+	return s.lagThreshold > 0 && groupLag.TotalLag > s.lagThreshold
+}
+
+// проверяет отставание consumer groups; пустая строка, если отслеживание выключено
+func (s *MonitorService) checkConsumerLag(ctx context.Context) string {
+	if len(s.lagGroups) == 0 {
+		return ""
+	}
+
+	lags, err := s.GetConsumerLag(ctx, nil)
+	if err != nil {
+		s.logger.WithError(err).Error("Consumer lag check failed")
 		return models.StatusBad
 	}
+
+	for _, groupLag := range lags {
+		if s.IsLagDegraded(groupLag) {
+			s.logger.WithFields(logrus.Fields{
+				"group":     groupLag.Group,
+				"lag":       groupLag.TotalLag,
+				"threshold": s.lagThreshold,
+			}).Warn("Consumer group lag exceeds threshold")
+			return StatusDegraded
+		}
+	}
 	return models.StatusOK
 }
 
@@ -128,23 +248,32 @@ func (s *MonitorService) checkPostgresHealth(ctx context.Context) string {
 
 // возвращает общее состояние системы
 func (s *MonitorService) GetSystemHealth(ctx context.Context) map[string]interface{} {
-	kafkaStatus := s.checkKafkaHealth(ctx)
+	kafkaStatus, kafkaReport := s.checkKafkaHealth(ctx)
 	redisStatus := s.checkRedisHealth(ctx)
 	postgresStatus := s.checkPostgresHealth(ctx)
+	lagStatus := s.checkConsumerLag(ctx)
 
 	overallStatus := "healthy"
 	if kafkaStatus == models.StatusBad || redisStatus == models.StatusBad || postgresStatus == models.StatusBad {
 		overallStatus = "unhealthy"
+	} else if lagStatus == StatusDegraded || kafkaStatus == StatusDegraded {
+		overallStatus = StatusDegraded
+	}
+
+	services := map[string]string{
+		"kafka":    kafkaStatus,
+		"redis":    redisStatus,
+		"postgres": postgresStatus,
+	}
+	if lagStatus != "" {
+		services["consumer_lag"] = lagStatus
 	}
 
 	return map[string]interface{}{
 		"overall_status": overallStatus,
-		"services": map[string]string{
-			"kafka":    kafkaStatus,
-			"redis":    redisStatus,
-			"postgres": postgresStatus,
-		},
-		"timestamp": time.Now().Format(time.RFC3339),
+		"services":       services,
+		"kafka_report":   kafkaReport,
+		"timestamp":      time.Now().Format(time.RFC3339),
 	}
 }
 
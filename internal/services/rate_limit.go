@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"pet-proj/internal/models"
+	"pet-proj/pkg/monitoring"
+	"pet-proj/pkg/redis"
+)
+
+// ключи, по которым считается квота отправки событий
+const (
+	RateLimitByUser   = "user"
+	RateLimitBySource = "source"
+	RateLimitByClient = "client"
+)
+
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// квота: не больше Limit событий за Window на одно значение ключа KeyBy;
+// пустой EventType - квота на события любого типа
+type RateLimitRule struct {
+	KeyBy     string
+	EventType string
+	Limit     int
+	Window    time.Duration
+}
+
+// событие отклонено квотой; RetryAfter - время до ее освобождения
+type RateLimitError struct {
+	KeyBy      string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded for %s, retry after %s", e.KeyBy, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error { return ErrRateLimited }
+
+type clientIDKey struct{}
+
+// сохраняет в контексте идентификатор API клиента для квот по client
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	if clientID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, clientIDKey{}, clientID)
+}
+
+// возвращает идентификатор API клиента из контекста или пустую строку
+func ClientIDFromContext(ctx context.Context) string {
+	clientID, _ := ctx.Value(clientIDKey{}).(string)
+	return clientID
+}
+
+// включает ограничение частоты отправки событий по правилам rules
+func (s *EventService) SetRateLimits(limiter redis.RateLimiterInterface, rules []RateLimitRule) error {
+	for _, rule := range rules {
+		switch rule.KeyBy {
+		case RateLimitByUser, RateLimitBySource, RateLimitByClient:
+		default:
+			return fmt.Errorf("unknown rate limit key %q", rule.KeyBy)
+		}
+		if rule.Limit <= 0 || rule.Window <= 0 {
+			return fmt.Errorf("rate limit for %s must have positive limit and window", rule.KeyBy)
+		}
+	}
+
+	s.limiter = limiter
+	s.rateLimits = rules
+	return nil
+}
+
+// проверяет все подходящие событию квоты и учитывает событие, только если ни одна
+// не превышена; при недоступном Redis событие пропускается
+func (s *EventService) checkRateLimits(ctx context.Context, event *models.Event) error {
+	if s.limiter == nil {
+		return nil
+	}
+
+	rules, limits := s.rateLimitsFor(ctx, event)
+	if len(limits) == 0 {
+		return nil
+	}
+
+	rejected, retryAfter, err := s.limiter.Allow(ctx, limits)
+	if err != nil {
+		s.logger.WithError(err).Warn("Rate limit check failed, event allowed")
+		return nil
+	}
+	if rejected < 0 {
+		return nil
+	}
+
+	rule := rules[rejected]
+	monitoring.EventsRateLimitedTotal.WithLabelValues(rule.KeyBy, ruleEventType(rule)).Inc()
+	return &RateLimitError{KeyBy: rule.KeyBy, RetryAfter: retryAfter}
+}
+
+// возвращает правила, подходящие событию, и квоты по значениям их ключей;
+// правило без значения ключа (например, без ID клиента) не применяется
+func (s *EventService) rateLimitsFor(ctx context.Context, event *models.Event) ([]RateLimitRule, []redis.RateLimit) {
+	var rules []RateLimitRule
+	var limits []redis.RateLimit
+	for _, rule := range s.rateLimits {
+		if rule.EventType != "" && rule.EventType != event.Type {
+			continue
+		}
+
+		var value string
+		switch rule.KeyBy {
+		case RateLimitByUser:
+			value = event.UserID
+		case RateLimitBySource:
+			value = event.Source
+		case RateLimitByClient:
+			value = ClientIDFromContext(ctx)
+		}
+		if value == "" {
+			continue
+		}
+
+		rules = append(rules, rule)
+		limits = append(limits, redis.RateLimit{
+			Key:    rule.KeyBy + ":" + ruleEventType(rule) + ":" + value,
+			Limit:  rule.Limit,
+			Window: rule.Window,
+		})
+	}
+	return rules, limits
+}
+
+// возвращает тип события правила для ключа квоты и метрики; "*" - любой тип
+func ruleEventType(rule RateLimitRule) string {
+	if rule.EventType == "" {
+		return "*"
+	}
+	return rule.EventType
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/internal/models"
+	"pet-proj/pkg/redis"
+)
+
+// запоминает квоты последнего вызова и возвращает заданный результат
+type fakeLimiter struct {
+	limits     []redis.RateLimit
+	rejected   int
+	retryAfter time.Duration
+	err        error
+}
+
+func (l *fakeLimiter) Allow(ctx context.Context, limits []redis.RateLimit) (int, time.Duration, error) {
+	l.limits = limits
+	return l.rejected, l.retryAfter, l.err
+}
+
+func TestCheckRateLimits(t *testing.T) {
+	rules := []RateLimitRule{
+		{KeyBy: RateLimitByUser, Limit: 10, Window: time.Minute},
+		{KeyBy: RateLimitBySource, EventType: models.EventTypeSystemMetric, Limit: 100, Window: time.Second},
+		{KeyBy: RateLimitByClient, Limit: 5, Window: time.Minute},
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		clientID  string
+		limiter   *fakeLimiter
+		wantKeys  []string
+		wantErr   *RateLimitError
+	}{
+		{
+			name:      "AnyTypeRulesOnly",
+			eventType: models.EventTypeUserAction,
+			clientID:  "mobile",
+			limiter:   &fakeLimiter{rejected: -1},
+			wantKeys:  []string{"user:*:user_1", "client:*:mobile"},
+		},
+		{
+			name:      "TypedRuleMatches",
+			eventType: models.EventTypeSystemMetric,
+			clientID:  "mobile",
+			limiter:   &fakeLimiter{rejected: -1},
+			wantKeys:  []string{"user:*:user_1", "source:system_metric:producer", "client:*:mobile"},
+		},
+		{
+			name:      "NoClientID",
+			eventType: models.EventTypeUserAction,
+			limiter:   &fakeLimiter{rejected: -1},
+			wantKeys:  []string{"user:*:user_1"},
+		},
+		{
+			name:      "RejectedByLaterRule",
+			eventType: models.EventTypeSystemMetric,
+			clientID:  "mobile",
+			limiter:   &fakeLimiter{rejected: 2, retryAfter: 3 * time.Second},
+			wantKeys:  []string{"user:*:user_1", "source:system_metric:producer", "client:*:mobile"},
+			wantErr:   &RateLimitError{KeyBy: RateLimitByClient, RetryAfter: 3 * time.Second},
+		},
+		{
+			name:      "LimiterErrorFailsOpen",
+			eventType: models.EventTypeUserAction,
+			limiter:   &fakeLimiter{rejected: -1, err: errors.New("redis unavailable")},
+			wantKeys:  []string{"user:*:user_1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(nil, nil, testLogger())
+			require.NoError(t, service.SetRateLimits(tt.limiter, rules))
+
+			event := models.NewEvent(tt.eventType, "user_1", models.SourceProducer, nil)
+			err := service.checkRateLimits(WithClientID(context.Background(), tt.clientID), event)
+
+			keys := make([]string, 0, len(tt.limiter.limits))
+			for _, limit := range tt.limiter.limits {
+				keys = append(keys, limit.Key)
+			}
+			assert.Equal(t, tt.wantKeys, keys)
+
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var limitErr *RateLimitError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, tt.wantErr, limitErr)
+			assert.ErrorIs(t, err, ErrRateLimited)
+		})
+	}
+}
+
+func TestSetRateLimitsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    RateLimitRule
+		wantErr bool
+	}{
+		{name: "Valid", rule: RateLimitRule{KeyBy: RateLimitByUser, Limit: 1, Window: time.Second}},
+		{name: "UnknownKey", rule: RateLimitRule{KeyBy: "ip", Limit: 1, Window: time.Second}, wantErr: true},
+		{name: "ZeroLimit", rule: RateLimitRule{KeyBy: RateLimitByUser, Window: time.Second}, wantErr: true},
+		{name: "ZeroWindow", rule: RateLimitRule{KeyBy: RateLimitByUser, Limit: 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := NewEventService(nil, nil, testLogger())
+			err := service.SetRateLimits(&fakeLimiter{}, []RateLimitRule{tt.rule})
+			assert.Equal(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
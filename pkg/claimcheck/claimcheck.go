@@ -0,0 +1,56 @@
+package claimcheck
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrPayloadNotFound  = errors.New("payload not found")
+	ErrPayloadCorrupted = errors.New("payload does not match its reference")
+)
+
+// ссылки на payload содержат алгоритм хэширования и хэш содержимого
+const refPrefix = "sha256:"
+
+// хранилище крупных payload; ключ - хэш содержимого, поэтому одинаковые
+// payload хранятся один раз
+type Store interface {
+	Put(ctx context.Context, key string, payload []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+}
+
+// сохраняет payload в хранилище и возвращает ссылку на него
+func Offload(ctx context.Context, store Store, payload []byte) (string, error) {
+	sum := sha256.Sum256(payload)
+	key := hex.EncodeToString(sum[:])
+
+	if err := store.Put(ctx, key, payload); err != nil {
+		return "", fmt.Errorf("failed to store payload: %w", err)
+	}
+	return refPrefix + key, nil
+}
+
+// загружает payload по ссылке и проверяет, что содержимое совпадает с хэшем
+func Resolve(ctx context.Context, store Store, ref string) ([]byte, error) {
+	// Ключ из сообщения используется в пути файла, поэтому принимаем только хэш
+	key, ok := strings.CutPrefix(ref, refPrefix)
+	if decoded, err := hex.DecodeString(key); !ok || err != nil || len(decoded) != sha256.Size {
+		return nil, fmt.Errorf("unsupported payload reference %q", ref)
+	}
+
+	payload, err := store.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(payload)
+	if hex.EncodeToString(sum[:]) != key {
+		return nil, fmt.Errorf("%w: %s", ErrPayloadCorrupted, ref)
+	}
+	return payload, nil
+}
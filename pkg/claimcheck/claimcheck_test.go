@@ -0,0 +1,130 @@
+package claimcheck
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffloadResolve(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFileStore(t.TempDir())
+	require.NoError(t, err)
+
+	payload := []byte(`{"data":"` + strings.Repeat("x", 1024) + `"}`)
+	ref, err := Offload(ctx, store, payload)
+	require.NoError(t, err)
+	assert.Equal(t, refPrefix+hashOf(payload), ref)
+
+	// The same payload gets the same reference
+	again, err := Offload(ctx, store, payload)
+	require.NoError(t, err)
+	assert.Equal(t, ref, again)
+
+	resolved, err := Resolve(ctx, store, ref)
+	require.NoError(t, err)
+	assert.Equal(t, payload, resolved)
+}
+
+func TestResolveReferenceValidation(t *testing.T) {
+	key := hashOf([]byte("payload"))
+
+	tests := []struct {
+		name string
+		ref  string
+	}{
+		{name: "NoPrefix", ref: key},
+		{name: "OtherAlgorithm", ref: "md5:" + key},
+		{name: "PathTraversal", ref: refPrefix + "../../etc/passwd"},
+		{name: "AbsolutePath", ref: refPrefix + "/etc/passwd"},
+		{name: "NotHex", ref: refPrefix + strings.Repeat("z", 64)},
+		{name: "ShortHash", ref: refPrefix + key[:32]},
+		{name: "LongHash", ref: refPrefix + key + "00"},
+		{name: "Empty", ref: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordingStore{}
+			_, err := Resolve(context.Background(), store, tt.ref)
+			assert.ErrorContains(t, err, "unsupported payload reference")
+			assert.Empty(t, store.gets, "invalid reference must not reach the store")
+		})
+	}
+}
+
+func TestResolveCorrupted(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	require.NoError(t, err)
+
+	ref, err := Offload(ctx, store, []byte("original"))
+	require.NoError(t, err)
+	key := strings.TrimPrefix(ref, refPrefix)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, key[:2], key), []byte("tampered"), 0o644))
+
+	_, err = Resolve(ctx, store, ref)
+	assert.ErrorIs(t, err, ErrPayloadCorrupted)
+}
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	store, err := NewFileStore(filepath.Join(dir, "payloads"))
+	require.NoError(t, err)
+
+	key := hashOf([]byte("first"))
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := store.Get(ctx, key)
+		assert.ErrorIs(t, err, ErrPayloadNotFound)
+	})
+
+	t.Run("PutGet", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, key, []byte("first")))
+		payload, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("first"), payload)
+
+		// The file lands in a subdirectory named after the hash prefix,
+		// without leftover temporary files
+		entries, err := os.ReadDir(filepath.Join(dir, "payloads", key[:2]))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, key, entries[0].Name())
+	})
+
+	t.Run("ExistingFileKept", func(t *testing.T) {
+		require.NoError(t, store.Put(ctx, key, []byte("second")))
+		payload, err := store.Get(ctx, key)
+		require.NoError(t, err)
+		assert.Equal(t, []byte("first"), payload)
+	})
+}
+
+func hashOf(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// запоминает запрошенные ключи
+type recordingStore struct {
+	gets []string
+}
+
+func (s *recordingStore) Put(ctx context.Context, key string, payload []byte) error {
+	return nil
+}
+
+func (s *recordingStore) Get(ctx context.Context, key string) ([]byte, error) {
+	s.gets = append(s.gets, key)
+	return nil, ErrPayloadNotFound
+}
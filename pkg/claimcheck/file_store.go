@@ -0,0 +1,67 @@
+package claimcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// хранит payload в файлах локального или общего каталога; producer и consumer
+// должны видеть один и тот же каталог
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create payload directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (s *FileStore) Put(ctx context.Context, key string, payload []byte) error {
+	path := s.path(key)
+	// Содержимое определяется ключом, поэтому существующий файл не перезаписываем
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	// Пишем во временный файл и переименовываем, чтобы читатель не увидел файл частично
+	tmp, err := os.CreateTemp(filepath.Dir(path), key+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(payload); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	payload, err := os.ReadFile(s.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrPayloadNotFound
+	}
+	return payload, err
+}
+
+// раскладывает файлы по подкаталогам из первых символов хэша
+func (s *FileStore) path(key string) string {
+	if len(key) < 2 {
+		return filepath.Join(s.dir, key)
+	}
+	return filepath.Join(s.dir, key[:2], key)
+}
@@ -0,0 +1,47 @@
+package claimcheck
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+
+	"pet-proj/pkg/redis"
+)
+
+// хранит payload в Redis с TTL; payload должен быть JSON документом
+type RedisStore struct {
+	client redis.ClientInterface
+	ttl    time.Duration
+}
+
+// ttl должен покрывать время, за которое сообщение может быть обработано,
+// включая retry и dead-letter топики
+func NewRedisStore(client redis.ClientInterface, ttl time.Duration) *RedisStore {
+	return &RedisStore{
+		client: client,
+		ttl:    ttl,
+	}
+}
+
+func (s *RedisStore) Put(ctx context.Context, key string, payload []byte) error {
+	// RawMessage сохраняется как есть, без повторного кодирования
+	return s.client.Set(ctx, redisKey(key), json.RawMessage(payload), s.ttl)
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, error) {
+	var payload json.RawMessage
+	if err := s.client.Get(ctx, redisKey(key), &payload); err != nil {
+		if errors.Is(err, goredis.Nil) {
+			return nil, ErrPayloadNotFound
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+func redisKey(key string) string {
+	return "payload:" + key
+}
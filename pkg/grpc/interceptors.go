@@ -9,6 +9,8 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+
+	"pet-proj/pkg/kafka"
 )
 
 // LoggingInterceptor логирует все gRPC запросы
@@ -140,13 +142,21 @@ func RequestIDInterceptor() grpc.UnaryServerInterceptor {
 		}
 
 		ctx = metadata.NewIncomingContext(ctx, md)
+		// Request ID и trace context передаются дальше в заголовках сообщений Kafka
+		ctx = kafka.WithRequestID(ctx, requestID)
+		ctx = kafka.WithTraceContext(ctx, firstValue(md, "traceparent"), firstValue(md, "tracestate"))
 		return handler(ctx, req)
 	}
 }
 
 // getRequestID извлекает request ID из метаданных
 func getRequestID(md metadata.MD) string {
-	if values := md.Get("x-request-id"); len(values) > 0 {
+	return firstValue(md, "x-request-id")
+}
+
+// firstValue возвращает первое значение ключа метаданных
+func firstValue(md metadata.MD, key string) string {
+	if values := md.Get(key); len(values) > 0 {
 		return values[0]
 	}
 	return ""
@@ -0,0 +1,194 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrProducerClosed                = errors.New("kafka producer is closed")
+	ErrAsyncTransactionalUnsupported = errors.New("transactions are not supported by the async producer")
+)
+
+// результат доставки одного сообщения
+type DeliveryResult struct {
+	Topic     string
+	Partition int32
+	Offset    int64
+	Err       error
+}
+
+// future для результата доставки сообщения асинхронным producer
+type DeliveryFuture struct {
+	done   chan struct{}
+	result DeliveryResult
+}
+
+func newDeliveryFuture() *DeliveryFuture {
+	return &DeliveryFuture{done: make(chan struct{})}
+}
+
+func (f *DeliveryFuture) resolve(result DeliveryResult) {
+	f.result = result
+	close(f.done)
+}
+
+// закрывается, когда результат доставки известен
+func (f *DeliveryFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// ждет результат доставки или отмену контекста
+func (f *DeliveryFuture) Wait(ctx context.Context) (DeliveryResult, error) {
+	select {
+	case <-f.done:
+		return f.result, f.result.Err
+	case <-ctx.Done():
+		return DeliveryResult{}, ctx.Err()
+	}
+}
+
+// отправляет сообщения пачками через sarama.AsyncProducer; каждый вызов
+// получает свой результат доставки через DeliveryFuture
+type AsyncProducer struct {
+	producer sarama.AsyncProducer
+	topic    string
+	codecs   *TopicCodecs
+	logger   *logrus.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewAsyncProducer(config *ProducerConfig) (*AsyncProducer, error) {
+	// Пачки из разных вызовов нельзя атомарно закоммитить по отдельности,
+	// поэтому асинхронный режим поддерживает только идемпотентность
+	if config.TransactionalID != "" {
+		return nil, ErrAsyncTransactionalUnsupported
+	}
+
+	saramaConfig, err := config.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Producer.Flush.Messages = config.BatchSize
+	saramaConfig.Producer.Flush.Bytes = config.BatchBytes
+	saramaConfig.Producer.Flush.Frequency = config.Linger
+
+	producer, err := sarama.NewAsyncProducer(config.Brokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &AsyncProducer{
+		producer: producer,
+		topic:    config.Topic,
+		codecs:   config.Codecs,
+		logger:   config.Logger,
+	}
+
+	p.wg.Add(2)
+	go p.handleSuccesses()
+	go p.handleErrors()
+
+	return p, nil
+}
+
+// ставит сообщение в очередь на отправку и сразу возвращает future
+func (p *AsyncProducer) SendMessageAsync(ctx context.Context, key string, value interface{}) *DeliveryFuture {
+	return p.SendMessageToTopicAsync(ctx, p.topic, key, value)
+}
+
+// ставит сообщение в очередь на отправку в указанный топик и сразу возвращает future
+func (p *AsyncProducer) SendMessageToTopicAsync(ctx context.Context, topic, key string, value interface{}) *DeliveryFuture {
+	future := newDeliveryFuture()
+
+	msg, err := NewProducerMessage(ctx, p.codecs.ForTopic(topic), topic, key, value)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to marshal message")
+		future.resolve(DeliveryResult{Topic: topic, Err: err})
+		return future
+	}
+	msg.Metadata = future
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		future.resolve(DeliveryResult{Topic: topic, Err: ErrProducerClosed})
+		return future
+	}
+
+	select {
+	case p.producer.Input() <- msg:
+	case <-ctx.Done():
+		future.resolve(DeliveryResult{Topic: topic, Err: ctx.Err()})
+	}
+
+	return future
+}
+
+func (p *AsyncProducer) Topic() string {
+	return p.topic
+}
+
+// отправляет сообщение и ждет подтверждения доставки
+func (p *AsyncProducer) SendMessage(ctx context.Context, key string, value interface{}) error {
+	return p.SendMessageToTopic(ctx, p.topic, key, value)
+}
+
+// отправляет сообщение в указанный топик и ждет подтверждения доставки
+func (p *AsyncProducer) SendMessageToTopic(ctx context.Context, topic, key string, value interface{}) error {
+	result, err := p.SendMessageToTopicAsync(ctx, topic, key, value).Wait(ctx)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to send message to Kafka")
+		return err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"topic":     result.Topic,
+		"partition": result.Partition,
+		"offset":    result.Offset,
+		"key":       key,
+	}).Debug("Message sent to Kafka successfully")
+
+	return nil
+}
+
+func (p *AsyncProducer) handleSuccesses() {
+	defer p.wg.Done()
+	for msg := range p.producer.Successes() {
+		if future, ok := msg.Metadata.(*DeliveryFuture); ok {
+			future.resolve(DeliveryResult{Topic: msg.Topic, Partition: msg.Partition, Offset: msg.Offset})
+		}
+	}
+}
+
+func (p *AsyncProducer) handleErrors() {
+	defer p.wg.Done()
+	for producerErr := range p.producer.Errors() {
+		if future, ok := producerErr.Msg.Metadata.(*DeliveryFuture); ok {
+			future.resolve(DeliveryResult{Topic: producerErr.Msg.Topic, Err: producerErr.Err})
+		}
+	}
+}
+
+// дожидается отправки накопленных сообщений и закрывает producer
+func (p *AsyncProducer) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	p.producer.AsyncClose()
+	p.wg.Wait()
+	return nil
+}
@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/Shopify/sarama"
+	"google.golang.org/protobuf/proto"
+)
+
+// заголовок с форматом тела сообщения
+const HeaderContentType = "content-type"
+
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+// имена кодеков в конфигурации
+const (
+	CodecJSON     = "json"
+	CodecProtobuf = "protobuf"
+)
+
+// кодирует и декодирует тело сообщения в одном формате
+type Codec interface {
+	ContentType() string
+	Marshal(value interface{}) ([]byte, error)
+	Unmarshal(data []byte, value interface{}) error
+}
+
+// значение, которое умеет кодировать себя в protobuf, например через
+// конвертацию в сгенерированное сообщение
+type ProtoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// значение, которое умеет заполнить себя из protobuf
+type ProtoUnmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) ContentType() string { return ContentTypeJSON }
+
+func (jsonCodec) Marshal(value interface{}) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec) Unmarshal(data []byte, value interface{}) error {
+	return json.Unmarshal(data, value)
+}
+
+type protobufCodec struct{}
+
+func (protobufCodec) ContentType() string { return ContentTypeProtobuf }
+
+func (protobufCodec) Marshal(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case proto.Message:
+		return proto.Marshal(v)
+	case ProtoMarshaler:
+		return v.MarshalProto()
+	default:
+		return nil, fmt.Errorf("type %T cannot be encoded as protobuf", value)
+	}
+}
+
+func (protobufCodec) Unmarshal(data []byte, value interface{}) error {
+	switch v := value.(type) {
+	case proto.Message:
+		return proto.Unmarshal(data, v)
+	case ProtoUnmarshaler:
+		return v.UnmarshalProto(data)
+	default:
+		return fmt.Errorf("type %T cannot be decoded from protobuf", value)
+	}
+}
+
+var (
+	JSONCodec     Codec = jsonCodec{}
+	ProtobufCodec Codec = protobufCodec{}
+)
+
+// возвращает кодек по имени из конфигурации
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "", CodecJSON:
+		return JSONCodec, nil
+	case CodecProtobuf:
+		return ProtobufCodec, nil
+	default:
+		return nil, fmt.Errorf("unknown codec: %s", name)
+	}
+}
+
+// возвращает кодек по заголовку content-type; сообщения без заголовка
+// записаны до появления кодеков и считаются JSON
+func CodecByContentType(contentType string) (Codec, error) {
+	switch contentType {
+	case "", ContentTypeJSON:
+		return JSONCodec, nil
+	case ContentTypeProtobuf:
+		return ProtobufCodec, nil
+	default:
+		return nil, fmt.Errorf("unsupported content type: %s", contentType)
+	}
+}
+
+// выбирает кодек для топика; топики без настройки используют кодек по умолчанию
+type TopicCodecs struct {
+	defaultCodec Codec
+	byTopic      map[string]Codec
+}
+
+func NewTopicCodecs(defaultName string, byTopic map[string]string) (*TopicCodecs, error) {
+	defaultCodec, err := CodecByName(defaultName)
+	if err != nil {
+		return nil, err
+	}
+
+	codecs := &TopicCodecs{
+		defaultCodec: defaultCodec,
+		byTopic:      make(map[string]Codec, len(byTopic)),
+	}
+	for topic, name := range byTopic {
+		codec, err := CodecByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic, err)
+		}
+		codecs.byTopic[topic] = codec
+	}
+
+	return codecs, nil
+}
+
+// возвращает кодек для топика
+func (c *TopicCodecs) ForTopic(topic string) Codec {
+	if c == nil {
+		return JSONCodec
+	}
+	if codec, ok := c.byTopic[topic]; ok {
+		return codec
+	}
+	return c.defaultCodec
+}
+
+// декодирует тело сообщения кодеком из заголовка content-type
+func DecodeMessage(message *sarama.ConsumerMessage, value interface{}) error {
+	codec, err := CodecByContentType(headerValue(message.Headers, HeaderContentType))
+	if err != nil {
+		return err
+	}
+	return codec.Unmarshal(message.Value, value)
+}
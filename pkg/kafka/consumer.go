@@ -2,27 +2,108 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/sirupsen/logrus"
 )
 
+// режимы доставки сообщений consumer group
+const (
+	// Неудачное сообщение уходит в retry или dead-letter топик, смещение сдвигается
+	DeliveryModeForward = "forward"
+	// Смещение сдвигается только после успешной обработки; партиция
+	// приостанавливается и сообщение обрабатывается повторно с backoff
+	DeliveryModeAtLeastOnce = "at-least-once"
+)
+
 type Consumer struct {
-	consumer sarama.ConsumerGroup
-	topic    string
-	logger   *logrus.Logger
-	handler  MessageHandler
+	consumer     sarama.ConsumerGroup
+	topics       []string
+	logger       *logrus.Logger
+	handler      MessageHandler
+	deadLetters  DeadLetterQueueInterface
+	retry        *RetryTopics
+	delayed      bool
+	deliveryMode string
+	backoff      time.Duration
+	maxBackoff   time.Duration
+
+	workers        int
+	queueDepth     int
+	messageTimeout time.Duration
+
+	// число активных приостановок партиций: воркеры одной партиции
+	// могут приостанавливать ее одновременно
+	pauseMu sync.Mutex
+	pauses  map[string]map[int32]int
+
+	// приостановки администратора и партиции текущей сессии
+	pausedAll   bool
+	adminPaused map[string]map[int32]bool
+	assigned    map[string][]int32
 }
 
 type MessageHandler interface {
 	HandleMessage(ctx context.Context, message *sarama.ConsumerMessage) error
 }
 
-func NewConsumer(brokers []string, topic, groupID string, logger *logrus.Logger) (*Consumer, error) {
-	config := sarama.NewConfig()
+// ошибка, которую бессмысленно повторять, например невалидное сообщение
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// помечает ошибку обработки как постоянную: сообщение не обрабатывается
+// повторно в режиме at-least-once, а сразу перекладывается дальше
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// проверяет, помечена ли ошибка как постоянная
+func IsPermanent(err error) bool {
+	var permanent *permanentError
+	return errors.As(err, &permanent)
+}
+
+func NewConsumer(brokers []string, security *SecurityConfig, topics []string, groupID string, logger *logrus.Logger) (*Consumer, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("at least one topic is required")
+	}
+	return newConsumer(brokers, security, topics, groupID, sarama.OffsetNewest, logger)
+}
+
+// создает consumer для retry топиков, который обрабатывает сообщение только после
+// истечения его задержки; неудачные попытки отправляются на следующую ступень
+func NewRetryConsumer(brokers []string, security *SecurityConfig, retry *RetryTopics, groupID string, logger *logrus.Logger) (*Consumer, error) {
+	consumer, err := newConsumer(brokers, security, retry.Topics(), groupID, sarama.OffsetOldest, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	consumer.retry = retry
+	consumer.delayed = true
+	return consumer, nil
+}
+
+func newConsumer(brokers []string, security *SecurityConfig, topics []string, groupID string, initialOffset int64, logger *logrus.Logger) (*Consumer, error) {
+	config, err := newSaramaConfig(security)
+	if err != nil {
+		return nil, err
+	}
 	config.Consumer.Group.Rebalance.Strategy = sarama.BalanceStrategyRoundRobin
-	config.Consumer.Offsets.Initial = sarama.OffsetNewest
+	config.Consumer.Offsets.Initial = initialOffset
 	config.Consumer.Return.Errors = true
+	// Читаем только закоммиченные транзакции producer
+	config.Consumer.IsolationLevel = sarama.ReadCommitted
 
 	consumer, err := sarama.NewConsumerGroup(brokers, groupID, config)
 	if err != nil {
@@ -30,9 +111,16 @@ func NewConsumer(brokers []string, topic, groupID string, logger *logrus.Logger)
 	}
 
 	return &Consumer{
-		consumer: consumer,
-		topic:    topic,
-		logger:   logger,
+		consumer:     consumer,
+		topics:       topics,
+		logger:       logger,
+		deliveryMode: DeliveryModeForward,
+		backoff:      100 * time.Millisecond,
+		maxBackoff:   10 * time.Second,
+		workers:      1,
+		queueDepth:   1,
+		pauses:       make(map[string]map[int32]int),
+		adminPaused:  make(map[string]map[int32]bool),
 	}, nil
 }
 
@@ -40,9 +128,53 @@ func (c *Consumer) SetHandler(handler MessageHandler) {
 	c.handler = handler
 }
 
-func (c *Consumer) Start(ctx context.Context) error {
-	topics := []string{c.topic}
+// включает перекладывание необработанных сообщений в dead-letter топик
+func (c *Consumer) SetDeadLetterQueue(deadLetters DeadLetterQueueInterface) {
+	c.deadLetters = deadLetters
+}
 
+// включает повторную обработку через retry топики вместо немедленного dead-letter
+func (c *Consumer) SetRetryTopics(retry *RetryTopics) {
+	c.retry = retry
+}
+
+// задает режим доставки и границы backoff между повторными попытками
+func (c *Consumer) SetDeliveryMode(mode string, backoff, maxBackoff time.Duration) error {
+	switch mode {
+	case DeliveryModeForward, DeliveryModeAtLeastOnce:
+	default:
+		return fmt.Errorf("unknown delivery mode: %s", mode)
+	}
+
+	c.deliveryMode = mode
+	if backoff > 0 {
+		c.backoff = backoff
+	}
+	if maxBackoff > 0 {
+		c.maxBackoff = maxBackoff
+	}
+	if c.maxBackoff < c.backoff {
+		c.maxBackoff = c.backoff
+	}
+	return nil
+}
+
+// включает параллельную обработку сообщений партиции в workers воркерах с
+// очередью queueDepth на каждый; messageTimeout ограничивает одну попытку обработки
+func (c *Consumer) SetWorkerPool(workers, queueDepth int, messageTimeout time.Duration) {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueDepth < 1 {
+		queueDepth = 1
+	}
+
+	c.workers = workers
+	c.queueDepth = queueDepth
+	c.messageTimeout = messageTimeout
+}
+
+func (c *Consumer) Start(ctx context.Context) error {
 	go func() {
 		for err := range c.consumer.Errors() {
 			c.logger.WithError(err).Error("Kafka consumer error")
@@ -54,7 +186,7 @@ func (c *Consumer) Start(ctx context.Context) error {
 		case <-ctx.Done():
 			return ctx.Err()
 		default:
-			err := c.consumer.Consume(ctx, topics, c)
+			err := c.consumer.Consume(ctx, c.topics, c)
 			if err != nil {
 				c.logger.WithError(err).Error("Error from consumer")
 				return err
@@ -63,10 +195,20 @@ func (c *Consumer) Start(ctx context.Context) error {
 	}
 }
 
-func (c *Consumer) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (c *Consumer) Setup(session sarama.ConsumerGroupSession) error {
+	c.assign(session.Claims())
+	return nil
+}
+
 func (c *Consumer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
 
 func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	c.restorePause(claim.Topic(), claim.Partition())
+
+	if c.workers > 1 && c.handler != nil {
+		return c.consumeConcurrently(session, claim)
+	}
+
 	for {
 		select {
 		case message := <-claim.Messages():
@@ -74,10 +216,16 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 				return nil
 			}
 
-			if c.handler != nil {
-				if err := c.handler.HandleMessage(session.Context(), message); err != nil {
-					c.logger.WithError(err).Error("Failed to handle message")
-				}
+			// Сообщения из retry топиков ждут своего времени; при завершении сессии
+			// сообщение не отмечаем, чтобы оно было прочитано снова
+			if c.delayed && !c.waitUntilDue(session.Context(), message) {
+				return nil
+			}
+
+			// Смещение отмечаем только после того, как сообщение обработано
+			// или передано дальше; иначе оно будет прочитано снова
+			if c.handler != nil && !c.handle(session.Context(), message) {
+				return nil
 			}
 
 			session.MarkMessage(message, "")
@@ -88,6 +236,178 @@ func (c *Consumer) ConsumeClaim(session sarama.ConsumerGroupSession, claim saram
 	}
 }
 
+// раздает сообщения партиции воркерам; смещение отмечается по непрерывному
+// префиксу обработанных сообщений, поэтому после перезапуска ничего не теряется
+func (c *Consumer) consumeConcurrently(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	pool := newWorkerPool(c, session, claim)
+	defer pool.close()
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return nil
+			}
+
+			if c.delayed && !c.waitUntilDue(session.Context(), message) {
+				return nil
+			}
+
+			if !pool.dispatch(message) {
+				return nil
+			}
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// ждет наступления времени повтора; возвращает false, если сессия завершилась раньше
+func (c *Consumer) waitUntilDue(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	wait := time.Until(retryDueTime(message))
+	if wait <= 0 {
+		return true
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// обрабатывает сообщение; возвращает false, если сессия завершилась раньше,
+// чем сообщение было обработано или передано дальше
+func (c *Consumer) handle(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	err := c.callHandler(ctx, message)
+	if err == nil {
+		return true
+	}
+	c.logFailure(message, err)
+
+	if c.deliveryMode == DeliveryModeAtLeastOnce && !IsPermanent(err) {
+		return c.redeliver(ctx, message)
+	}
+	return c.forwardFailed(ctx, message, err)
+}
+
+// повторяет обработку сообщения на месте, приостановив чтение его партиции
+func (c *Consumer) redeliver(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	c.pausePartition(message.Topic, message.Partition)
+	defer c.resumePartition(message.Topic, message.Partition)
+
+	c.logger.WithFields(logrus.Fields{
+		"topic":     message.Topic,
+		"partition": message.Partition,
+		"offset":    message.Offset,
+	}).Warn("Partition paused until message is processed")
+
+	return c.withBackoff(ctx, func() error {
+		err := c.callHandler(ctx, message)
+		if err != nil {
+			c.logFailure(message, err)
+		}
+		return err
+	})
+}
+
+// вызывает обработчик с контекстом запроса из заголовков сообщения,
+// ограничивая попытку messageTimeout
+func (c *Consumer) callHandler(ctx context.Context, message *sarama.ConsumerMessage) error {
+	ctx = contextFromHeaders(ctx, message.Headers)
+	if c.messageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.messageTimeout)
+		defer cancel()
+	}
+	return c.handler.HandleMessage(ctx, message)
+}
+
+// приостанавливает чтение партиции
+func (c *Consumer) pausePartition(topic string, partition int32) {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	if c.pauses[topic] == nil {
+		c.pauses[topic] = make(map[int32]int)
+	}
+	c.pauses[topic][partition]++
+	if c.pauses[topic][partition] == 1 {
+		c.consumer.Pause(map[string][]int32{topic: {partition}})
+	}
+}
+
+// возобновляет чтение партиции, когда снята последняя приостановка и
+// партиция не приостановлена администратором
+func (c *Consumer) resumePartition(topic string, partition int32) {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	if c.pauses[topic][partition] == 0 {
+		return
+	}
+	c.pauses[topic][partition]--
+	if c.pauses[topic][partition] == 0 {
+		delete(c.pauses[topic], partition)
+		if !c.adminPausedLocked(topic, partition) {
+			c.consumer.Resume(map[string][]int32{topic: {partition}})
+		}
+	}
+}
+
+// отправляет необработанное сообщение в retry или dead-letter топик, повторяя
+// попытки пока сессия активна; возвращает false, если сессия завершилась раньше
+func (c *Consumer) forwardFailed(ctx context.Context, message *sarama.ConsumerMessage, cause error) bool {
+	var forward func(ctx context.Context, message *sarama.ConsumerMessage, cause error) error
+	switch {
+	case c.retry != nil:
+		forward = c.retry.Forward
+	case c.deadLetters != nil:
+		forward = c.deadLetters.Publish
+	default:
+		return true
+	}
+
+	return c.withBackoff(ctx, func() error {
+		return forward(ctx, message, cause)
+	})
+}
+
+// выполняет операцию до первого успеха с экспоненциальной задержкой между
+// попытками; возвращает false, если контекст завершился раньше
+func (c *Consumer) withBackoff(ctx context.Context, operation func() error) bool {
+	backoff := c.backoff
+	for {
+		if err := operation(); err == nil {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > c.maxBackoff {
+			backoff = c.maxBackoff
+		}
+	}
+}
+
+func (c *Consumer) logFailure(message *sarama.ConsumerMessage, err error) {
+	c.logger.WithError(err).WithFields(logrus.Fields{
+		"topic":     message.Topic,
+		"partition": message.Partition,
+		"offset":    message.Offset,
+	}).Error("Failed to handle message")
+}
+
 func (c *Consumer) Close() error {
 	return c.consumer.Close()
 }
@@ -0,0 +1,81 @@
+package kafka
+
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+)
+
+// заголовки, в которых контекст запроса передается от producer к consumer
+const (
+	HeaderRequestID   = "x-request-id"
+	HeaderTraceParent = "traceparent"
+	HeaderTraceState  = "tracestate"
+)
+
+type contextKey string
+
+// значения контекста, которые переносятся через заголовки сообщений
+var propagatedHeaders = []string{HeaderRequestID, HeaderTraceParent, HeaderTraceState}
+
+// сохраняет request ID в контексте; он будет передан в заголовке сообщения
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return withHeaderValue(ctx, HeaderRequestID, requestID)
+}
+
+// возвращает request ID из контекста или пустую строку
+func RequestIDFromContext(ctx context.Context) string {
+	return headerValueFromContext(ctx, HeaderRequestID)
+}
+
+// сохраняет W3C trace context (traceparent и tracestate) в контексте
+func WithTraceContext(ctx context.Context, traceParent, traceState string) context.Context {
+	ctx = withHeaderValue(ctx, HeaderTraceParent, traceParent)
+	return withHeaderValue(ctx, HeaderTraceState, traceState)
+}
+
+// возвращает traceparent и tracestate из контекста
+func TraceContextFromContext(ctx context.Context) (traceParent, traceState string) {
+	return headerValueFromContext(ctx, HeaderTraceParent), headerValueFromContext(ctx, HeaderTraceState)
+}
+
+// возвращает заголовки сообщения со значениями из контекста
+func contextHeaders(ctx context.Context) []sarama.RecordHeader {
+	var headers []sarama.RecordHeader
+	for _, key := range propagatedHeaders {
+		if value := headerValueFromContext(ctx, key); value != "" {
+			headers = append(headers, sarama.RecordHeader{Key: []byte(key), Value: []byte(value)})
+		}
+	}
+	return headers
+}
+
+// восстанавливает в контексте значения из заголовков сообщения
+func contextFromHeaders(ctx context.Context, headers []*sarama.RecordHeader) context.Context {
+	for _, key := range propagatedHeaders {
+		if value := headerValue(headers, key); value != "" {
+			ctx = withHeaderValue(ctx, key, value)
+		}
+	}
+	return ctx
+}
+
+// возвращает контекст обработчика сообщения со значениями из его заголовков
+func ContextFromMessage(ctx context.Context, message *sarama.ConsumerMessage) context.Context {
+	return contextFromHeaders(ctx, message.Headers)
+}
+
+func withHeaderValue(ctx context.Context, key, value string) context.Context {
+	if value == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKey(key), value)
+}
+
+func headerValueFromContext(ctx context.Context, key string) string {
+	if ctx == nil {
+		return ""
+	}
+	value, _ := ctx.Value(contextKey(key)).(string)
+	return value
+}
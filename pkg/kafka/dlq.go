@@ -0,0 +1,301 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrDeadLetterNotFound = errors.New("dead letter message not found")
+
+// сообщение из dead-letter топика вместе с информацией об исходной ошибке
+type DeadLetterMessage struct {
+	Partition         int32     `json:"partition"`
+	Offset            int64     `json:"offset"`
+	Key               string    `json:"key"`
+	Value             []byte    `json:"value"`
+	OriginalTopic     string    `json:"original_topic"`
+	OriginalPartition int32     `json:"original_partition"`
+	OriginalOffset    int64     `json:"original_offset"`
+	Error             string    `json:"error"`
+	Attempt           int       `json:"attempt"`
+	FailedAt          time.Time `json:"failed_at"`
+}
+
+// складывает необработанные сообщения в dead-letter топик и возвращает их обратно
+type DeadLetterQueue struct {
+	client       sarama.Client
+	producer     sarama.SyncProducer
+	consumer     sarama.Consumer
+	topic        string
+	requeueTopic string
+	readTimeout  time.Duration
+	logger       *logrus.Logger
+}
+
+func NewDeadLetterQueue(brokers []string, security *SecurityConfig, topic, requeueTopic string, logger *logrus.Logger) (*DeadLetterQueue, error) {
+	config, err := newSaramaConfig(security)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	config.Producer.Timeout = 10 * time.Second
+	config.Consumer.Return.Errors = true
+
+	client, err := sarama.NewClient(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducerFromClient(client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		producer.Close()
+		client.Close()
+		return nil, err
+	}
+
+	return &DeadLetterQueue{
+		client:       client,
+		producer:     producer,
+		consumer:     consumer,
+		topic:        topic,
+		requeueTopic: requeueTopic,
+		readTimeout:  5 * time.Second,
+		logger:       logger,
+	}, nil
+}
+
+// перекладывает сообщение в dead-letter топик с заголовками об исходной ошибке
+func (q *DeadLetterQueue) Publish(ctx context.Context, message *sarama.ConsumerMessage, cause error) error {
+	msg := &sarama.ProducerMessage{
+		Topic:   q.topic,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: DeadLetterHeaders(message, cause),
+	}
+
+	partition, offset, err := q.producer.SendMessage(msg)
+	if err != nil {
+		q.logger.WithError(err).WithField("topic", q.topic).Error("Failed to publish message to dead-letter topic")
+		return err
+	}
+
+	originalTopic, originalPartition, originalOffset := originOf(message)
+	q.logger.WithError(cause).WithFields(logrus.Fields{
+		"topic":              q.topic,
+		"partition":          partition,
+		"offset":             offset,
+		"original_topic":     originalTopic,
+		"original_partition": originalPartition,
+		"original_offset":    originalOffset,
+		"attempt":            attemptFromHeaders(message.Headers) + 1,
+	}).Warn("Message moved to dead-letter topic")
+
+	return nil
+}
+
+// возвращает последние limit сообщений из dead-letter топика, новые первыми
+func (q *DeadLetterQueue) List(ctx context.Context, limit int) ([]*DeadLetterMessage, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+
+	partitions, err := q.client.Partitions(q.topic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partitions of %s: %w", q.topic, err)
+	}
+
+	var result []*DeadLetterMessage
+	for _, partition := range partitions {
+		oldest, err := q.client.GetOffset(q.topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return nil, err
+		}
+		newest, err := q.client.GetOffset(q.topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return nil, err
+		}
+		if newest <= oldest {
+			continue
+		}
+
+		start := newest - int64(limit)
+		if start < oldest {
+			start = oldest
+		}
+
+		messages, err := q.readRange(ctx, partition, start, newest)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, messages...)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].FailedAt.After(result[j].FailedAt)
+	})
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+// возвращает сообщение из dead-letter топика по партиции и смещению
+func (q *DeadLetterQueue) Get(ctx context.Context, partition int32, offset int64) (*DeadLetterMessage, error) {
+	message, err := q.readRaw(ctx, partition, offset)
+	if err != nil {
+		return nil, err
+	}
+	return toDeadLetterMessage(message), nil
+}
+
+// публикует сообщение из dead-letter топика обратно в исходный топик
+func (q *DeadLetterQueue) Requeue(ctx context.Context, partition int32, offset int64) error {
+	message, err := q.readRaw(ctx, partition, offset)
+	if err != nil {
+		return err
+	}
+
+	topic := headerValue(message.Headers, HeaderOriginalTopic)
+	if topic == "" {
+		topic = q.requeueTopic
+	}
+
+	// Счетчик попыток сохраняем, чтобы повторная ошибка увеличила его
+	msg := &sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: copyHeaders(message.Headers, HeaderError, HeaderFailedAt),
+	}
+
+	if _, _, err := q.producer.SendMessage(msg); err != nil {
+		q.logger.WithError(err).WithField("topic", topic).Error("Failed to requeue dead-letter message")
+		return err
+	}
+
+	q.logger.WithFields(logrus.Fields{
+		"topic":     topic,
+		"partition": partition,
+		"offset":    offset,
+		"attempt":   attemptFromHeaders(message.Headers),
+	}).Info("Dead-letter message requeued")
+
+	return nil
+}
+
+// читает сообщения партиции в диапазоне [from, to)
+func (q *DeadLetterQueue) readRange(ctx context.Context, partition int32, from, to int64) ([]*DeadLetterMessage, error) {
+	pc, err := q.consumer.ConsumePartition(q.topic, partition, from)
+	if err != nil {
+		if errors.Is(err, sarama.ErrOffsetOutOfRange) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+	defer pc.Close()
+
+	var result []*DeadLetterMessage
+	for {
+		select {
+		case message := <-pc.Messages():
+			if message == nil {
+				return result, nil
+			}
+			result = append(result, toDeadLetterMessage(message))
+			if message.Offset+1 >= to {
+				return result, nil
+			}
+		case err := <-pc.Errors():
+			if err != nil {
+				return nil, err
+			}
+		case <-time.After(q.readTimeout):
+			return result, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// читает одно сообщение партиции без преобразования
+func (q *DeadLetterQueue) readRaw(ctx context.Context, partition int32, offset int64) (*sarama.ConsumerMessage, error) {
+	pc, err := q.consumer.ConsumePartition(q.topic, partition, offset)
+	if err != nil {
+		if errors.Is(err, sarama.ErrOffsetOutOfRange) {
+			return nil, ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+	defer pc.Close()
+
+	select {
+	case message := <-pc.Messages():
+		if message == nil || message.Offset != offset {
+			return nil, ErrDeadLetterNotFound
+		}
+		return message, nil
+	case err := <-pc.Errors():
+		return nil, err
+	case <-time.After(q.readTimeout):
+		return nil, ErrDeadLetterNotFound
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *DeadLetterQueue) Close() error {
+	var err error
+	if closeErr := q.consumer.Close(); closeErr != nil {
+		err = closeErr
+	}
+	if closeErr := q.producer.Close(); closeErr != nil {
+		err = closeErr
+	}
+	if closeErr := q.client.Close(); closeErr != nil {
+		err = closeErr
+	}
+	return err
+}
+
+// конвертирует сообщение Kafka в DeadLetterMessage
+func toDeadLetterMessage(message *sarama.ConsumerMessage) *DeadLetterMessage {
+	dl := &DeadLetterMessage{
+		Partition:     message.Partition,
+		Offset:        message.Offset,
+		Key:           string(message.Key),
+		Value:         message.Value,
+		OriginalTopic: headerValue(message.Headers, HeaderOriginalTopic),
+		Error:         headerValue(message.Headers, HeaderError),
+		Attempt:       attemptFromHeaders(message.Headers),
+	}
+
+	if p, err := strconv.ParseInt(headerValue(message.Headers, HeaderOriginalPartition), 10, 32); err == nil {
+		dl.OriginalPartition = int32(p)
+	}
+	if o, err := strconv.ParseInt(headerValue(message.Headers, HeaderOriginalOffset), 10, 64); err == nil {
+		dl.OriginalOffset = o
+	}
+	if t, err := time.Parse(time.RFC3339Nano, headerValue(message.Headers, HeaderFailedAt)); err == nil {
+		dl.FailedAt = t
+	} else {
+		dl.FailedAt = message.Timestamp
+	}
+
+	return dl
+}
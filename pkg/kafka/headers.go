@@ -0,0 +1,92 @@
+package kafka
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// служебные заголовки, которыми помечаются сообщения при перекладывании между топиками
+const (
+	HeaderOriginalTopic     = "x-original-topic"
+	HeaderOriginalPartition = "x-original-partition"
+	HeaderOriginalOffset    = "x-original-offset"
+	HeaderError             = "x-error"
+	HeaderAttempt           = "x-attempt"
+	HeaderFailedAt          = "x-failed-at"
+	HeaderRetryDue          = "x-retry-due"
+)
+
+// возвращает значение заголовка или пустую строку
+func headerValue(headers []*sarama.RecordHeader, key string) string {
+	for _, header := range headers {
+		if header != nil && string(header.Key) == key {
+			return string(header.Value)
+		}
+	}
+	return ""
+}
+
+// возвращает количество неудачных попыток обработки, записанное в заголовках
+func attemptFromHeaders(headers []*sarama.RecordHeader) int {
+	attempt, err := strconv.Atoi(headerValue(headers, HeaderAttempt))
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+// возвращает координаты сообщения в самом первом топике, даже если оно уже перекладывалось
+func originOf(message *sarama.ConsumerMessage) (topic, partition, offset string) {
+	topic = headerValue(message.Headers, HeaderOriginalTopic)
+	if topic != "" {
+		return topic, headerValue(message.Headers, HeaderOriginalPartition), headerValue(message.Headers, HeaderOriginalOffset)
+	}
+	return message.Topic, strconv.FormatInt(int64(message.Partition), 10), strconv.FormatInt(message.Offset, 10)
+}
+
+// возвращает заголовки сообщения для dead-letter топика: исходные заголовки без
+// служебных, координаты первого топика, причину ошибки и номер попытки
+func DeadLetterHeaders(message *sarama.ConsumerMessage, cause error) []sarama.RecordHeader {
+	originalTopic, originalPartition, originalOffset := originOf(message)
+
+	errorText := ""
+	if cause != nil {
+		errorText = cause.Error()
+	}
+	attempt := attemptFromHeaders(message.Headers) + 1
+
+	headers := copyHeaders(message.Headers,
+		HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset,
+		HeaderError, HeaderAttempt, HeaderFailedAt, HeaderRetryDue)
+	return append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(originalTopic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(originalPartition)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(originalOffset)},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(errorText)},
+		sarama.RecordHeader{Key: []byte(HeaderAttempt), Value: []byte(strconv.Itoa(attempt))},
+		sarama.RecordHeader{Key: []byte(HeaderFailedAt), Value: []byte(time.Now().UTC().Format(time.RFC3339Nano))},
+	)
+}
+
+// копирует заголовки сообщения, пропуская перечисленные ключи
+func copyHeaders(headers []*sarama.RecordHeader, skip ...string) []sarama.RecordHeader {
+	result := make([]sarama.RecordHeader, 0, len(headers))
+	for _, header := range headers {
+		if header == nil || containsString(skip, string(header.Key)) {
+			continue
+		}
+		result = append(result, *header)
+	}
+	return result
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeadLetterHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *sarama.ConsumerMessage
+		cause   error
+		want    map[string]string
+	}{
+		{
+			name: "FirstFailure",
+			message: &sarama.ConsumerMessage{
+				Topic:     "user-events",
+				Partition: 2,
+				Offset:    41,
+				Headers: []*sarama.RecordHeader{
+					{Key: []byte(HeaderRequestID), Value: []byte("req-1")},
+				},
+			},
+			cause: errors.New("redis unavailable"),
+			want: map[string]string{
+				HeaderRequestID:         "req-1",
+				HeaderOriginalTopic:     "user-events",
+				HeaderOriginalPartition: "2",
+				HeaderOriginalOffset:    "41",
+				HeaderError:             "redis unavailable",
+				HeaderAttempt:           "1",
+			},
+		},
+		{
+			name: "AlreadyForwarded",
+			message: &sarama.ConsumerMessage{
+				Topic:     "user-events.retry.1m",
+				Partition: 0,
+				Offset:    7,
+				Headers: []*sarama.RecordHeader{
+					{Key: []byte(HeaderRequestID), Value: []byte("req-2")},
+					{Key: []byte(HeaderOriginalTopic), Value: []byte("user-events")},
+					{Key: []byte(HeaderOriginalPartition), Value: []byte("3")},
+					{Key: []byte(HeaderOriginalOffset), Value: []byte("100")},
+					{Key: []byte(HeaderError), Value: []byte("timeout")},
+					{Key: []byte(HeaderAttempt), Value: []byte("2")},
+					{Key: []byte(HeaderRetryDue), Value: []byte("1700000000000")},
+				},
+			},
+			cause: errors.New("still failing"),
+			want: map[string]string{
+				HeaderRequestID:         "req-2",
+				HeaderOriginalTopic:     "user-events",
+				HeaderOriginalPartition: "3",
+				HeaderOriginalOffset:    "100",
+				HeaderError:             "still failing",
+				HeaderAttempt:           "3",
+			},
+		},
+		{
+			name:    "NoCause",
+			message: &sarama.ConsumerMessage{Topic: "user-events", Offset: 5},
+			want: map[string]string{
+				HeaderOriginalTopic:     "user-events",
+				HeaderOriginalPartition: "0",
+				HeaderOriginalOffset:    "5",
+				HeaderError:             "",
+				HeaderAttempt:           "1",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := DeadLetterHeaders(tt.message, tt.cause)
+
+			got := make(map[string]string, len(headers))
+			for _, header := range headers {
+				key := string(header.Key)
+				_, duplicate := got[key]
+				assert.False(t, duplicate, "duplicate header %s", key)
+				got[key] = string(header.Value)
+			}
+
+			assert.NotEmpty(t, got[HeaderFailedAt])
+			delete(got, HeaderFailedAt)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
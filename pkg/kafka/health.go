@@ -2,6 +2,10 @@ package kafka
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
@@ -12,10 +16,101 @@ type HealthChecker struct {
 	client  sarama.Client
 	logger  *logrus.Logger
 	timeout time.Duration
+
+	// cluster admin создается при первом запросе lag и использует client
+	adminMu sync.Mutex
+	admin   sarama.ClusterAdmin
+
+	// размеры ISR партиций при прошлой проверке и уменьшения ISR, которые
+	// показываются всем отчетам в течение isrShrinkWindow
+	isrMu   sync.Mutex
+	isr     map[topicPartition]int
+	shrinks map[topicPartition]*ISRShrink
+}
+
+// сколько уменьшение ISR остается в отчетах: проверки идут и по таймеру monitor,
+// и по запросам, поэтому уменьшение не должно доставаться только первой из них
+const isrShrinkWindow = 5 * time.Minute
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+// состояния кластера в отчете
+const (
+	HealthStatusHealthy   = "healthy"
+	HealthStatusDegraded  = "degraded"
+	HealthStatusUnhealthy = "unhealthy"
+)
+
+// доступность и задержка ответа брокера
+type BrokerHealth struct {
+	ID        int32         `json:"id"`
+	Addr      string        `json:"addr"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	Error     string        `json:"error,omitempty"`
 }
 
-func NewHealthChecker(brokers []string, logger *logrus.Logger) (*HealthChecker, error) {
-	config := sarama.NewConfig()
+// реплики партиции с проблемой репликации
+type PartitionHealth struct {
+	Topic     string  `json:"topic"`
+	Partition int32   `json:"partition"`
+	Leader    int32   `json:"leader"`
+	Replicas  []int32 `json:"replicas"`
+	ISR       []int32 `json:"isr"`
+}
+
+// уменьшение ISR партиции за последние isrShrinkWindow
+type ISRShrink struct {
+	Topic       string    `json:"topic"`
+	Partition   int32     `json:"partition"`
+	PreviousISR int       `json:"previous_isr"`
+	CurrentISR  int       `json:"current_isr"`
+	DetectedAt  time.Time `json:"detected_at"`
+}
+
+// отчет о состоянии Kafka кластера
+type HealthReport struct {
+	Status          string             `json:"status"`
+	CheckedAt       time.Time          `json:"checked_at"`
+	Duration        time.Duration      `json:"duration"`
+	ControllerID    int32              `json:"controller_id"`
+	Brokers         []*BrokerHealth    `json:"brokers"`
+	TopicCount      int                `json:"topic_count"`
+	PartitionCount  int                `json:"partition_count"`
+	UnderReplicated []*PartitionHealth `json:"under_replicated"`
+	Offline         []*PartitionHealth `json:"offline"`
+	ISRShrinks      []*ISRShrink       `json:"isr_shrinks"`
+	Errors          []string           `json:"errors,omitempty"`
+}
+
+// кластер недоступен без брокеров, контроллера или при партициях без лидера;
+// недоступный брокер и проблемы репликации означают деградацию
+func (r *HealthReport) evaluate() string {
+	reachable := 0
+	for _, broker := range r.Brokers {
+		if broker.Reachable {
+			reachable++
+		}
+	}
+
+	switch {
+	case reachable == 0, r.ControllerID < 0, len(r.Offline) > 0:
+		return HealthStatusUnhealthy
+	case reachable < len(r.Brokers), len(r.UnderReplicated) > 0, len(r.ISRShrinks) > 0, len(r.Errors) > 0:
+		return HealthStatusDegraded
+	default:
+		return HealthStatusHealthy
+	}
+}
+
+func NewHealthChecker(brokers []string, security *SecurityConfig, logger *logrus.Logger) (*HealthChecker, error) {
+	config, err := newSaramaConfig(security)
+	if err != nil {
+		return nil, err
+	}
 	config.Net.DialTimeout = 5 * time.Second
 	config.Net.ReadTimeout = 5 * time.Second
 	config.Net.WriteTimeout = 5 * time.Second
@@ -31,51 +126,195 @@ func NewHealthChecker(brokers []string, logger *logrus.Logger) (*HealthChecker,
 		client:  client,
 		logger:  logger,
 		timeout: 5 * time.Second,
+		isr:     make(map[topicPartition]int),
+		shrinks: make(map[topicPartition]*ISRShrink),
 	}, nil
 }
 
-// проверяет состояние Kafka кластера
-func (h *HealthChecker) CheckHealth(ctx context.Context) error {
+// проверяет состояние Kafka кластера и собирает отчет; ошибка возвращается,
+// только если не удалось получить метаданные кластера ни от одного брокера
+func (h *HealthChecker) CheckHealth(ctx context.Context) (*HealthReport, error) {
 	ctx, cancel := context.WithTimeout(ctx, h.timeout)
 	defer cancel()
 
-	// Проверяем подключение к кластеру
-	if err := h.client.RefreshMetadata(); err != nil {
-		h.logger.WithError(err).Error("Failed to refresh Kafka metadata")
-		return err
-	}
+	started := time.Now()
+	report := &HealthReport{CheckedAt: started, ControllerID: -1}
 
-	// Проверяем, что можем получить список топиков
-	topics, err := h.client.Topics()
+	metadata, err := h.fetchMetadata()
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get Kafka topics")
-		return err
+		h.logger.WithError(err).Error("Failed to get Kafka cluster metadata")
+		report.Status = HealthStatusUnhealthy
+		report.Errors = append(report.Errors, err.Error())
+		report.Duration = time.Since(started)
+		return report, err
 	}
+	report.ControllerID = metadata.ControllerID
 
-	// Проверяем, что кластер не пустой
-	if len(topics) == 0 {
-		h.logger.Warn("Kafka cluster has no topics")
+	// Доступность и задержку проверяем на соединениях клиента, не открывая новые
+	for _, brokerMeta := range metadata.Brokers {
+		if err := ctx.Err(); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+			break
+		}
+		report.Brokers = append(report.Brokers, h.checkBroker(brokerMeta))
+	}
+	if len(report.Brokers) == 0 {
+		report.Errors = append(report.Errors, "no Kafka brokers available")
 	}
 
-	// Проверяем состояние брокеров
+	h.inspectPartitions(metadata, report)
+
+	report.Status = report.evaluate()
+	report.Duration = time.Since(started)
+	return report, nil
+}
+
+// запрашивает метаданные всех топиков у контроллера или у любого доступного брокера
+func (h *HealthChecker) fetchMetadata() (*sarama.MetadataResponse, error) {
 	brokers := h.client.Brokers()
+	if controller, err := h.client.Controller(); err == nil {
+		brokers = append([]*sarama.Broker{controller}, brokers...)
+	}
 	if len(brokers) == 0 {
-		h.logger.Error("No Kafka brokers available")
-		return err
+		return nil, fmt.Errorf("no Kafka brokers available")
 	}
 
-	// Проверяем подключение к каждому брокеру
+	request := sarama.NewMetadataRequest(h.client.Config().Version, nil)
+	var lastErr error
 	for _, broker := range brokers {
-		if err := broker.Open(nil); err != nil {
-			h.logger.WithError(err).WithField("broker_id", broker.ID()).Error("Failed to connect to Kafka broker")
-			return err
+		h.ensureOpen(broker)
+		response, err := broker.GetMetadata(request)
+		if err == nil {
+			return response, nil
+		}
+		lastErr = err
+	}
+	return nil, fmt.Errorf("failed to get metadata from any broker: %w", lastErr)
+}
+
+// проверяет брокер легким запросом ApiVersions и измеряет задержку
+func (h *HealthChecker) checkBroker(brokerMeta *sarama.Broker) *BrokerHealth {
+	health := &BrokerHealth{ID: brokerMeta.ID(), Addr: brokerMeta.Addr()}
+
+	broker, err := h.client.Broker(brokerMeta.ID())
+	if err != nil {
+		health.Error = err.Error()
+		return health
+	}
+	h.ensureOpen(broker)
+
+	started := time.Now()
+	if _, err := broker.ApiVersions(&sarama.ApiVersionsRequest{}); err != nil {
+		h.logger.WithError(err).WithField("broker_id", broker.ID()).Error("Kafka broker is unreachable")
+		health.Error = err.Error()
+		return health
+	}
+
+	health.Reachable = true
+	health.Latency = time.Since(started)
+	return health
+}
+
+// открывает соединение с брокером, если клиент еще не подключился к нему
+func (h *HealthChecker) ensureOpen(broker *sarama.Broker) {
+	if connected, _ := broker.Connected(); connected {
+		return
+	}
+	if err := broker.Open(h.client.Config()); err != nil && !errors.Is(err, sarama.ErrAlreadyConnected) {
+		h.logger.WithError(err).WithField("broker_id", broker.ID()).Warn("Failed to open Kafka broker connection")
+	}
+}
+
+// находит партиции без лидера, с неполным ISR и с ISR, уменьшившимся за isrShrinkWindow
+func (h *HealthChecker) inspectPartitions(metadata *sarama.MetadataResponse, report *HealthReport) {
+	h.isrMu.Lock()
+	defer h.isrMu.Unlock()
+
+	current := make(map[topicPartition]int, len(h.isr))
+	for _, topic := range metadata.Topics {
+		if topic.Err != sarama.ErrNoError {
+			report.Errors = append(report.Errors, fmt.Sprintf("topic %s: %v", topic.Name, topic.Err))
+			continue
 		}
-		broker.Close()
+		report.TopicCount++
+
+		for _, partition := range topic.Partitions {
+			report.PartitionCount++
+			key := topicPartition{topic: topic.Name, partition: partition.ID}
+			current[key] = len(partition.Isr)
+
+			health := &PartitionHealth{
+				Topic:     topic.Name,
+				Partition: partition.ID,
+				Leader:    partition.Leader,
+				Replicas:  partition.Replicas,
+				ISR:       partition.Isr,
+			}
+			if partition.Leader < 0 || partition.Err == sarama.ErrLeaderNotAvailable {
+				report.Offline = append(report.Offline, health)
+				continue
+			}
+			if len(partition.Isr) < len(partition.Replicas) {
+				report.UnderReplicated = append(report.UnderReplicated, health)
+			}
+			h.trackShrink(key, len(partition.Isr), report.CheckedAt)
+		}
+	}
+
+	// Уменьшения ISR удаленных партиций и старше окна больше не показываем
+	for key, shrink := range h.shrinks {
+		if _, ok := current[key]; !ok || report.CheckedAt.Sub(shrink.DetectedAt) > isrShrinkWindow {
+			delete(h.shrinks, key)
+			continue
+		}
+		reported := *shrink
+		report.ISRShrinks = append(report.ISRShrinks, &reported)
+	}
+	sort.Slice(report.ISRShrinks, func(i, j int) bool {
+		if report.ISRShrinks[i].Topic != report.ISRShrinks[j].Topic {
+			return report.ISRShrinks[i].Topic < report.ISRShrinks[j].Topic
+		}
+		return report.ISRShrinks[i].Partition < report.ISRShrinks[j].Partition
+	})
+
+	h.isr = current
+}
+
+// запоминает уменьшение ISR партиции с прошлой проверки; после восстановления
+// ISR до прежнего размера уменьшение снимается
+func (h *HealthChecker) trackShrink(key topicPartition, isr int, now time.Time) {
+	if shrink, ok := h.shrinks[key]; ok && isr >= shrink.PreviousISR {
+		delete(h.shrinks, key)
+	}
+
+	previous, ok := h.isr[key]
+	if !ok || isr >= previous {
+		if shrink, ok := h.shrinks[key]; ok {
+			shrink.CurrentISR = isr
+		}
+		return
 	}
 
-	return nil
+	// При повторном уменьшении сохраняем размер ISR до первого из них
+	if shrink, ok := h.shrinks[key]; ok {
+		previous = shrink.PreviousISR
+	}
+	h.shrinks[key] = &ISRShrink{
+		Topic:       key.topic,
+		Partition:   key.partition,
+		PreviousISR: previous,
+		CurrentISR:  isr,
+		DetectedAt:  now,
+	}
 }
 
 func (h *HealthChecker) Close() error {
+	h.adminMu.Lock()
+	defer h.adminMu.Unlock()
+
+	// Cluster admin закрывает client вместе с собой
+	if h.admin != nil {
+		return h.admin.Close()
+	}
 	return h.client.Close()
 }
@@ -0,0 +1,97 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInspectPartitionsISRShrinks(t *testing.T) {
+	metadata := func(isr ...int32) *sarama.MetadataResponse {
+		return &sarama.MetadataResponse{
+			Topics: []*sarama.TopicMetadata{{
+				Name: "events",
+				Partitions: []*sarama.PartitionMetadata{{
+					ID:       0,
+					Leader:   1,
+					Replicas: []int32{1, 2, 3},
+					Isr:      isr,
+				}},
+			}},
+		}
+	}
+	inspect := func(h *HealthChecker, at time.Time, isr ...int32) *HealthReport {
+		report := &HealthReport{CheckedAt: at}
+		h.inspectPartitions(metadata(isr...), report)
+		return report
+	}
+
+	start := time.Now()
+	tests := []struct {
+		name  string
+		check func(t *testing.T, h *HealthChecker)
+	}{
+		{
+			name: "FirstCheckHasNoBaseline",
+			check: func(t *testing.T, h *HealthChecker) {
+				assert.Empty(t, inspect(h, start, 1).ISRShrinks)
+			},
+		},
+		{
+			name: "EveryReaderSeesShrink",
+			check: func(t *testing.T, h *HealthChecker) {
+				inspect(h, start, 1, 2, 3)
+				periodic := inspect(h, start.Add(time.Second), 1, 2)
+				request := inspect(h, start.Add(2*time.Second), 1, 2)
+
+				for _, report := range []*HealthReport{periodic, request} {
+					require.Len(t, report.ISRShrinks, 1)
+					assert.Equal(t, 3, report.ISRShrinks[0].PreviousISR)
+					assert.Equal(t, 2, report.ISRShrinks[0].CurrentISR)
+					assert.Equal(t, start.Add(time.Second), report.ISRShrinks[0].DetectedAt)
+				}
+			},
+		},
+		{
+			name: "RepeatedShrinkKeepsFirstSize",
+			check: func(t *testing.T, h *HealthChecker) {
+				inspect(h, start, 1, 2, 3)
+				inspect(h, start.Add(time.Second), 1, 2)
+				report := inspect(h, start.Add(2*time.Second), 1)
+
+				require.Len(t, report.ISRShrinks, 1)
+				assert.Equal(t, 3, report.ISRShrinks[0].PreviousISR)
+				assert.Equal(t, 1, report.ISRShrinks[0].CurrentISR)
+			},
+		},
+		{
+			name: "RecoveryClearsShrink",
+			check: func(t *testing.T, h *HealthChecker) {
+				inspect(h, start, 1, 2, 3)
+				inspect(h, start.Add(time.Second), 1, 2)
+				assert.Empty(t, inspect(h, start.Add(2*time.Second), 1, 2, 3).ISRShrinks)
+			},
+		},
+		{
+			name: "ShrinkExpiresAfterWindow",
+			check: func(t *testing.T, h *HealthChecker) {
+				inspect(h, start, 1, 2, 3)
+				inspect(h, start.Add(time.Second), 1, 2)
+				assert.Len(t, inspect(h, start.Add(isrShrinkWindow), 1, 2).ISRShrinks, 1)
+				assert.Empty(t, inspect(h, start.Add(isrShrinkWindow+2*time.Second), 1, 2).ISRShrinks)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.check(t, &HealthChecker{
+				isr:     make(map[topicPartition]int),
+				shrinks: make(map[topicPartition]*ISRShrink),
+			})
+		})
+	}
+}
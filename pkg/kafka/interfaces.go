@@ -1,9 +1,16 @@
 package kafka
 
-import "context"
+import (
+	"context"
+
+	"github.com/Shopify/sarama"
+)
 
 type ProducerInterface interface {
+	// топик, в который SendMessage отправляет сообщения
+	Topic() string
 	SendMessage(ctx context.Context, key string, value interface{}) error
+	SendMessageToTopic(ctx context.Context, topic, key string, value interface{}) error
 	Close() error
 }
 
@@ -12,3 +19,18 @@ type ConsumerInterface interface {
 	Start(ctx context.Context) error
 	Close() error
 }
+
+type PartitionControllerInterface interface {
+	Topics() []string
+	PausePartitions(partitions map[string][]int32) error
+	ResumePartitions(partitions map[string][]int32) error
+	PausedPartitions() PauseState
+}
+
+type DeadLetterQueueInterface interface {
+	Publish(ctx context.Context, message *sarama.ConsumerMessage, cause error) error
+	List(ctx context.Context, limit int) ([]*DeadLetterMessage, error)
+	Get(ctx context.Context, partition int32, offset int64) (*DeadLetterMessage, error)
+	Requeue(ctx context.Context, partition int32, offset int64) error
+	Close() error
+}
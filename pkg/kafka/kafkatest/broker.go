@@ -0,0 +1,414 @@
+package kafkatest
+
+import (
+	"context"
+	"hash/fnv"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+)
+
+// операции брокера, в которые можно внедрить ошибку
+type Operation string
+
+const (
+	// Запись в топик; цель - имя топика
+	OpProduce Operation = "produce"
+	// Чтение consumer group; ошибка завершает Start, как разрыв сессии
+	OpFetch Operation = "fetch"
+	// Коммит смещения consumer group; сообщение будет прочитано снова после ребаланса
+	OpCommit Operation = "commit"
+)
+
+type topicPartition struct {
+	topic     string
+	partition int32
+}
+
+type faultKey struct {
+	op     Operation
+	target string
+}
+
+// ошибка, которую брокер вернет на ближайшие операции; count <= 0 - до ClearFaults
+type fault struct {
+	err   error
+	count int
+}
+
+// consumer group: участники, текущее распределение партиций и закоммиченные смещения
+type group struct {
+	generation int
+	members    []*Consumer
+	assignment map[*Consumer][]topicPartition
+	offsets    map[topicPartition]int64
+}
+
+// брокер Kafka в памяти: топики с партициями, consumer groups со смещениями
+// и ребалансом, внедрение ошибок; для тестов без запущенного кластера
+type Broker struct {
+	mu         sync.Mutex
+	partitions int
+	autoCreate bool
+	topics     map[string][][]*sarama.ConsumerMessage
+	groups     map[string]*group
+	faults     map[faultKey]*fault
+	roundRobin map[string]int32
+
+	// закрывается и пересоздается при каждой записи и ребалансе
+	changed chan struct{}
+}
+
+// создает брокер; топики создаются при первой записи с partitions партициями
+func NewBroker(partitions int) *Broker {
+	if partitions < 1 {
+		partitions = 1
+	}
+	return &Broker{
+		partitions: partitions,
+		autoCreate: true,
+		topics:     make(map[string][][]*sarama.ConsumerMessage),
+		groups:     make(map[string]*group),
+		faults:     make(map[faultKey]*fault),
+		roundRobin: make(map[string]int32),
+		changed:    make(chan struct{}),
+	}
+}
+
+// включает или выключает создание топиков при первой записи
+func (b *Broker) SetAutoCreateTopics(enabled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.autoCreate = enabled
+}
+
+// создает топик с заданным числом партиций
+func (b *Broker) CreateTopic(name string, partitions int) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.topics[name]; ok {
+		return sarama.ErrTopicAlreadyExists
+	}
+	if partitions < 1 {
+		return sarama.ErrInvalidPartitions
+	}
+	b.createTopicLocked(name, partitions)
+	return nil
+}
+
+// внедряет ошибку в count ближайших операций op над target (топиком или группой);
+// count <= 0 - ошибка возвращается до ClearFaults
+func (b *Broker) InjectFault(op Operation, target string, count int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults[faultKey{op: op, target: target}] = &fault{err: err, count: count}
+}
+
+// убирает все внедренные ошибки
+func (b *Broker) ClearFaults() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.faults = make(map[faultKey]*fault)
+}
+
+// принудительно перераспределяет партиции группы, как при изменении метаданных
+func (b *Broker) Rebalance(groupID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if g, ok := b.groups[groupID]; ok {
+		b.rebalanceLocked(g)
+	}
+}
+
+// возвращает все сообщения топика по партициям в порядке смещений
+func (b *Broker) Messages(topic string) []*sarama.ConsumerMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var messages []*sarama.ConsumerMessage
+	for _, log := range b.topics[topic] {
+		for _, message := range log {
+			messages = append(messages, copyMessage(message))
+		}
+	}
+	return messages
+}
+
+// возвращает закоммиченное смещение группы или -1, если коммитов не было
+func (b *Broker) CommittedOffset(groupID, topic string, partition int32) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[groupID]
+	if !ok {
+		return -1
+	}
+	offset, ok := g.offsets[topicPartition{topic: topic, partition: partition}]
+	if !ok {
+		return -1
+	}
+	return offset
+}
+
+// ждет, пока группа закоммитит count сообщений топика по всем партициям
+func (b *Broker) WaitForCommitted(ctx context.Context, groupID, topic string, count int64) error {
+	for {
+		b.mu.Lock()
+		var committed int64
+		if g, ok := b.groups[groupID]; ok {
+			for tp, offset := range g.offsets {
+				if tp.topic == topic {
+					committed += offset
+				}
+			}
+		}
+		changed := b.changed
+		b.mu.Unlock()
+
+		if committed >= count {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// записывает сообщение в партицию по ключу, как sarama hash partitioner
+func (b *Broker) produce(message *sarama.ProducerMessage) (int32, int64, error) {
+	key, err := encode(message.Key)
+	if err != nil {
+		return 0, 0, err
+	}
+	value, err := encode(message.Value)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.faultLocked(OpProduce, message.Topic); err != nil {
+		return 0, 0, err
+	}
+
+	partitions, ok := b.topics[message.Topic]
+	if !ok {
+		if !b.autoCreate {
+			return 0, 0, sarama.ErrUnknownTopicOrPartition
+		}
+		partitions = b.createTopicLocked(message.Topic, b.partitions)
+	}
+
+	partition := b.partitionLocked(message.Topic, key, int32(len(partitions)))
+	headers := make([]*sarama.RecordHeader, 0, len(message.Headers))
+	for _, header := range message.Headers {
+		headers = append(headers, &sarama.RecordHeader{Key: header.Key, Value: header.Value})
+	}
+
+	offset := int64(len(partitions[partition]))
+	partitions[partition] = append(partitions[partition], &sarama.ConsumerMessage{
+		Topic:     message.Topic,
+		Partition: partition,
+		Offset:    offset,
+		Key:       key,
+		Value:     value,
+		Headers:   headers,
+		Timestamp: time.Now(),
+	})
+
+	b.notifyLocked()
+	return partition, offset, nil
+}
+
+// выбирает партицию: хэш ключа или по кругу для сообщений без ключа
+func (b *Broker) partitionLocked(topic string, key []byte, count int32) int32 {
+	if len(key) == 0 {
+		partition := b.roundRobin[topic] % count
+		b.roundRobin[topic]++
+		return partition
+	}
+
+	hasher := fnv.New32a()
+	hasher.Write(key)
+	partition := int32(hasher.Sum32()) % count
+	if partition < 0 {
+		partition = -partition
+	}
+	return partition
+}
+
+func (b *Broker) createTopicLocked(name string, partitions int) [][]*sarama.ConsumerMessage {
+	log := make([][]*sarama.ConsumerMessage, partitions)
+	b.topics[name] = log
+
+	// Группы, подписанные на новый топик, получают его партиции
+	for _, g := range b.groups {
+		for _, member := range g.members {
+			if member.subscribes(name) {
+				b.rebalanceLocked(g)
+				break
+			}
+		}
+	}
+	return log
+}
+
+// добавляет consumer в группу и перераспределяет партиции
+func (b *Broker) join(c *Consumer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[c.groupID]
+	if !ok {
+		g = &group{offsets: make(map[topicPartition]int64)}
+		b.groups[c.groupID] = g
+	}
+	g.members = append(g.members, c)
+	b.rebalanceLocked(g)
+}
+
+// удаляет consumer из группы и перераспределяет его партиции
+func (b *Broker) leave(c *Consumer) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	g, ok := b.groups[c.groupID]
+	if !ok {
+		return
+	}
+	g.members = slices.DeleteFunc(g.members, func(member *Consumer) bool { return member == c })
+	b.rebalanceLocked(g)
+}
+
+// раздает партиции по кругу подписанным участникам, как sarama.BalanceStrategyRoundRobin
+func (b *Broker) rebalanceLocked(g *group) {
+	g.generation++
+	g.assignment = make(map[*Consumer][]topicPartition, len(g.members))
+
+	if len(g.members) > 0 {
+		names := make([]string, 0, len(b.topics))
+		for name := range b.topics {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		next := 0
+		for _, name := range names {
+			for partition := range b.topics[name] {
+				for range g.members {
+					member := g.members[next%len(g.members)]
+					next++
+					if member.subscribes(name) {
+						g.assignment[member] = append(g.assignment[member], topicPartition{topic: name, partition: int32(partition)})
+						break
+					}
+				}
+			}
+		}
+	}
+
+	b.notifyLocked()
+}
+
+// возвращает следующее сообщение из партиций consumer или канал, который
+// закроется при новой записи или ребалансе
+func (b *Broker) fetch(c *Consumer, s *session) (*sarama.ConsumerMessage, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.faultLocked(OpFetch, c.groupID); err != nil {
+		return nil, nil, err
+	}
+
+	// После ребаланса читаем с закоммиченных смещений новых партиций
+	g := b.groups[c.groupID]
+	if s.generation != g.generation {
+		s.generation = g.generation
+		s.claims = g.assignment[c]
+		s.positions = make(map[topicPartition]int64, len(s.claims))
+		for _, tp := range s.claims {
+			s.positions[tp] = b.startOffsetLocked(g, tp, c.initialOffset)
+		}
+	}
+
+	for i := range s.claims {
+		tp := s.claims[(s.next+i)%len(s.claims)]
+		log := b.topics[tp.topic][tp.partition]
+		if position := s.positions[tp]; position < int64(len(log)) {
+			s.next += i + 1
+			return copyMessage(log[position]), nil, nil
+		}
+	}
+	return nil, b.changed, nil
+}
+
+// сохраняет смещение после сообщения; коммит устаревшего поколения отклоняется
+func (b *Broker) commit(c *Consumer, s *session, message *sarama.ConsumerMessage) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.faultLocked(OpCommit, c.groupID); err != nil {
+		return err
+	}
+
+	g := b.groups[c.groupID]
+	if g.generation != s.generation {
+		return sarama.ErrRebalanceInProgress
+	}
+	g.offsets[topicPartition{topic: message.Topic, partition: message.Partition}] = message.Offset + 1
+	b.notifyLocked()
+	return nil
+}
+
+// возвращает закоммиченное смещение или начальное для партиции без коммитов
+func (b *Broker) startOffsetLocked(g *group, tp topicPartition, initialOffset int64) int64 {
+	if offset, ok := g.offsets[tp]; ok {
+		return offset
+	}
+	if initialOffset == sarama.OffsetOldest {
+		return 0
+	}
+	return int64(len(b.topics[tp.topic][tp.partition]))
+}
+
+// возвращает внедренную ошибку операции и уменьшает ее счетчик
+func (b *Broker) faultLocked(op Operation, target string) error {
+	key := faultKey{op: op, target: target}
+	f, ok := b.faults[key]
+	if !ok {
+		return nil
+	}
+	if f.count > 0 {
+		f.count--
+		if f.count == 0 {
+			delete(b.faults, key)
+		}
+	}
+	return f.err
+}
+
+// будит всех, кто ждет новых сообщений или ребаланса
+func (b *Broker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func encode(encoder sarama.Encoder) ([]byte, error) {
+	if encoder == nil {
+		return nil, nil
+	}
+	return encoder.Encode()
+}
+
+// копия сообщения, чтобы обработчик не мог изменить лог
+func copyMessage(message *sarama.ConsumerMessage) *sarama.ConsumerMessage {
+	copied := *message
+	return &copied
+}
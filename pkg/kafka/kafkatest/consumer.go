@@ -0,0 +1,200 @@
+package kafkatest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+
+	"pet-proj/pkg/kafka"
+)
+
+// участник consumer group на Broker; реализует kafka.ConsumerInterface
+type Consumer struct {
+	broker        *Broker
+	topics        []string
+	groupID       string
+	logger        *logrus.Logger
+	handler       kafka.MessageHandler
+	initialOffset int64
+	deliveryMode  string
+	backoff       time.Duration
+	deadLetters   string
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// состояние участника в текущем поколении группы
+type session struct {
+	generation int
+	claims     []topicPartition
+	positions  map[topicPartition]int64
+	next       int
+}
+
+// создает consumer; как и kafka.Consumer, без коммитов группа читает только новые сообщения
+func (b *Broker) NewConsumer(topics []string, groupID string, logger *logrus.Logger) *Consumer {
+	return &Consumer{
+		broker:        b,
+		topics:        topics,
+		groupID:       groupID,
+		logger:        logger,
+		initialOffset: sarama.OffsetNewest,
+		deliveryMode:  kafka.DeliveryModeForward,
+		backoff:       10 * time.Millisecond,
+		closed:        make(chan struct{}),
+	}
+}
+
+func (c *Consumer) SetHandler(handler kafka.MessageHandler) {
+	c.handler = handler
+}
+
+// задает смещение для партиций без коммитов: sarama.OffsetOldest или sarama.OffsetNewest
+func (c *Consumer) SetInitialOffset(offset int64) {
+	c.initialOffset = offset
+}
+
+// задает режим доставки как у kafka.Consumer; backoff - пауза между повторами
+func (c *Consumer) SetDeliveryMode(mode string, backoff time.Duration) error {
+	switch mode {
+	case kafka.DeliveryModeForward, kafka.DeliveryModeAtLeastOnce:
+	default:
+		return fmt.Errorf("unknown delivery mode %q", mode)
+	}
+
+	c.deliveryMode = mode
+	if backoff > 0 {
+		c.backoff = backoff
+	}
+	return nil
+}
+
+// включает перекладывание необработанных сообщений в топик с заголовками kafka.Header*
+func (c *Consumer) SetDeadLetterTopic(topic string) {
+	c.deadLetters = topic
+}
+
+// вступает в группу и обрабатывает сообщения до отмены контекста, Close
+// или внедренной ошибки чтения
+func (c *Consumer) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c.broker.join(c)
+	defer c.broker.leave(c)
+
+	s := &session{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		message, changed, err := c.broker.fetch(c, s)
+		if err != nil {
+			c.logger.WithError(err).Error("Error from consumer")
+			return err
+		}
+		if message == nil {
+			select {
+			case <-ctx.Done():
+			case <-changed:
+			}
+			continue
+		}
+
+		// Смещение коммитим только после обработки; иначе сообщение будет прочитано снова
+		if !c.handle(ctx, message) {
+			continue
+		}
+		s.positions[topicPartition{topic: message.Topic, partition: message.Partition}] = message.Offset + 1
+		if err := c.broker.commit(c, s, message); err != nil {
+			c.logger.WithError(err).WithField("offset", message.Offset).Warn("Failed to commit offset")
+		}
+	}
+}
+
+// подписан ли consumer на топик
+func (c *Consumer) subscribes(topic string) bool {
+	for _, name := range c.topics {
+		if name == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// обрабатывает сообщение; возвращает false, если контекст завершился раньше,
+// чем сообщение было обработано или передано дальше
+func (c *Consumer) handle(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	if c.handler == nil {
+		return true
+	}
+
+	err := c.handler.HandleMessage(kafka.ContextFromMessage(ctx, message), message)
+	for err != nil && c.deliveryMode == kafka.DeliveryModeAtLeastOnce && !kafka.IsPermanent(err) {
+		c.logFailure(message, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(c.backoff):
+		}
+		err = c.handler.HandleMessage(kafka.ContextFromMessage(ctx, message), message)
+	}
+	if err == nil {
+		return true
+	}
+	c.logFailure(message, err)
+
+	if c.deadLetters == "" {
+		return true
+	}
+	return c.forwardFailed(ctx, message, err)
+}
+
+// перекладывает сообщение в dead-letter топик с заголовками как у kafka.DeadLetterQueue,
+// повторяя запись при ошибках
+func (c *Consumer) forwardFailed(ctx context.Context, message *sarama.ConsumerMessage, cause error) bool {
+	msg := &sarama.ProducerMessage{
+		Topic:   c.deadLetters,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: kafka.DeadLetterHeaders(message, cause),
+	}
+	for {
+		if _, _, err := c.broker.produce(msg); err == nil {
+			return true
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(c.backoff):
+		}
+	}
+}
+
+func (c *Consumer) logFailure(message *sarama.ConsumerMessage, err error) {
+	c.logger.WithError(err).WithFields(logrus.Fields{
+		"topic":     message.Topic,
+		"partition": message.Partition,
+		"offset":    message.Offset,
+	}).Error("Failed to handle message")
+}
+
+// выводит consumer из группы; Start возвращает context.Canceled
+func (c *Consumer) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
@@ -0,0 +1,63 @@
+package kafkatest
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"pet-proj/pkg/kafka"
+)
+
+var ErrClosed = errors.New("kafkatest: client is closed")
+
+// producer, который пишет в Broker; реализует kafka.ProducerInterface
+type Producer struct {
+	broker *Broker
+	topic  string
+	codecs *kafka.TopicCodecs
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// создает producer с топиком по умолчанию; codecs nil - JSON для всех топиков
+func (b *Broker) NewProducer(topic string, codecs *kafka.TopicCodecs) *Producer {
+	return &Producer{
+		broker: b,
+		topic:  topic,
+		codecs: codecs,
+	}
+}
+
+func (p *Producer) Topic() string {
+	return p.topic
+}
+
+func (p *Producer) SendMessage(ctx context.Context, key string, value interface{}) error {
+	return p.SendMessageToTopic(ctx, p.topic, key, value)
+}
+
+// отправляет сообщение в указанный топик с теми же заголовками, что и kafka.Producer
+func (p *Producer) SendMessageToTopic(ctx context.Context, topic, key string, value interface{}) error {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return ErrClosed
+	}
+
+	msg, err := kafka.NewProducerMessage(ctx, p.codecs.ForTopic(topic), topic, key, value)
+	if err != nil {
+		return err
+	}
+
+	_, _, err = p.broker.produce(msg)
+	return err
+}
+
+func (p *Producer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
@@ -0,0 +1,190 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/Shopify/sarama"
+)
+
+// отставание consumer group в одной партиции
+type PartitionLag struct {
+	Topic           string `json:"topic"`
+	Partition       int32  `json:"partition"`
+	CommittedOffset int64  `json:"committed_offset"`
+	LatestOffset    int64  `json:"latest_offset"`
+	Lag             int64  `json:"lag"`
+}
+
+// отставание consumer group по всем партициям ее топиков
+type ConsumerGroupLag struct {
+	Group      string          `json:"group"`
+	TotalLag   int64           `json:"total_lag"`
+	Partitions []*PartitionLag `json:"partitions"`
+}
+
+// вычисляет отставание consumer groups через cluster admin API
+func (h *HealthChecker) ConsumerLag(ctx context.Context, groups []string) ([]*ConsumerGroupLag, error) {
+	admin, err := h.clusterAdmin()
+	if err != nil {
+		return nil, err
+	}
+
+	// Обновляем метаданные, чтобы получить актуальные последние смещения
+	if err := h.client.RefreshMetadata(); err != nil {
+		h.logger.WithError(err).Error("Failed to refresh Kafka metadata")
+		return nil, err
+	}
+
+	result := make([]*ConsumerGroupLag, 0, len(groups))
+	for _, group := range groups {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		groupLag, err := h.groupLag(admin, group)
+		if err != nil {
+			h.logger.WithError(err).WithField("group", group).Error("Failed to get consumer group lag")
+			return nil, err
+		}
+		result = append(result, groupLag)
+	}
+
+	return result, nil
+}
+
+func (h *HealthChecker) groupLag(admin sarama.ClusterAdmin, group string) (*ConsumerGroupLag, error) {
+	partitions, err := h.groupPartitions(admin, group)
+	if err != nil {
+		return nil, err
+	}
+
+	groupLag := &ConsumerGroupLag{Group: group}
+	if len(partitions) == 0 {
+		return groupLag, nil
+	}
+
+	// Запрашиваем смещения всех партиций подписки: для партиций без коммита
+	// брокер возвращает -1
+	offsets, err := admin.ListConsumerGroupOffsets(group, partitions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets of group %s: %w", group, err)
+	}
+	if offsets.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("failed to list offsets of group %s: %w", group, offsets.Err)
+	}
+
+	for topic, partitions := range offsets.Blocks {
+		for partition, block := range partitions {
+			if block.Err != sarama.ErrNoError {
+				return nil, fmt.Errorf("failed to get offset of %s/%d: %w", topic, partition, block.Err)
+			}
+
+			latest, err := h.client.GetOffset(topic, partition, sarama.OffsetNewest)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get latest offset of %s/%d: %w", topic, partition, err)
+			}
+
+			partitionLag := newPartitionLag(topic, partition, block.Offset, latest)
+			groupLag.Partitions = append(groupLag.Partitions, partitionLag)
+			groupLag.TotalLag += partitionLag.Lag
+		}
+	}
+
+	sort.Slice(groupLag.Partitions, func(i, j int) bool {
+		if groupLag.Partitions[i].Topic != groupLag.Partitions[j].Topic {
+			return groupLag.Partitions[i].Topic < groupLag.Partitions[j].Topic
+		}
+		return groupLag.Partitions[i].Partition < groupLag.Partitions[j].Partition
+	})
+
+	return groupLag, nil
+}
+
+// считает отставание партиции от закоммиченного смещения. Партиция без коммита
+// (committed -1) не отстает: consumer начинает ее с OffsetNewest, поэтому
+// уже записанные сообщения он читать не будет
+func newPartitionLag(topic string, partition int32, committed, latest int64) *PartitionLag {
+	var lag int64
+	if committed >= 0 && latest > committed {
+		lag = latest - committed
+	}
+	return &PartitionLag{
+		Topic:           topic,
+		Partition:       partition,
+		CommittedOffset: committed,
+		LatestOffset:    latest,
+		Lag:             lag,
+	}
+}
+
+// возвращает все партиции топиков, на которые подписаны участники группы или
+// на которые у группы есть коммиты; так в отставание попадают партиции, которые
+// группа еще ни разу не закоммитила
+func (h *HealthChecker) groupPartitions(admin sarama.ClusterAdmin, group string) (map[string][]int32, error) {
+	descriptions, err := admin.DescribeConsumerGroups([]string{group})
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe group %s: %w", group, err)
+	}
+
+	var topics []string
+	for _, description := range descriptions {
+		if description.Err != sarama.ErrNoError {
+			return nil, fmt.Errorf("failed to describe group %s: %w", group, description.Err)
+		}
+		for _, member := range description.Members {
+			metadata, err := member.GetMemberMetadata()
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode member metadata of group %s: %w", group, err)
+			}
+			for _, topic := range metadata.Topics {
+				if !containsString(topics, topic) {
+					topics = append(topics, topic)
+				}
+			}
+		}
+	}
+
+	// Группа без активных участников сохраняет коммиты своих топиков
+	committed, err := admin.ListConsumerGroupOffsets(group, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list offsets of group %s: %w", group, err)
+	}
+	if committed.Err != sarama.ErrNoError {
+		return nil, fmt.Errorf("failed to list offsets of group %s: %w", group, committed.Err)
+	}
+	for topic := range committed.Blocks {
+		if !containsString(topics, topic) {
+			topics = append(topics, topic)
+		}
+	}
+
+	partitions := make(map[string][]int32, len(topics))
+	for _, topic := range topics {
+		ids, err := h.client.Partitions(topic)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get partitions of %s: %w", topic, err)
+		}
+		partitions[topic] = ids
+	}
+	return partitions, nil
+}
+
+// возвращает cluster admin, создавая его поверх client при первом вызове
+func (h *HealthChecker) clusterAdmin() (sarama.ClusterAdmin, error) {
+	h.adminMu.Lock()
+	defer h.adminMu.Unlock()
+
+	if h.admin != nil {
+		return h.admin, nil
+	}
+
+	admin, err := sarama.NewClusterAdminFromClient(h.client)
+	if err != nil {
+		h.logger.WithError(err).Error("Failed to create Kafka cluster admin")
+		return nil, err
+	}
+	h.admin = admin
+	return admin, nil
+}
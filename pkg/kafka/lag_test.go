@@ -0,0 +1,37 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewPartitionLag(t *testing.T) {
+	tests := []struct {
+		name      string
+		committed int64
+		latest    int64
+		wantLag   int64
+	}{
+		{name: "Behind", committed: 40, latest: 100, wantLag: 60},
+		{name: "CaughtUp", committed: 100, latest: 100},
+		// A new group starts at the newest offset, so retained messages are not lag
+		{name: "Uncommitted", committed: -1, latest: 100},
+		{name: "UncommittedEmpty", committed: -1, latest: 0},
+		// Latest offset fetched before a concurrent commit
+		{name: "CommittedAhead", committed: 101, latest: 100},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lag := newPartitionLag("events", 3, tt.committed, tt.latest)
+			assert.Equal(t, &PartitionLag{
+				Topic:           "events",
+				Partition:       3,
+				CommittedOffset: tt.committed,
+				LatestOffset:    tt.latest,
+				Lag:             tt.wantLag,
+			}, lag)
+		})
+	}
+}
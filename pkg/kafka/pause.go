@@ -0,0 +1,156 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+var ErrUnknownTopic = errors.New("topic is not consumed")
+
+// состояние приостановки чтения, заданное администратором
+type PauseState struct {
+	All        bool
+	Partitions map[string][]int32
+}
+
+// приостанавливает чтение выбранных партиций; пустой набор - всех партиций.
+// Приостановка сохраняется после ребаланса и действует, пока не будет снята
+func (c *Consumer) PausePartitions(partitions map[string][]int32) error {
+	if err := c.checkTopics(partitions); err != nil {
+		return err
+	}
+
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	if len(partitions) == 0 {
+		c.pausedAll = true
+	}
+	for topic, ids := range partitions {
+		if c.adminPaused[topic] == nil {
+			c.adminPaused[topic] = make(map[int32]bool)
+		}
+		for _, partition := range ids {
+			c.adminPaused[topic][partition] = true
+		}
+	}
+
+	c.applyPauses()
+	return nil
+}
+
+// возобновляет чтение выбранных партиций; пустой набор - всех партиций.
+// Партиции, приостановленные на время повторной обработки, остаются на паузе до ее завершения
+func (c *Consumer) ResumePartitions(partitions map[string][]int32) error {
+	if err := c.checkTopics(partitions); err != nil {
+		return err
+	}
+
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	if len(partitions) == 0 {
+		c.pausedAll = false
+		c.adminPaused = make(map[string]map[int32]bool)
+		c.applyPauses()
+		return nil
+	}
+
+	// Общая пауза превращается в паузу назначенных партиций, кроме возобновляемых
+	if c.pausedAll {
+		c.pausedAll = false
+		for topic, ids := range c.assigned {
+			if c.adminPaused[topic] == nil {
+				c.adminPaused[topic] = make(map[int32]bool)
+			}
+			for _, partition := range ids {
+				c.adminPaused[topic][partition] = true
+			}
+		}
+	}
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			delete(c.adminPaused[topic], partition)
+		}
+		if len(c.adminPaused[topic]) == 0 {
+			delete(c.adminPaused, topic)
+		}
+	}
+
+	c.applyPauses()
+	return nil
+}
+
+// возвращает приостановки, заданные администратором
+func (c *Consumer) PausedPartitions() PauseState {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	state := PauseState{All: c.pausedAll, Partitions: make(map[string][]int32)}
+	for topic, ids := range c.adminPaused {
+		state.Partitions[topic] = slices.Sorted(maps.Keys(ids))
+	}
+	return state
+}
+
+// возвращает топики, которые читает consumer
+func (c *Consumer) Topics() []string {
+	return c.topics
+}
+
+func (c *Consumer) checkTopics(partitions map[string][]int32) error {
+	for topic := range partitions {
+		if !slices.Contains(c.topics, topic) {
+			return fmt.Errorf("%w: %s", ErrUnknownTopic, topic)
+		}
+	}
+	return nil
+}
+
+// запоминает партиции, назначенные consumer в новой сессии
+func (c *Consumer) assign(claims map[string][]int32) {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	c.assigned = claims
+}
+
+// повторно приостанавливает партицию после ребаланса: sarama создает
+// новый partition consumer, который ничего не знает о прежней паузе
+func (c *Consumer) restorePause(topic string, partition int32) {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+
+	if c.adminPausedLocked(topic, partition) {
+		c.consumer.Pause(map[string][]int32{topic: {partition}})
+	}
+}
+
+// приводит назначенные партиции в соответствие с приостановками администратора и
+// приостановками на время повторной обработки; вызывается под pauseMu
+func (c *Consumer) applyPauses() {
+	pause := make(map[string][]int32)
+	resume := make(map[string][]int32)
+	for topic, ids := range c.assigned {
+		for _, partition := range ids {
+			if c.adminPausedLocked(topic, partition) || c.pauses[topic][partition] > 0 {
+				pause[topic] = append(pause[topic], partition)
+			} else {
+				resume[topic] = append(resume[topic], partition)
+			}
+		}
+	}
+
+	if len(pause) > 0 {
+		c.consumer.Pause(pause)
+	}
+	if len(resume) > 0 {
+		c.consumer.Resume(resume)
+	}
+}
+
+func (c *Consumer) adminPausedLocked(topic string, partition int32) bool {
+	return c.pausedAll || c.adminPaused[topic][partition]
+}
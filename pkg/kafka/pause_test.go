@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Shopify/sarama"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsumerPauses(t *testing.T) {
+	assigned := map[string][]int32{"events": {0, 1, 2}}
+
+	tests := []struct {
+		name       string
+		steps      func(t *testing.T, c *Consumer)
+		wantPaused []int32
+		wantState  PauseState
+	}{
+		{
+			name: "PauseSelected",
+			steps: func(t *testing.T, c *Consumer) {
+				require.NoError(t, c.PausePartitions(map[string][]int32{"events": {1}}))
+			},
+			wantPaused: []int32{1},
+			wantState:  PauseState{Partitions: map[string][]int32{"events": {1}}},
+		},
+		{
+			name: "PauseAll",
+			steps: func(t *testing.T, c *Consumer) {
+				require.NoError(t, c.PausePartitions(nil))
+			},
+			wantPaused: []int32{0, 1, 2},
+			wantState:  PauseState{All: true, Partitions: map[string][]int32{}},
+		},
+		{
+			name: "ResumeOneWhilePausedAll",
+			steps: func(t *testing.T, c *Consumer) {
+				require.NoError(t, c.PausePartitions(nil))
+				require.NoError(t, c.ResumePartitions(map[string][]int32{"events": {1}}))
+			},
+			wantPaused: []int32{0, 2},
+			wantState:  PauseState{Partitions: map[string][]int32{"events": {0, 2}}},
+		},
+		{
+			name: "ResumeAll",
+			steps: func(t *testing.T, c *Consumer) {
+				require.NoError(t, c.PausePartitions(map[string][]int32{"events": {0, 2}}))
+				require.NoError(t, c.ResumePartitions(nil))
+			},
+			wantState: PauseState{Partitions: map[string][]int32{}},
+		},
+		{
+			name: "RedeliveryFinishesWhileAdminPaused",
+			steps: func(t *testing.T, c *Consumer) {
+				c.pausePartition("events", 1)
+				require.NoError(t, c.PausePartitions(map[string][]int32{"events": {1}}))
+				c.resumePartition("events", 1)
+			},
+			wantPaused: []int32{1},
+			wantState:  PauseState{Partitions: map[string][]int32{"events": {1}}},
+		},
+		{
+			name: "AdminResumeKeepsRedeliveryPause",
+			steps: func(t *testing.T, c *Consumer) {
+				require.NoError(t, c.PausePartitions(nil))
+				c.pausePartition("events", 2)
+				require.NoError(t, c.ResumePartitions(nil))
+			},
+			wantPaused: []int32{2},
+			wantState:  PauseState{Partitions: map[string][]int32{}},
+		},
+		{
+			name: "ConcurrentRedeliveriesRefcount",
+			steps: func(t *testing.T, c *Consumer) {
+				c.pausePartition("events", 0)
+				c.pausePartition("events", 0)
+				c.resumePartition("events", 0)
+				group := c.consumer.(*pauseGroup)
+				assert.Equal(t, []int32{0}, group.pausedPartitions("events"), "paused until the last redelivery finishes")
+				c.resumePartition("events", 0)
+				// Extra resumes must not go below zero
+				c.resumePartition("events", 0)
+			},
+			wantState: PauseState{Partitions: map[string][]int32{}},
+		},
+		{
+			name: "UnknownTopic",
+			steps: func(t *testing.T, c *Consumer) {
+				assert.ErrorIs(t, c.PausePartitions(map[string][]int32{"other": {0}}), ErrUnknownTopic)
+				assert.ErrorIs(t, c.ResumePartitions(map[string][]int32{"other": {0}}), ErrUnknownTopic)
+			},
+			wantState: PauseState{Partitions: map[string][]int32{}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := &pauseGroup{paused: make(map[string]map[int32]bool)}
+			c := testConsumer(nil, 1, 1)
+			c.consumer = group
+			c.topics = []string{"events"}
+			c.assign(assigned)
+
+			tt.steps(t, c)
+
+			assert.Equal(t, tt.wantPaused, group.pausedPartitions("events"))
+			assert.Equal(t, tt.wantState, c.PausedPartitions())
+		})
+	}
+}
+
+func TestConsumerRestorePause(t *testing.T) {
+	group := &pauseGroup{paused: make(map[string]map[int32]bool)}
+	c := testConsumer(nil, 1, 1)
+	c.consumer = group
+	c.topics = []string{"events"}
+
+	// Partitions paused by the admin stay paused after a rebalance
+	require.NoError(t, c.PausePartitions(map[string][]int32{"events": {1}}))
+	c.assign(map[string][]int32{"events": {0, 1}})
+	group.paused = make(map[string]map[int32]bool)
+	c.restorePause("events", 0)
+	c.restorePause("events", 1)
+
+	assert.Equal(t, []int32{1}, group.pausedPartitions("events"))
+}
+
+// хранит состояние Pause/Resume как partition consumers sarama
+type pauseGroup struct {
+	sarama.ConsumerGroup
+	paused map[string]map[int32]bool
+}
+
+func (g *pauseGroup) Pause(partitions map[string][]int32) {
+	for topic, ids := range partitions {
+		if g.paused[topic] == nil {
+			g.paused[topic] = make(map[int32]bool)
+		}
+		for _, partition := range ids {
+			g.paused[topic][partition] = true
+		}
+	}
+}
+
+func (g *pauseGroup) Resume(partitions map[string][]int32) {
+	for topic, ids := range partitions {
+		for _, partition := range ids {
+			delete(g.paused[topic], partition)
+		}
+	}
+}
+
+func (g *pauseGroup) pausedPartitions(topic string) []int32 {
+	if len(g.paused[topic]) == 0 {
+		return nil
+	}
+	return slices.Sorted(maps.Keys(g.paused[topic]))
+}
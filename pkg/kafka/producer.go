@@ -2,59 +2,172 @@ package kafka
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/sirupsen/logrus"
 )
 
-type Producer struct {
-	producer sarama.SyncProducer
-	topic    string
-	logger   *logrus.Logger
+// режимы отправки сообщений
+const (
+	ProducerModeSync  = "sync"
+	ProducerModeAsync = "async"
+)
+
+// настройки Kafka producer
+type ProducerConfig struct {
+	Brokers     []string
+	Topic       string
+	BatchSize   int           // Количество сообщений, после которого пачка отправляется
+	BatchBytes  int           // Размер пачки в байтах, после которого она отправляется
+	Linger      time.Duration // Сколько ждать наполнения пачки
+	Compression string        // none, gzip, snappy, lz4, zstd
+	MaxInFlight int           // Количество одновременных запросов к брокеру; с идемпотентностью всегда 1
+
+	// Идемпотентный producer не создает дубликатов при внутренних повторах отправки
+	Idempotent bool
+	// Непустой TransactionalID включает транзакции; должен быть стабилен для экземпляра сервиса
+	TransactionalID string
+
+	// Кодеки тела сообщения по топикам; nil - JSON для всех топиков
+	Codecs *TopicCodecs
+
+	// TLS и SASL подключения; nil - без защиты
+	Security *SecurityConfig
+
+	Logger *logrus.Logger
 }
 
-func NewProducer(brokers []string, topic string, logger *logrus.Logger) (*Producer, error) {
-	config := sarama.NewConfig()
+// возвращает настройки producer по умолчанию
+func DefaultProducerConfig(brokers []string, topic string, logger *logrus.Logger) *ProducerConfig {
+	return &ProducerConfig{
+		Brokers:     brokers,
+		Topic:       topic,
+		BatchSize:   100,
+		BatchBytes:  1024 * 1024, // 1MB
+		Linger:      10 * time.Millisecond,
+		Compression: "none",
+		MaxInFlight: 5,
+		Logger:      logger,
+	}
+}
+
+// собирает sarama конфигурацию producer
+func (c *ProducerConfig) saramaConfig() (*sarama.Config, error) {
+	compression, err := parseCompression(c.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := newSaramaConfig(c.Security)
+	if err != nil {
+		return nil, err
+	}
 	config.Producer.RequiredAcks = sarama.WaitForAll
 	config.Producer.Retry.Max = 5
 	config.Producer.Return.Successes = true
+	config.Producer.Return.Errors = true
 	config.Producer.Timeout = 10 * time.Second
+	config.Producer.Compression = compression
+	if c.MaxInFlight > 0 {
+		config.Net.MaxOpenRequests = c.MaxInFlight
+	}
+
+	if c.Idempotent || c.TransactionalID != "" {
+		// Идемпотентность требует подтверждения от всех реплик и одного запроса в полете
+		if c.MaxInFlight > 1 && c.Logger != nil {
+			c.Logger.WithField("max_in_flight", c.MaxInFlight).Warn("Idempotent Kafka producer allows one in-flight request, ignoring max in-flight setting")
+		}
+		config.Producer.Idempotent = true
+		config.Producer.RequiredAcks = sarama.WaitForAll
+		config.Net.MaxOpenRequests = 1
+	}
+	if c.TransactionalID != "" {
+		config.Producer.Transaction.ID = c.TransactionalID
+	}
+
+	return config, nil
+}
+
+// у транзакционного producer нет ни явного transactional ID, ни номера экземпляра
+var ErrTransactionalIDUnset = errors.New("transactional producer requires a transactional ID or an instance ordinal")
+
+// возвращает transactional ID экземпляра сервиса: явный id или префикс и порядковый
+// номер pod в StatefulSet. ID должен переживать перезапуск, чтобы новый экземпляр
+// отменял незавершенные транзакции предыдущего, поэтому имя хоста не подходит:
+// у pod Deployment оно меняется при каждом перезапуске
+func InstanceTransactionalID(id, prefix, ordinal string) (string, error) {
+	if id != "" {
+		return id, nil
+	}
+	if ordinal == "" {
+		return "", ErrTransactionalIDUnset
+	}
+	n, err := strconv.Atoi(ordinal)
+	if err != nil || n < 0 {
+		return "", fmt.Errorf("invalid producer instance ordinal %q", ordinal)
+	}
+	return fmt.Sprintf("%s-%d", prefix, n), nil
+}
+
+type Producer struct {
+	producer sarama.SyncProducer
+	topic    string
+	codecs   *TopicCodecs
+	logger   *logrus.Logger
 
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	// в транзакционном режиме транзакции выполняются по одной: каждое сообщение
+	// ждет BeginTxn, отправку и CommitTxn предыдущего
+	txMu sync.Mutex
+}
+
+func NewProducer(config *ProducerConfig) (*Producer, error) {
+	saramaConfig, err := config.saramaConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	producer, err := sarama.NewSyncProducer(config.Brokers, saramaConfig)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Producer{
 		producer: producer,
-		topic:    topic,
-		logger:   logger,
+		topic:    config.Topic,
+		codecs:   config.Codecs,
+		logger:   config.Logger,
 	}, nil
 }
 
+func (p *Producer) Topic() string {
+	return p.topic
+}
+
 func (p *Producer) SendMessage(ctx context.Context, key string, value interface{}) error {
-	data, err := json.Marshal(value)
+	return p.SendMessageToTopic(ctx, p.topic, key, value)
+}
+
+// отправляет сообщение в указанный топик вместо топика по умолчанию
+func (p *Producer) SendMessageToTopic(ctx context.Context, topic, key string, value interface{}) error {
+	msg, err := NewProducerMessage(ctx, p.codecs.ForTopic(topic), topic, key, value)
 	if err != nil {
 		p.logger.WithError(err).Error("Failed to marshal message")
 		return err
 	}
 
-	msg := &sarama.ProducerMessage{
-		Topic: p.topic,
-		Key:   sarama.StringEncoder(key),
-		Value: sarama.ByteEncoder(data),
-	}
-
-	partition, offset, err := p.producer.SendMessage(msg)
+	partition, offset, err := p.send(msg)
 	if err != nil {
 		p.logger.WithError(err).Error("Failed to send message to Kafka")
 		return err
 	}
 
 	p.logger.WithFields(logrus.Fields{
-		"topic":     p.topic,
+		"topic":     topic,
 		"partition": partition,
 		"offset":    offset,
 		"key":       key,
@@ -63,6 +176,76 @@ func (p *Producer) SendMessage(ctx context.Context, key string, value interface{
 	return nil
 }
 
+// кодирует значение кодеком топика и собирает сообщение с заголовками контекста;
+// используется и реализациями ProducerInterface вне пакета
+func NewProducerMessage(ctx context.Context, codec Codec, topic, key string, value interface{}) (*sarama.ProducerMessage, error) {
+	data, err := codec.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := append(contextHeaders(ctx), sarama.RecordHeader{
+		Key:   []byte(HeaderContentType),
+		Value: []byte(codec.ContentType()),
+	})
+
+	return &sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     sarama.StringEncoder(key),
+		Value:   sarama.ByteEncoder(data),
+		Headers: headers,
+	}, nil
+}
+
+// отправляет сообщение, оборачивая его в транзакцию, если producer транзакционный
+func (p *Producer) send(msg *sarama.ProducerMessage) (int32, int64, error) {
+	if !p.producer.IsTransactional() {
+		return p.producer.SendMessage(msg)
+	}
+
+	p.txMu.Lock()
+	defer p.txMu.Unlock()
+
+	if err := p.producer.BeginTxn(); err != nil {
+		return 0, 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	partition, offset, err := p.producer.SendMessage(msg)
+	if err != nil {
+		if abortErr := p.producer.AbortTxn(); abortErr != nil {
+			p.logger.WithError(abortErr).Error("Failed to abort Kafka transaction")
+		}
+		return 0, 0, err
+	}
+
+	if err := p.producer.CommitTxn(); err != nil {
+		if abortErr := p.producer.AbortTxn(); abortErr != nil {
+			p.logger.WithError(abortErr).Error("Failed to abort Kafka transaction")
+		}
+		return 0, 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return partition, offset, nil
+}
+
 func (p *Producer) Close() error {
 	return p.producer.Close()
 }
+
+// конвертирует название алгоритма сжатия в sarama.CompressionCodec
+func parseCompression(name string) (sarama.CompressionCodec, error) {
+	switch name {
+	case "", "none":
+		return sarama.CompressionNone, nil
+	case "gzip":
+		return sarama.CompressionGZIP, nil
+	case "snappy":
+		return sarama.CompressionSnappy, nil
+	case "lz4":
+		return sarama.CompressionLZ4, nil
+	case "zstd":
+		return sarama.CompressionZSTD, nil
+	default:
+		return sarama.CompressionNone, fmt.Errorf("unknown compression codec %q", name)
+	}
+}
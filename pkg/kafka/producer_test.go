@@ -0,0 +1,36 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInstanceTransactionalID(t *testing.T) {
+	tests := []struct {
+		name    string
+		id      string
+		ordinal string
+		want    string
+		wantErr bool
+	}{
+		{name: "ExplicitID", id: "producer-eu-1", ordinal: "3", want: "producer-eu-1"},
+		{name: "Ordinal", ordinal: "2", want: "producer-2"},
+		{name: "Unset", wantErr: true},
+		{name: "InvalidOrdinal", ordinal: "producer-7c9f", wantErr: true},
+		{name: "NegativeOrdinal", ordinal: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := InstanceTransactionalID(tt.id, "producer", tt.ordinal)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,389 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// диапазон и параметры повторной обработки топика
+type ReplayConfig struct {
+	Topic   string
+	GroupID string
+
+	// Границы диапазона задаются смещением (-1 - не задано) или временем (нулевое -
+	// не задано); смещение важнее времени. Начало включается, конец - нет.
+	// Без начала читаем с самого старого сообщения, без конца - до последнего
+	// сообщения на момент запуска
+	StartOffset int64
+	EndOffset   int64
+	StartTime   time.Time
+	EndTime     time.Time
+
+	Rate   float64 // Сообщений в секунду; 0 - без ограничения
+	DryRun bool    // Только подсчет сообщений, без вызова обработчика и коммита смещений
+
+	// Отбирает сообщения для обработки; nil - все сообщения диапазона
+	Filter func(message *sarama.ConsumerMessage) bool
+
+	// Партиция считается прочитанной, если за это время не пришло ни одного сообщения:
+	// последние смещения диапазона могут занимать служебные записи транзакций
+	IdleTimeout time.Duration
+}
+
+// прогресс повторной обработки одной партиции
+type PartitionReplay struct {
+	Partition int32 `json:"partition"`
+	Start     int64 `json:"start"`
+	End       int64 `json:"end"`
+	Read      int64 `json:"read"`
+	Processed int64 `json:"processed"`
+	Skipped   int64 `json:"skipped"`
+	Failed    int64 `json:"failed"`
+
+	done    bool
+	rewound bool // смещение группы уже переведено на Start
+}
+
+// итоговый отчет повторной обработки
+type ReplayReport struct {
+	Topic      string             `json:"topic"`
+	GroupID    string             `json:"group_id"`
+	DryRun     bool               `json:"dry_run"`
+	Completed  bool               `json:"completed"`
+	Read       int64              `json:"read"`
+	Processed  int64              `json:"processed"`
+	Skipped    int64              `json:"skipped"`
+	Failed     int64              `json:"failed"`
+	Duration   time.Duration      `json:"duration"`
+	Partitions []*PartitionReplay `json:"partitions"`
+}
+
+// повторно прогоняет сообщения топика из заданного диапазона через MessageHandler
+// в отдельной consumer group, не затрагивая смещения рабочих consumer
+type Replayer struct {
+	client  sarama.Client
+	group   sarama.ConsumerGroup
+	config  ReplayConfig
+	logger  *logrus.Logger
+	handler MessageHandler
+
+	limiter <-chan time.Time
+
+	mu         sync.Mutex
+	partitions map[int32]*PartitionReplay
+	remaining  int
+	finish     context.CancelFunc
+}
+
+func NewReplayer(brokers []string, security *SecurityConfig, config ReplayConfig, logger *logrus.Logger) (*Replayer, error) {
+	if config.Topic == "" {
+		return nil, fmt.Errorf("replay topic is required")
+	}
+	if config.GroupID == "" {
+		return nil, fmt.Errorf("replay consumer group is required")
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = 10 * time.Second
+	}
+
+	saramaConfig, err := newSaramaConfig(security)
+	if err != nil {
+		return nil, err
+	}
+	saramaConfig.Consumer.Offsets.Initial = sarama.OffsetOldest
+	saramaConfig.Consumer.IsolationLevel = sarama.ReadCommitted
+
+	client, err := sarama.NewClient(brokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	group, err := sarama.NewConsumerGroupFromClient(config.GroupID, client)
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &Replayer{
+		client:     client,
+		group:      group,
+		config:     config,
+		logger:     logger,
+		partitions: make(map[int32]*PartitionReplay),
+	}, nil
+}
+
+// читает диапазон и передает сообщения обработчику; возвращает отчет и ошибку,
+// если повторная обработка прервана до конца диапазона
+func (r *Replayer) Run(ctx context.Context, handler MessageHandler) (*ReplayReport, error) {
+	started := time.Now()
+	r.handler = handler
+
+	if err := r.resolveRanges(); err != nil {
+		return nil, err
+	}
+
+	if r.config.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / r.config.Rate))
+		defer ticker.Stop()
+		r.limiter = ticker.C
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	r.finish = cancel
+
+	var runErr error
+	if r.pending() > 0 {
+		for runCtx.Err() == nil {
+			if err := r.group.Consume(runCtx, []string{r.config.Topic}, r); err != nil {
+				runErr = err
+				break
+			}
+		}
+	}
+
+	report := r.report(time.Since(started))
+	if runErr == nil && !report.Completed {
+		runErr = ctx.Err()
+	}
+	return report, runErr
+}
+
+// вычисляет границы диапазона для каждой партиции топика
+func (r *Replayer) resolveRanges() error {
+	partitions, err := r.client.Partitions(r.config.Topic)
+	if err != nil {
+		return fmt.Errorf("failed to list partitions of %s: %w", r.config.Topic, err)
+	}
+
+	for _, partition := range partitions {
+		oldest, err := r.client.GetOffset(r.config.Topic, partition, sarama.OffsetOldest)
+		if err != nil {
+			return fmt.Errorf("failed to get oldest offset of partition %d: %w", partition, err)
+		}
+		newest, err := r.client.GetOffset(r.config.Topic, partition, sarama.OffsetNewest)
+		if err != nil {
+			return fmt.Errorf("failed to get newest offset of partition %d: %w", partition, err)
+		}
+
+		start, err := r.boundary(partition, r.config.StartOffset, r.config.StartTime, oldest, oldest, newest)
+		if err != nil {
+			return err
+		}
+		end, err := r.boundary(partition, r.config.EndOffset, r.config.EndTime, newest, oldest, newest)
+		if err != nil {
+			return err
+		}
+
+		progress := &PartitionReplay{Partition: partition, Start: start, End: end, done: start >= end}
+		r.partitions[partition] = progress
+		if !progress.done {
+			r.remaining++
+		}
+	}
+
+	return nil
+}
+
+// переводит границу из смещения или времени в смещение партиции в пределах [oldest, newest]
+func (r *Replayer) boundary(partition int32, offset int64, at time.Time, fallback, oldest, newest int64) (int64, error) {
+	var err error
+	switch {
+	case offset >= 0:
+	case !at.IsZero():
+		offset, err = r.client.GetOffset(r.config.Topic, partition, at.UnixMilli())
+		if err != nil {
+			return 0, fmt.Errorf("failed to get offset for time %s of partition %d: %w", at.Format(time.RFC3339), partition, err)
+		}
+		// Брокер не нашел сообщений не раньше этого времени
+		if offset < 0 {
+			offset = newest
+		}
+	default:
+		offset = fallback
+	}
+
+	if offset < oldest {
+		offset = oldest
+	}
+	if offset > newest {
+		offset = newest
+	}
+	return offset, nil
+}
+
+// переводит смещение группы на начало диапазона при первом получении партиции;
+// ResetOffset, в отличие от MarkOffset, сдвигает и назад, поэтому группа с коммитами
+// за пределами диапазона тоже начинает с Start. После ребаланса группа продолжает
+// с уже закоммиченного прогресса
+func (r *Replayer) Setup(session sarama.ConsumerGroupSession) error {
+	for _, partition := range session.Claims()[r.config.Topic] {
+		if progress, ok := r.partitions[partition]; ok && !progress.done && !progress.rewound {
+			session.ResetOffset(r.config.Topic, partition, progress.Start, "")
+			progress.rewound = true
+		}
+	}
+	return nil
+}
+
+func (r *Replayer) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (r *Replayer) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	progress, ok := r.partitions[claim.Partition()]
+	if !ok || progress.done {
+		return nil
+	}
+	if claim.InitialOffset() >= progress.End {
+		r.complete(progress)
+		return nil
+	}
+
+	idle := time.NewTimer(r.config.IdleTimeout)
+	defer idle.Stop()
+
+	for {
+		select {
+		case message := <-claim.Messages():
+			if message == nil {
+				return nil
+			}
+			if message.Offset >= progress.End {
+				r.complete(progress)
+				return nil
+			}
+
+			if !r.replay(session.Context(), progress, message) {
+				return nil
+			}
+			if !r.config.DryRun {
+				session.MarkMessage(message, "")
+			}
+
+			if message.Offset+1 >= progress.End {
+				r.complete(progress)
+				return nil
+			}
+			idle.Reset(r.config.IdleTimeout)
+
+		case <-idle.C:
+			r.complete(progress)
+			return nil
+
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
+
+// обрабатывает одно сообщение диапазона; возвращает false, если сессия завершилась раньше
+func (r *Replayer) replay(ctx context.Context, progress *PartitionReplay, message *sarama.ConsumerMessage) bool {
+	r.mu.Lock()
+	progress.Read++
+	r.mu.Unlock()
+
+	if r.config.Filter != nil && !r.config.Filter(message) {
+		r.count(&progress.Skipped)
+		return true
+	}
+
+	if r.limiter != nil {
+		select {
+		case <-r.limiter:
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	if r.config.DryRun {
+		r.count(&progress.Processed)
+		return true
+	}
+
+	// Ошибки не останавливают повторную обработку: сообщение попадает в отчет
+	if err := r.handler.HandleMessage(contextFromHeaders(ctx, message.Headers), message); err != nil {
+		r.count(&progress.Failed)
+		r.logger.WithError(err).WithFields(logrus.Fields{
+			"topic":     message.Topic,
+			"partition": message.Partition,
+			"offset":    message.Offset,
+		}).Error("Failed to replay message")
+		return true
+	}
+
+	r.count(&progress.Processed)
+	return true
+}
+
+func (r *Replayer) count(counter *int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*counter++
+}
+
+// отмечает партицию прочитанной и завершает работу, когда прочитаны все партиции
+func (r *Replayer) complete(progress *PartitionReplay) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if progress.done {
+		return
+	}
+	progress.done = true
+	r.remaining--
+
+	r.logger.WithFields(logrus.Fields{
+		"partition": progress.Partition,
+		"read":      progress.Read,
+	}).Info("Partition replay finished")
+
+	if r.remaining == 0 && r.finish != nil {
+		r.finish()
+	}
+}
+
+func (r *Replayer) pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.remaining
+}
+
+// собирает отчет по всем партициям
+func (r *Replayer) report(duration time.Duration) *ReplayReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &ReplayReport{
+		Topic:     r.config.Topic,
+		GroupID:   r.config.GroupID,
+		DryRun:    r.config.DryRun,
+		Completed: r.remaining == 0,
+		Duration:  duration,
+	}
+
+	for _, partition := range slices.Sorted(maps.Keys(r.partitions)) {
+		progress := r.partitions[partition]
+		snapshot := *progress
+		report.Partitions = append(report.Partitions, &snapshot)
+		report.Read += progress.Read
+		report.Processed += progress.Processed
+		report.Skipped += progress.Skipped
+		report.Failed += progress.Failed
+	}
+
+	return report
+}
+
+func (r *Replayer) Close() error {
+	if err := r.group.Close(); err != nil {
+		return err
+	}
+	return r.client.Close()
+}
@@ -0,0 +1,180 @@
+package kafka
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayerResolveRanges(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(24 * time.Hour)
+
+	// Partition 0 holds offsets [10, 100), partition 1 holds [0, 50)
+	client := &replayClient{
+		partitions: []int32{0, 1},
+		offsets: map[int32]map[int64]int64{
+			0: {sarama.OffsetOldest: 10, sarama.OffsetNewest: 100, from.UnixMilli(): 40, to.UnixMilli(): 70},
+			1: {sarama.OffsetOldest: 0, sarama.OffsetNewest: 50, from.UnixMilli(): -1, to.UnixMilli(): -1},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		config ReplayConfig
+		want   map[int32][2]int64
+	}{
+		{
+			name:   "WholeTopic",
+			config: ReplayConfig{StartOffset: -1, EndOffset: -1},
+			want:   map[int32][2]int64{0: {10, 100}, 1: {0, 50}},
+		},
+		{
+			name:   "OffsetsClampedToPartition",
+			config: ReplayConfig{StartOffset: 5, EndOffset: 60},
+			want:   map[int32][2]int64{0: {10, 60}, 1: {5, 50}},
+		},
+		{
+			// Partition 1 has no messages at or after the given time
+			name:   "TimeRange",
+			config: ReplayConfig{StartOffset: -1, EndOffset: -1, StartTime: from, EndTime: to},
+			want:   map[int32][2]int64{0: {40, 70}, 1: {50, 50}},
+		},
+		{
+			name:   "OffsetOverridesTime",
+			config: ReplayConfig{StartOffset: 20, EndOffset: -1, StartTime: from},
+			want:   map[int32][2]int64{0: {20, 100}, 1: {20, 50}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Topic = "events"
+			r := testReplayer(client, tt.config)
+			require.NoError(t, r.resolveRanges())
+
+			remaining := 0
+			for partition, bounds := range tt.want {
+				progress := r.partitions[partition]
+				require.NotNil(t, progress)
+				assert.Equal(t, bounds[0], progress.Start, "start of partition %d", partition)
+				assert.Equal(t, bounds[1], progress.End, "end of partition %d", partition)
+				assert.Equal(t, bounds[0] >= bounds[1], progress.done)
+				if !progress.done {
+					remaining++
+				}
+			}
+			assert.Equal(t, remaining, r.pending())
+		})
+	}
+}
+
+func TestReplayerSetupRewindsOnce(t *testing.T) {
+	r := testReplayer(nil, ReplayConfig{Topic: "events"})
+	r.partitions[0] = &PartitionReplay{Partition: 0, Start: 10, End: 100}
+	r.partitions[1] = &PartitionReplay{Partition: 1, Start: 5, End: 5, done: true}
+
+	session := &replaySession{testSession: newTestSession(), claims: map[string][]int32{"events": {0, 1}}}
+	require.NoError(t, r.Setup(session))
+	// A group that already committed past Start is moved back to it
+	assert.Equal(t, map[int32]int64{0: 10}, session.resets)
+
+	// After a rebalance the group keeps its committed progress
+	session.resets = nil
+	require.NoError(t, r.Setup(session))
+	assert.Empty(t, session.resets)
+}
+
+func TestReplayerFilter(t *testing.T) {
+	handler := newOrderHandler(-1)
+	r := testReplayer(nil, ReplayConfig{
+		Topic: "events",
+		Filter: func(message *sarama.ConsumerMessage) bool {
+			return string(message.Key) != "skip"
+		},
+	})
+	r.handler = handler
+	progress := &PartitionReplay{End: 3}
+
+	for offset, key := range []string{"a", "skip", "b"} {
+		message := &sarama.ConsumerMessage{Topic: "events", Key: []byte(key), Offset: int64(offset)}
+		assert.True(t, r.replay(context.Background(), progress, message))
+	}
+
+	assert.Equal(t, int64(3), progress.Read)
+	assert.Equal(t, int64(2), progress.Processed)
+	assert.Equal(t, int64(1), progress.Skipped)
+	assert.Equal(t, 2, handler.count())
+}
+
+func TestReplayerIdleCompletion(t *testing.T) {
+	r := testReplayer(nil, ReplayConfig{Topic: "events", IdleTimeout: 10 * time.Millisecond})
+	progress := &PartitionReplay{Partition: 0, Start: 0, End: 10}
+	r.partitions[0] = progress
+	r.remaining = 1
+
+	finished := make(chan struct{})
+	r.finish = func() { close(finished) }
+
+	// The claim never delivers messages, e.g. the range ends with transaction markers
+	session := newTestSession()
+	defer session.cancel()
+	require.NoError(t, r.ConsumeClaim(session, testClaim{topic: "events", partition: 0}))
+
+	select {
+	case <-finished:
+	case <-time.After(time.Second):
+		t.Fatal("replay did not finish after idle timeout")
+	}
+	report := r.report(0)
+	assert.True(t, report.Completed)
+	assert.Zero(t, report.Read)
+}
+
+func testReplayer(client sarama.Client, config ReplayConfig) *Replayer {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return &Replayer{
+		client:     client,
+		config:     config,
+		logger:     logger,
+		partitions: make(map[int32]*PartitionReplay),
+	}
+}
+
+// отдает партиции и смещения топика из таблицы
+type replayClient struct {
+	sarama.Client
+	partitions []int32
+	offsets    map[int32]map[int64]int64
+}
+
+func (c *replayClient) Partitions(topic string) ([]int32, error) {
+	return c.partitions, nil
+}
+
+func (c *replayClient) GetOffset(topic string, partition int32, at int64) (int64, error) {
+	return c.offsets[partition][at], nil
+}
+
+// запоминает смещения, на которые группу переводит ResetOffset
+type replaySession struct {
+	*testSession
+	claims map[string][]int32
+	resets map[int32]int64
+}
+
+func (s *replaySession) Claims() map[string][]int32 { return s.claims }
+
+func (s *replaySession) ResetOffset(topic string, partition int32, offset int64, metadata string) {
+	if s.resets == nil {
+		s.resets = make(map[int32]int64)
+	}
+	s.resets[partition] = offset
+}
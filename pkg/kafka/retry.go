@@ -0,0 +1,161 @@
+package kafka
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// перекладывает необработанные сообщения в retry топики с нарастающей задержкой,
+// а после исчерпания попыток в dead-letter топик
+type RetryTopics struct {
+	producer    sarama.SyncProducer
+	topic       string
+	delays      []time.Duration
+	maxAttempts int
+	deadLetters DeadLetterQueueInterface
+	logger      *logrus.Logger
+}
+
+func NewRetryTopics(brokers []string, security *SecurityConfig, topic string, delays []time.Duration, maxAttempts int, deadLetters DeadLetterQueueInterface, logger *logrus.Logger) (*RetryTopics, error) {
+	if len(delays) == 0 {
+		return nil, fmt.Errorf("at least one retry delay is required")
+	}
+	// Без терминального топика сообщение после последней попытки было бы потеряно
+	if deadLetters == nil {
+		return nil, fmt.Errorf("dead-letter queue is required for retry topics")
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = len(delays)
+	}
+
+	config, err := newSaramaConfig(security)
+	if err != nil {
+		return nil, err
+	}
+	config.Producer.RequiredAcks = sarama.WaitForAll
+	config.Producer.Retry.Max = 5
+	config.Producer.Return.Successes = true
+	config.Producer.Timeout = 10 * time.Second
+
+	producer, err := sarama.NewSyncProducer(brokers, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RetryTopics{
+		producer:    producer,
+		topic:       topic,
+		delays:      delays,
+		maxAttempts: maxAttempts,
+		deadLetters: deadLetters,
+		logger:      logger,
+	}, nil
+}
+
+// возвращает имя retry топика для задержки, например user-events.retry.5s
+func RetryTopicName(topic string, delay time.Duration) string {
+	return fmt.Sprintf("%s.retry.%s", topic, formatDelay(delay))
+}
+
+// возвращает список retry топиков без повторов
+func (r *RetryTopics) Topics() []string {
+	topics := make([]string, 0, len(r.delays))
+	for _, delay := range r.delays {
+		name := RetryTopicName(r.topic, delay)
+		if !containsString(topics, name) {
+			topics = append(topics, name)
+		}
+	}
+	return topics
+}
+
+// отправляет сообщение на следующую ступень повторов или в dead-letter топик
+func (r *RetryTopics) Forward(ctx context.Context, message *sarama.ConsumerMessage, cause error) error {
+	attempt := attemptFromHeaders(message.Headers) + 1
+	if attempt > r.maxAttempts {
+		return r.deadLetters.Publish(ctx, message, cause)
+	}
+
+	// Для попыток сверх числа ступеней используем последнюю задержку
+	tier := attempt - 1
+	if tier >= len(r.delays) {
+		tier = len(r.delays) - 1
+	}
+	delay := r.delays[tier]
+	topic := RetryTopicName(r.topic, delay)
+
+	originalTopic, originalPartition, originalOffset := originOf(message)
+
+	errorText := ""
+	if cause != nil {
+		errorText = cause.Error()
+	}
+	now := time.Now()
+
+	headers := copyHeaders(message.Headers,
+		HeaderOriginalTopic, HeaderOriginalPartition, HeaderOriginalOffset,
+		HeaderError, HeaderAttempt, HeaderFailedAt, HeaderRetryDue)
+	headers = append(headers,
+		sarama.RecordHeader{Key: []byte(HeaderOriginalTopic), Value: []byte(originalTopic)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalPartition), Value: []byte(originalPartition)},
+		sarama.RecordHeader{Key: []byte(HeaderOriginalOffset), Value: []byte(originalOffset)},
+		sarama.RecordHeader{Key: []byte(HeaderError), Value: []byte(errorText)},
+		sarama.RecordHeader{Key: []byte(HeaderAttempt), Value: []byte(strconv.Itoa(attempt))},
+		sarama.RecordHeader{Key: []byte(HeaderFailedAt), Value: []byte(now.UTC().Format(time.RFC3339Nano))},
+		sarama.RecordHeader{Key: []byte(HeaderRetryDue), Value: []byte(strconv.FormatInt(now.Add(delay).UnixMilli(), 10))},
+	)
+
+	msg := &sarama.ProducerMessage{
+		Topic:   topic,
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: headers,
+	}
+
+	if _, _, err := r.producer.SendMessage(msg); err != nil {
+		r.logger.WithError(err).WithField("topic", topic).Error("Failed to publish message to retry topic")
+		return err
+	}
+
+	r.logger.WithFields(logrus.Fields{
+		"topic":          topic,
+		"original_topic": originalTopic,
+		"attempt":        attempt,
+		"delay":          delay.String(),
+		"error":          errorText,
+	}).Warn("Message scheduled for retry")
+
+	return nil
+}
+
+func (r *RetryTopics) Close() error {
+	return r.producer.Close()
+}
+
+// возвращает время, когда сообщение из retry топика можно обрабатывать
+func retryDueTime(message *sarama.ConsumerMessage) time.Time {
+	due, err := strconv.ParseInt(headerValue(message.Headers, HeaderRetryDue), 10, 64)
+	if err != nil {
+		return message.Timestamp
+	}
+	return time.UnixMilli(due)
+}
+
+// форматирует задержку в короткий суффикс топика: 5s, 1m, 10m, 2h
+func formatDelay(delay time.Duration) string {
+	switch {
+	case delay >= time.Hour && delay%time.Hour == 0:
+		return fmt.Sprintf("%dh", delay/time.Hour)
+	case delay >= time.Minute && delay%time.Minute == 0:
+		return fmt.Sprintf("%dm", delay/time.Minute)
+	case delay%time.Second == 0:
+		return fmt.Sprintf("%ds", delay/time.Second)
+	default:
+		return fmt.Sprintf("%dms", delay/time.Millisecond)
+	}
+}
@@ -0,0 +1,61 @@
+package kafka
+
+import (
+	"fmt"
+	"path"
+)
+
+// правило маршрутизации: тип события или glob шаблон над типами и топик назначения
+type TopicRoute struct {
+	Pattern string
+	Topic   string
+}
+
+// выбирает топик для события по его типу; правила проверяются по порядку,
+// первое совпавшее побеждает, иначе используется топик по умолчанию
+type TopicRouter struct {
+	routes       []TopicRoute
+	defaultTopic string
+}
+
+func NewTopicRouter(defaultTopic string, routes []TopicRoute) (*TopicRouter, error) {
+	if defaultTopic == "" {
+		return nil, fmt.Errorf("default topic is required")
+	}
+
+	for _, route := range routes {
+		if route.Pattern == "" || route.Topic == "" {
+			return nil, fmt.Errorf("route requires pattern and topic: %+v", route)
+		}
+		// Проверяем синтаксис шаблона заранее, чтобы не получить ошибку при отправке
+		if _, err := path.Match(route.Pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid route pattern %q: %w", route.Pattern, err)
+		}
+	}
+
+	return &TopicRouter{
+		routes:       routes,
+		defaultTopic: defaultTopic,
+	}, nil
+}
+
+// возвращает топик для типа события
+func (r *TopicRouter) Route(eventType string) string {
+	for _, route := range r.routes {
+		if matched, _ := path.Match(route.Pattern, eventType); matched {
+			return route.Topic
+		}
+	}
+	return r.defaultTopic
+}
+
+// возвращает все топики, в которые может попасть событие, без повторов
+func (r *TopicRouter) Topics() []string {
+	topics := []string{r.defaultTopic}
+	for _, route := range r.routes {
+		if !containsString(topics, route.Topic) {
+			topics = append(topics, route.Topic)
+		}
+	}
+	return topics
+}
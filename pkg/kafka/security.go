@@ -0,0 +1,152 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/Shopify/sarama"
+	"github.com/xdg-go/scram"
+)
+
+// механизмы SASL аутентификации
+const (
+	SASLMechanismPlain       = "PLAIN"
+	SASLMechanismSCRAMSHA256 = "SCRAM-SHA-256"
+	SASLMechanismSCRAMSHA512 = "SCRAM-SHA-512"
+)
+
+// настройки шифрования и аутентификации подключения к Kafka
+type SecurityConfig struct {
+	TLS  TLSConfig
+	SASL SASLConfig
+}
+
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// пустой Mechanism выключает SASL
+type SASLConfig struct {
+	Mechanism string
+	Username  string
+	Password  string
+}
+
+// создает конфигурацию sarama с общими для всех клиентов настройками:
+// версией протокола, TLS и SASL; nil security означает подключение без защиты
+func newSaramaConfig(security *SecurityConfig) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+	config.Version = sarama.V2_1_0_0
+
+	if security == nil {
+		return config, nil
+	}
+
+	if security.TLS.Enabled {
+		tlsConfig, err := security.TLS.build()
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	if security.SASL.Mechanism != "" {
+		if err := security.SASL.apply(config); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func (c *TLSConfig) build() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		caCert, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// Клиентский сертификат нужен только для mTLS
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+func (c *SASLConfig) apply(config *sarama.Config) error {
+	if c.Username == "" {
+		return fmt.Errorf("SASL username is required")
+	}
+
+	config.Net.SASL.Enable = true
+	config.Net.SASL.Handshake = true
+	config.Net.SASL.User = c.Username
+	config.Net.SASL.Password = c.Password
+
+	switch c.Mechanism {
+	case SASLMechanismPlain:
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case SASLMechanismSCRAMSHA256:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGenerator: scram.SHA256}
+		}
+	case SASLMechanismSCRAMSHA512:
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient {
+			return &scramClient{hashGenerator: scram.SHA512}
+		}
+	default:
+		return fmt.Errorf("unsupported SASL mechanism: %s", c.Mechanism)
+	}
+
+	return nil
+}
+
+// реализует sarama.SCRAMClient поверх xdg-go/scram
+type scramClient struct {
+	hashGenerator scram.HashGeneratorFcn
+	conversation  *scram.ClientConversation
+}
+
+func (c *scramClient) Begin(userName, password, authzID string) error {
+	client, err := c.hashGenerator.NewClient(userName, password, authzID)
+	if err != nil {
+		return err
+	}
+	c.conversation = client.NewConversation()
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	return c.conversation.Step(challenge)
+}
+
+func (c *scramClient) Done() bool {
+	return c.conversation.Done()
+}
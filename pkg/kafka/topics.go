@@ -0,0 +1,219 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+)
+
+// желаемое состояние топика; нулевые Retention и CleanupPolicy не проверяются
+type TopicSpec struct {
+	Name              string
+	Partitions        int32
+	ReplicationFactor int16
+	Retention         time.Duration
+	CleanupPolicy     string
+}
+
+// расхождение существующего топика с желаемым состоянием
+type TopicDrift struct {
+	Topic   string `json:"topic"`
+	Field   string `json:"field"`
+	Desired string `json:"desired"`
+	Actual  string `json:"actual"`
+}
+
+// фактическое состояние топика в кластере; Configs содержит и значения по умолчанию
+type topicState struct {
+	Partitions        int32
+	ReplicationFactor int16
+	Configs           map[string]string
+}
+
+// результат сверки топиков
+type ProvisionReport struct {
+	DryRun  bool         `json:"dry_run"`
+	Created []string     `json:"created"`
+	Drift   []TopicDrift `json:"drift"`
+}
+
+// собирает спецификации для топиков: явно описанные берутся как есть,
+// остальные получают параметры по умолчанию
+func TopicSpecsFor(names []string, defaults TopicSpec, declared []TopicSpec) []TopicSpec {
+	specs := make([]TopicSpec, 0, len(names)+len(declared))
+	seen := make(map[string]bool, len(names)+len(declared))
+	for _, spec := range declared {
+		if !seen[spec.Name] {
+			specs = append(specs, spec)
+			seen[spec.Name] = true
+		}
+	}
+	for _, name := range names {
+		if !seen[name] {
+			spec := defaults
+			spec.Name = name
+			specs = append(specs, spec)
+			seen[name] = true
+		}
+	}
+	return specs
+}
+
+// сверяет топики кластера со спецификациями через cluster admin API: создает
+// недостающие и сообщает о расхождениях; в dry-run режиме ничего не меняет
+func ProvisionTopics(ctx context.Context, brokers []string, security *SecurityConfig, specs []TopicSpec, dryRun bool, logger *logrus.Logger) (*ProvisionReport, error) {
+	config, err := newSaramaConfig(security)
+	if err != nil {
+		return nil, err
+	}
+
+	admin, err := sarama.NewClusterAdmin(brokers, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kafka cluster admin: %w", err)
+	}
+	defer admin.Close()
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Kafka topics: %w", err)
+	}
+
+	report := &ProvisionReport{DryRun: dryRun}
+	for _, spec := range specs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		_, ok := existing[spec.Name]
+		if !ok && !dryRun {
+			// Топик мог создать другой сервис или автосоздание брокера после ListTopics
+			err := admin.CreateTopic(spec.Name, spec.topicDetail(), false)
+			switch {
+			case err == nil:
+			case errors.Is(err, sarama.ErrTopicAlreadyExists):
+				ok = true
+			default:
+				return nil, fmt.Errorf("failed to create topic %s: %w", spec.Name, err)
+			}
+		}
+		if !ok {
+			report.Created = append(report.Created, spec.Name)
+			continue
+		}
+
+		state, err := describeTopic(admin, spec.Name)
+		if err != nil {
+			return nil, err
+		}
+		report.Drift = append(report.Drift, topicDrift(spec, state)...)
+	}
+
+	report.log(logger)
+	return report, nil
+}
+
+func (s TopicSpec) topicDetail() *sarama.TopicDetail {
+	detail := &sarama.TopicDetail{
+		NumPartitions:     s.Partitions,
+		ReplicationFactor: s.ReplicationFactor,
+		ConfigEntries:     make(map[string]*string),
+	}
+	if s.Retention > 0 {
+		retention := strconv.FormatInt(s.Retention.Milliseconds(), 10)
+		detail.ConfigEntries["retention.ms"] = &retention
+	}
+	if s.CleanupPolicy != "" {
+		policy := s.CleanupPolicy
+		detail.ConfigEntries["cleanup.policy"] = &policy
+	}
+	return detail
+}
+
+// читает число партиций, фактор репликации и действующие параметры топика,
+// включая унаследованные от брокера
+func describeTopic(admin sarama.ClusterAdmin, name string) (topicState, error) {
+	metadata, err := admin.DescribeTopics([]string{name})
+	if err != nil {
+		return topicState{}, fmt.Errorf("failed to describe topic %s: %w", name, err)
+	}
+	if len(metadata) != 1 {
+		return topicState{}, fmt.Errorf("failed to describe topic %s: no metadata", name)
+	}
+	if metadata[0].Err != sarama.ErrNoError {
+		return topicState{}, fmt.Errorf("failed to describe topic %s: %w", name, metadata[0].Err)
+	}
+
+	state := topicState{
+		Partitions: int32(len(metadata[0].Partitions)),
+		Configs:    make(map[string]string),
+	}
+	if len(metadata[0].Partitions) > 0 {
+		state.ReplicationFactor = int16(len(metadata[0].Partitions[0].Replicas))
+	}
+
+	entries, err := admin.DescribeConfig(sarama.ConfigResource{Type: sarama.TopicResource, Name: name})
+	if err != nil {
+		return topicState{}, fmt.Errorf("failed to describe config of topic %s: %w", name, err)
+	}
+	for _, entry := range entries {
+		state.Configs[entry.Name] = entry.Value
+	}
+	return state, nil
+}
+
+// сравнивает существующий топик со спецификацией
+func topicDrift(spec TopicSpec, state topicState) []TopicDrift {
+	var drift []TopicDrift
+	add := func(field, desired, actual string) {
+		if desired != actual {
+			drift = append(drift, TopicDrift{Topic: spec.Name, Field: field, Desired: desired, Actual: actual})
+		}
+	}
+
+	if spec.Partitions > 0 {
+		add("partitions", strconv.Itoa(int(spec.Partitions)), strconv.Itoa(int(state.Partitions)))
+	}
+	if spec.ReplicationFactor > 0 {
+		add("replication_factor", strconv.Itoa(int(spec.ReplicationFactor)), strconv.Itoa(int(state.ReplicationFactor)))
+	}
+
+	desired := spec.topicDetail().ConfigEntries
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		actual, ok := state.Configs[key]
+		if !ok {
+			actual = "<unknown>"
+		}
+		add(key, *desired[key], actual)
+	}
+
+	return drift
+}
+
+func (r *ProvisionReport) log(logger *logrus.Logger) {
+	for _, topic := range r.Created {
+		message := "Kafka topic created"
+		if r.DryRun {
+			message = "Kafka topic is missing and would be created"
+		}
+		logger.WithField("topic", topic).Info(message)
+	}
+	for _, drift := range r.Drift {
+		logger.WithFields(logrus.Fields{
+			"topic":   drift.Topic,
+			"field":   drift.Field,
+			"desired": drift.Desired,
+			"actual":  drift.Actual,
+		}).Warn("Kafka topic configuration drift")
+	}
+}
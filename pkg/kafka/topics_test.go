@@ -0,0 +1,85 @@
+package kafka
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopicSpecsFor(t *testing.T) {
+	defaults := TopicSpec{Partitions: 3, ReplicationFactor: 1, Retention: 168 * time.Hour, CleanupPolicy: "delete"}
+	declared := []TopicSpec{
+		{Name: "user-events", Partitions: 12, ReplicationFactor: 3},
+		{Name: "user-events", Partitions: 1, ReplicationFactor: 1},
+		{Name: "audit", Partitions: 1, ReplicationFactor: 3, CleanupPolicy: "compact"},
+	}
+
+	specs := TopicSpecsFor([]string{"user-events", "user-events.dlq", "user-events.dlq"}, defaults, declared)
+
+	assert.Equal(t, []TopicSpec{
+		{Name: "user-events", Partitions: 12, ReplicationFactor: 3},
+		{Name: "audit", Partitions: 1, ReplicationFactor: 3, CleanupPolicy: "compact"},
+		{Name: "user-events.dlq", Partitions: 3, ReplicationFactor: 1, Retention: 168 * time.Hour, CleanupPolicy: "delete"},
+	}, specs)
+}
+
+func TestTopicDrift(t *testing.T) {
+	spec := TopicSpec{Name: "events", Partitions: 3, ReplicationFactor: 1, Retention: 168 * time.Hour, CleanupPolicy: "delete"}
+
+	tests := []struct {
+		name  string
+		spec  TopicSpec
+		state topicState
+		want  []TopicDrift
+	}{
+		{
+			// Broker defaults are reported by DescribeConfig and match the spec
+			name: "MatchesBrokerDefaults",
+			spec: spec,
+			state: topicState{
+				Partitions:        3,
+				ReplicationFactor: 1,
+				Configs:           map[string]string{"retention.ms": "604800000", "cleanup.policy": "delete", "segment.ms": "604800000"},
+			},
+		},
+		{
+			name: "Drift",
+			spec: spec,
+			state: topicState{
+				Partitions:        6,
+				ReplicationFactor: 3,
+				Configs:           map[string]string{"retention.ms": "86400000", "cleanup.policy": "compact"},
+			},
+			want: []TopicDrift{
+				{Topic: "events", Field: "partitions", Desired: "3", Actual: "6"},
+				{Topic: "events", Field: "replication_factor", Desired: "1", Actual: "3"},
+				{Topic: "events", Field: "cleanup.policy", Desired: "delete", Actual: "compact"},
+				{Topic: "events", Field: "retention.ms", Desired: "604800000", Actual: "86400000"},
+			},
+		},
+		{
+			name: "ZeroFieldsNotChecked",
+			spec: TopicSpec{Name: "events"},
+			state: topicState{
+				Partitions:        6,
+				ReplicationFactor: 3,
+				Configs:           map[string]string{"cleanup.policy": "compact"},
+			},
+		},
+		{
+			name:  "MissingConfig",
+			spec:  TopicSpec{Name: "events", CleanupPolicy: "delete"},
+			state: topicState{Configs: map[string]string{}},
+			want: []TopicDrift{
+				{Topic: "events", Field: "cleanup.policy", Desired: "delete", Actual: "<unknown>"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, topicDrift(tt.spec, tt.state))
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package kafka
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/Shopify/sarama"
+)
+
+// обрабатывает сообщения партиции параллельно в нескольких воркерах; сообщения
+// с одинаковым ключом всегда попадают в один воркер и обрабатываются по порядку
+type workerPool struct {
+	consumer *Consumer
+	session  sarama.ConsumerGroupSession
+	tracker  *offsetTracker
+	queues   []chan *sarama.ConsumerMessage
+	wg       sync.WaitGroup
+}
+
+func newWorkerPool(consumer *Consumer, session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) *workerPool {
+	pool := &workerPool{
+		consumer: consumer,
+		session:  session,
+		tracker:  newOffsetTracker(claim.Topic(), claim.Partition()),
+		queues:   make([]chan *sarama.ConsumerMessage, consumer.workers),
+	}
+
+	for i := range pool.queues {
+		pool.queues[i] = make(chan *sarama.ConsumerMessage, consumer.queueDepth)
+		pool.wg.Add(1)
+		go pool.work(pool.queues[i])
+	}
+
+	return pool
+}
+
+// ставит сообщение в очередь воркера; возвращает false, если сессия завершилась
+func (p *workerPool) dispatch(message *sarama.ConsumerMessage) bool {
+	p.tracker.add(message.Offset)
+
+	select {
+	case p.queues[p.queueIndex(message)] <- message:
+		return true
+	case <-p.session.Context().Done():
+		p.tracker.fail(message.Offset)
+		return false
+	}
+}
+
+// дожидается завершения всех воркеров
+func (p *workerPool) close() {
+	for _, queue := range p.queues {
+		close(queue)
+	}
+	p.wg.Wait()
+}
+
+func (p *workerPool) work(queue <-chan *sarama.ConsumerMessage) {
+	defer p.wg.Done()
+
+	ctx := p.session.Context()
+	for message := range queue {
+		// Если сообщение не обработано, отметка смещения останавливается на нем
+		if ctx.Err() != nil || !p.consumer.handle(ctx, message) {
+			p.tracker.fail(message.Offset)
+			continue
+		}
+
+		if offset, ok := p.tracker.complete(message.Offset); ok {
+			p.session.MarkOffset(p.tracker.topic, p.tracker.partition, offset, "")
+		}
+	}
+}
+
+// выбирает воркер по ключу сообщения; сообщения без ключа распределяются по смещению
+func (p *workerPool) queueIndex(message *sarama.ConsumerMessage) int {
+	if len(message.Key) == 0 {
+		return int(message.Offset % int64(len(p.queues)))
+	}
+
+	hash := fnv.New32a()
+	hash.Write(message.Key)
+	return int(hash.Sum32() % uint32(len(p.queues)))
+}
+
+// отслеживает завершение сообщений партиции и вычисляет смещение, до которого
+// все сообщения обработаны без пропусков
+type offsetTracker struct {
+	topic     string
+	partition int32
+
+	mu      sync.Mutex
+	pending []int64
+	done    map[int64]bool
+	// смещение первого необработанного сообщения; -1, если такого нет
+	stop int64
+}
+
+func newOffsetTracker(topic string, partition int32) *offsetTracker {
+	return &offsetTracker{
+		topic:     topic,
+		partition: partition,
+		done:      make(map[int64]bool),
+		stop:      -1,
+	}
+}
+
+// регистрирует сообщение в порядке чтения из партиции
+func (t *offsetTracker) add(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.pending = append(t.pending, offset)
+}
+
+// отмечает сообщение обработанным; возвращает следующее смещение для коммита,
+// если непрерывный префикс обработанных сообщений вырос
+func (t *offsetTracker) complete(offset int64) (int64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.done[offset] = true
+
+	advanced := false
+	var next int64
+	for len(t.pending) > 0 && t.done[t.pending[0]] && (t.stop < 0 || t.pending[0] < t.stop) {
+		next = t.pending[0] + 1
+		delete(t.done, t.pending[0])
+		t.pending = t.pending[1:]
+		advanced = true
+	}
+
+	return next, advanced
+}
+
+// отмечает сообщение необработанным; смещение дальше него больше не сдвигается
+func (t *offsetTracker) fail(offset int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Сообщения после offset будут прочитаны заново после ребаланса
+	if t.stop < 0 || offset < t.stop {
+		t.stop = offset
+	}
+}
@@ -0,0 +1,366 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOffsetTracker(t *testing.T) {
+	type step struct {
+		op     string // add, complete или fail
+		offset int64
+		next   int64
+		ok     bool
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "InOrder",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "complete", offset: 10, next: 11, ok: true},
+				{op: "complete", offset: 11, next: 12, ok: true},
+				{op: "complete", offset: 12, next: 13, ok: true},
+			},
+		},
+		{
+			name: "OutOfOrder",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "complete", offset: 12},
+				{op: "complete", offset: 11},
+				{op: "complete", offset: 10, next: 13, ok: true},
+			},
+		},
+		{
+			name: "GapInMiddle",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "add", offset: 13},
+				{op: "complete", offset: 10, next: 11, ok: true},
+				{op: "complete", offset: 12},
+				{op: "complete", offset: 13},
+				{op: "complete", offset: 11, next: 14, ok: true},
+			},
+		},
+		{
+			name: "FailureBlocksWatermark",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "fail", offset: 11},
+				{op: "complete", offset: 12},
+				{op: "complete", offset: 10, next: 11, ok: true},
+			},
+		},
+		{
+			name: "FailureAtHead",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "fail", offset: 10},
+				{op: "complete", offset: 11},
+			},
+		},
+		{
+			name: "StopDrainsEarlierOffsets",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "add", offset: 13},
+				{op: "fail", offset: 13},
+				{op: "complete", offset: 11},
+				{op: "complete", offset: 12},
+				{op: "complete", offset: 10, next: 13, ok: true},
+			},
+		},
+		{
+			name: "LowerFailureMovesStop",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "add", offset: 13},
+				{op: "fail", offset: 12},
+				{op: "fail", offset: 11},
+				{op: "complete", offset: 10, next: 11, ok: true},
+				{op: "complete", offset: 13},
+			},
+		},
+		{
+			name: "HigherFailureKeepsStop",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "add", offset: 12},
+				{op: "add", offset: 13},
+				{op: "fail", offset: 11},
+				{op: "fail", offset: 13},
+				{op: "complete", offset: 12},
+				{op: "complete", offset: 10, next: 11, ok: true},
+			},
+		},
+		{
+			name: "CompletedAfterStopNeverCommitted",
+			steps: []step{
+				{op: "add", offset: 10},
+				{op: "add", offset: 11},
+				{op: "fail", offset: 10},
+				{op: "add", offset: 12},
+				{op: "complete", offset: 11},
+				{op: "complete", offset: 12},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := newOffsetTracker("events", 0)
+			for i, s := range tt.steps {
+				switch s.op {
+				case "add":
+					tracker.add(s.offset)
+				case "fail":
+					tracker.fail(s.offset)
+				case "complete":
+					next, ok := tracker.complete(s.offset)
+					assert.Equal(t, s.ok, ok, "step %d: complete(%d)", i, s.offset)
+					if s.ok {
+						assert.Equal(t, s.next, next, "step %d: complete(%d)", i, s.offset)
+					}
+				default:
+					t.Fatalf("unknown op %q", s.op)
+				}
+			}
+		})
+	}
+}
+
+func TestWorkerPoolQueueIndex(t *testing.T) {
+	pool := &workerPool{queues: make([]chan *sarama.ConsumerMessage, 4)}
+
+	tests := []struct {
+		name   string
+		key    []byte
+		offset int64
+		want   int
+	}{
+		{name: "NoKeyByOffset", offset: 6, want: 2},
+		{name: "NoKeyNextOffset", offset: 7, want: 3},
+		{name: "KeyIgnoresOffset", key: []byte("user_1"), offset: 6, want: fnvIndex("user_1", 4)},
+		{name: "SameKeyOtherOffset", key: []byte("user_1"), offset: 1000, want: fnvIndex("user_1", 4)},
+		{name: "OtherKey", key: []byte("user_2"), offset: 6, want: fnvIndex("user_2", 4)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := &sarama.ConsumerMessage{Key: tt.key, Offset: tt.offset}
+			assert.Equal(t, tt.want, pool.queueIndex(message))
+		})
+	}
+}
+
+func TestWorkerPoolKeyOrdering(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers int
+		depth   int
+	}{
+		{name: "SingleWorker", workers: 1, depth: 1},
+		{name: "ManyWorkers", workers: 4, depth: 2},
+		{name: "MoreWorkersThanKeys", workers: 16, depth: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newOrderHandler(-1)
+			session := newTestSession()
+			pool := newWorkerPool(testConsumer(handler, tt.workers, tt.depth), session, testClaim{topic: "events"})
+
+			const messages = 200
+			for offset := int64(0); offset < messages; offset++ {
+				message := &sarama.ConsumerMessage{
+					Topic:  "events",
+					Key:    []byte(fmt.Sprintf("user_%d", offset%5)),
+					Offset: offset,
+				}
+				require.True(t, pool.dispatch(message))
+			}
+			pool.close()
+
+			assert.Len(t, handler.seen, 5)
+			for key, offsets := range handler.seen {
+				assert.Len(t, offsets, messages/5, "key %s", key)
+				assert.IsIncreasing(t, offsets, "key %s", key)
+			}
+			assert.Equal(t, int64(messages), session.marked())
+		})
+	}
+}
+
+func TestWorkerPoolFailureHoldsOffset(t *testing.T) {
+	// Сообщение 5 не обрабатывается и не перекладывается в dead-letter топик
+	handler := newOrderHandler(5)
+	consumer := testConsumer(handler, 3, 4)
+	consumer.deadLetters = failingDeadLetters{}
+
+	session := newTestSession()
+	pool := newWorkerPool(consumer, session, testClaim{topic: "events"})
+	for offset := int64(0); offset < 10; offset++ {
+		require.True(t, pool.dispatch(&sarama.ConsumerMessage{Topic: "events", Offset: offset}))
+	}
+
+	// Воркер сообщения 5 повторяет отправку, остальные воркеры обрабатывают
+	// свои сообщения, кроме 8 из очереди за ним
+	require.Eventually(t, func() bool {
+		return handler.count() == 9
+	}, 5*time.Second, time.Millisecond)
+	assert.Equal(t, int64(5), session.marked())
+
+	// После завершения сессии смещение остается на первом необработанном сообщении
+	session.cancel()
+	pool.close()
+	assert.Equal(t, int64(5), session.marked())
+}
+
+func fnvIndex(key string, queues int) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+	return int(hash.Sum32() % uint32(queues))
+}
+
+func testConsumer(handler MessageHandler, workers, depth int) *Consumer {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	return &Consumer{
+		logger:       logger,
+		handler:      handler,
+		deliveryMode: DeliveryModeForward,
+		backoff:      time.Millisecond,
+		maxBackoff:   5 * time.Millisecond,
+		workers:      workers,
+		queueDepth:   depth,
+		pauses:       make(map[string]map[int32]int),
+		adminPaused:  make(map[string]map[int32]bool),
+	}
+}
+
+// запоминает порядок смещений по ключам и возвращает ошибку для failOffset;
+// случайная пауза перемешивает воркеры
+type orderHandler struct {
+	failOffset int64
+
+	mu   sync.Mutex
+	seen map[string][]int64
+}
+
+func newOrderHandler(failOffset int64) *orderHandler {
+	return &orderHandler{failOffset: failOffset, seen: make(map[string][]int64)}
+}
+
+func (h *orderHandler) HandleMessage(ctx context.Context, message *sarama.ConsumerMessage) error {
+	time.Sleep(time.Duration(rand.Intn(200)) * time.Microsecond)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seen[string(message.Key)] = append(h.seen[string(message.Key)], message.Offset)
+	if message.Offset == h.failOffset {
+		return errors.New("handler failed")
+	}
+	return nil
+}
+
+func (h *orderHandler) count() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	total := 0
+	for _, offsets := range h.seen {
+		total += len(offsets)
+	}
+	return total
+}
+
+// dead-letter очередь, которая всегда недоступна
+type failingDeadLetters struct {
+	DeadLetterQueueInterface
+}
+
+func (failingDeadLetters) Publish(ctx context.Context, message *sarama.ConsumerMessage, cause error) error {
+	return errors.New("dead-letter topic unavailable")
+}
+
+type testClaim struct {
+	topic     string
+	partition int32
+}
+
+func (c testClaim) Topic() string                            { return c.topic }
+func (c testClaim) Partition() int32                         { return c.partition }
+func (c testClaim) InitialOffset() int64                     { return 0 }
+func (c testClaim) HighWaterMarkOffset() int64               { return 0 }
+func (c testClaim) Messages() <-chan *sarama.ConsumerMessage { return nil }
+
+// сессия, которая запоминает наибольшее отмеченное смещение
+type testSession struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu     sync.Mutex
+	offset int64
+}
+
+func newTestSession() *testSession {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &testSession{ctx: ctx, cancel: cancel, offset: -1}
+}
+
+func (s *testSession) marked() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.offset
+}
+
+func (s *testSession) Claims() map[string][]int32 { return nil }
+func (s *testSession) MemberID() string           { return "test" }
+func (s *testSession) GenerationID() int32        { return 1 }
+func (s *testSession) Commit()                    {}
+func (s *testSession) Context() context.Context   { return s.ctx }
+
+func (s *testSession) MarkOffset(topic string, partition int32, offset int64, metadata string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offset > s.offset {
+		s.offset = offset
+	}
+}
+
+func (s *testSession) ResetOffset(topic string, partition int32, offset int64, metadata string) {}
+
+func (s *testSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.MarkOffset(msg.Topic, msg.Partition, msg.Offset+1, metadata)
+}
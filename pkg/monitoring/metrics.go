@@ -45,7 +45,7 @@ var (
 			Name: "redis_operations_total",
 			Help: "Total number of Redis operations",
 		},
-		[]string{"operation", "status"},
+		[]string{"operation", "status", "key_class"},
 	)
 
 	RedisOperationDuration = promauto.NewHistogramVec(
@@ -54,7 +54,23 @@ var (
 			Help:    "Redis operation duration in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"operation"},
+		[]string{"operation", "key_class"},
+	)
+
+	RedisPoolIdleConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "redis_pool_idle_connections",
+			Help: "Number of idle connections in the Redis pool",
+		},
+		[]string{"client"},
+	)
+
+	RedisPoolTotalConnections = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "redis_pool_total_connections",
+			Help: "Number of total connections in the Redis pool",
+		},
+		[]string{"client"},
 	)
 
 	PostgresQueriesTotal = promauto.NewCounterVec(
@@ -82,6 +98,22 @@ var (
 		[]string{"event_type", "service", "status"},
 	)
 
+	EventsDuplicateTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_duplicate_total",
+			Help: "Total number of redelivered events skipped as already processed",
+		},
+		[]string{"event_type"},
+	)
+
+	EventsRateLimitedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "events_rate_limited_total",
+			Help: "Total number of events rejected by rate limits",
+		},
+		[]string{"key_by", "event_type"},
+	)
+
 	TransactionsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "transactions_total",
@@ -113,4 +145,20 @@ var (
 		},
 		[]string{"service"},
 	)
+
+	KafkaConsumerLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Kafka consumer group lag in messages per partition",
+		},
+		[]string{"group", "topic", "partition"},
+	)
+
+	KafkaConsumerGroupLag = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_group_lag",
+			Help: "Total Kafka consumer group lag in messages",
+		},
+		[]string{"group"},
+	)
 )
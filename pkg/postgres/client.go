@@ -49,9 +49,12 @@ func (c *Client) CreateTransactionTable() error {
 		service VARCHAR(50) NOT NULL,
 		event_id VARCHAR(100),
 		error_msg TEXT,
+		request_id VARCHAR(100),
 		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 		updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
-	);`
+	);
+	ALTER TABLE transactions ADD COLUMN IF NOT EXISTS request_id VARCHAR(100);
+	CREATE INDEX IF NOT EXISTS idx_transactions_request_id ON transactions(request_id);`
 
 	_, err := c.db.Exec(query)
 	if err != nil {
@@ -63,13 +66,62 @@ func (c *Client) CreateTransactionTable() error {
 	return nil
 }
 
+func (c *Client) CreateHealthCheckTable() error {
+	query := `
+	CREATE TABLE IF NOT EXISTS health_checks (
+		id SERIAL PRIMARY KEY,
+		service_name VARCHAR(50) NOT NULL,
+		status VARCHAR(20) NOT NULL CHECK (status IN ('healthy', 'unhealthy', 'degraded')),
+		response_time_ms INTEGER,
+		error_message TEXT,
+		details JSONB,
+		timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+		created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+	);
+	ALTER TABLE health_checks ADD COLUMN IF NOT EXISTS details JSONB;
+	CREATE INDEX IF NOT EXISTS idx_health_checks_service ON health_checks(service_name);
+	CREATE INDEX IF NOT EXISTS idx_health_checks_timestamp ON health_checks(timestamp);`
+
+	_, err := c.db.Exec(query)
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to create health_checks table")
+		return err
+	}
+
+	c.logger.Info("Health checks table created successfully")
+	return nil
+}
+
+func (c *Client) InsertHealthCheck(check *models.HealthCheck) error {
+	query := `
+	INSERT INTO health_checks (service_name, status, response_time_ms, error_message, details, timestamp)
+	VALUES ($1, $2, $3, $4, $5, $6)`
+
+	// Пустой отчет сохраняем как NULL, а не как невалидный JSON
+	var details interface{}
+	if len(check.Details) > 0 {
+		details = []byte(check.Details)
+	}
+
+	_, err := c.db.Exec(query, check.ServiceName, check.Status, check.ResponseTime,
+		check.ErrorMsg, details, check.Timestamp)
+
+	if err != nil {
+		c.logger.WithError(err).Error("Failed to insert health check")
+		return err
+	}
+
+	c.logger.WithField("service_name", check.ServiceName).Debug("Health check inserted successfully")
+	return nil
+}
+
 func (c *Client) InsertTransaction(tx *models.Transaction) error {
 	query := `
-	INSERT INTO transactions (timestamp, kafka_status, redis_status, duration_ms, service, event_id, error_msg)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	INSERT INTO transactions (timestamp, kafka_status, redis_status, duration_ms, service, event_id, error_msg, request_id)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
 
 	_, err := c.db.Exec(query, tx.Timestamp, tx.KafkaStatus, tx.RedisStatus,
-		tx.Duration, tx.Service, tx.EventID, tx.ErrorMsg)
+		tx.Duration, tx.Service, tx.EventID, tx.ErrorMsg, tx.RequestID)
 
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to insert transaction")
@@ -81,7 +133,8 @@ func (c *Client) InsertTransaction(tx *models.Transaction) error {
 }
 
 func (c *Client) GetTransactions(limit int) ([]*models.Transaction, error) {
-	query := `SELECT id, timestamp, kafka_status, redis_status, duration_ms, service, event_id, error_msg
+	query := `SELECT id, timestamp, kafka_status, redis_status, duration_ms, service, event_id, error_msg,
+			  COALESCE(request_id, '')
 			  FROM transactions ORDER BY timestamp DESC LIMIT $1`
 
 	rows, err := c.db.Query(query, limit)
@@ -94,7 +147,7 @@ func (c *Client) GetTransactions(limit int) ([]*models.Transaction, error) {
 	for rows.Next() {
 		tx := &models.Transaction{}
 		err := rows.Scan(&tx.ID, &tx.Timestamp, &tx.KafkaStatus, &tx.RedisStatus,
-			&tx.Duration, &tx.Service, &tx.EventID, &tx.ErrorMsg)
+			&tx.Duration, &tx.Service, &tx.EventID, &tx.ErrorMsg, &tx.RequestID)
 		if err != nil {
 			return nil, err
 		}
@@ -9,5 +9,7 @@ type ClientInterface interface {
 	GetTransactions(limit int) ([]*models.Transaction, error)
 	GetTransactionStats() (map[string]interface{}, error)
 	CreateTransactionTable() error
+	InsertHealthCheck(check *models.HealthCheck) error
+	CreateHealthCheckTable() error
 	Close() error
 }
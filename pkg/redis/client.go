@@ -2,7 +2,7 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis/v8"
@@ -10,8 +10,15 @@ import (
 )
 
 type Client struct {
-	client *redis.Client
+	client redis.UniversalClient
+	// клиент для Get; совпадает с client, если чтение с реплик выключено
+	reader redis.UniversalClient
+	codec  *valueCodec
 	logger *logrus.Logger
+
+	// останавливает экспорт статистики пула
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 func NewClient(addr, password string, db int, logger *logrus.Logger) *Client {
@@ -21,15 +28,51 @@ func NewClient(addr, password string, db int, logger *logrus.Logger) *Client {
 		DB:       db,
 	})
 
-	return &Client{
-		client: rdb,
+	return newClient(rdb, rdb, &valueCodec{codec: codecIDJSON}, defaultPoolStatsInterval, logger)
+}
+
+// создает клиент в режиме standalone, sentinel или cluster с выбранным узлом для чтения
+func NewClientFromConfig(config *Config, logger *logrus.Logger) (*Client, error) {
+	codec, err := newValueCodec(config.Codec, config.Compression, config.CompressionThreshold)
+	if err != nil {
+		return nil, err
+	}
+	client, reader, err := config.clients()
+	if err != nil {
+		return nil, err
+	}
+
+	interval := config.PoolStatsInterval
+	if interval <= 0 {
+		interval = defaultPoolStatsInterval
+	}
+	return newClient(client, reader, codec, interval, logger), nil
+}
+
+// подключает метрики команд и запускает экспорт статистики пулов
+func newClient(client, reader redis.UniversalClient, codec *valueCodec, interval time.Duration, logger *logrus.Logger) *Client {
+	pools := map[string]redis.UniversalClient{clientPrimary: client}
+	client.AddHook(metricsHook{})
+	if reader != client {
+		pools[clientReplica] = reader
+		reader.AddHook(metricsHook{})
+	}
+
+	c := &Client{
+		client: client,
+		reader: reader,
+		codec:  codec,
 		logger: logger,
+		done:   make(chan struct{}),
 	}
+	poolCounters.add(c, pools)
+	go exportPoolStats(pools, interval, c.done)
+	return c
 }
 
-// сохраняет значение в Redis с TTL
+// сохраняет значение в Redis с TTL в формате клиента
 func (c *Client) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
-	data, err := json.Marshal(value)
+	data, err := c.codec.encode(value)
 	if err != nil {
 		c.logger.WithError(err).Error("Failed to marshal value for Redis")
 		return err
@@ -45,9 +88,13 @@ func (c *Client) Set(ctx context.Context, key string, value interface{}, expirat
 	return nil
 }
 
-// получает значение из Redis и десериализует в dest
+// получает значение из Redis и десериализует в dest по метке формата значения
 func (c *Client) Get(ctx context.Context, key string, dest interface{}) error {
-	val, err := c.client.Get(ctx, key).Result()
+	val, err := c.reader.Get(ctx, key).Result()
+	if err == redis.Nil && c.reader != c.client {
+		// Реплика может отставать от primary: только что записанный ключ ищем на primary
+		val, err = c.client.Get(ctx, key).Result()
+	}
 	if err != nil {
 		if err == redis.Nil {
 			c.logger.WithField("key", key).Debug("Redis key not found")
@@ -57,7 +104,7 @@ func (c *Client) Get(ctx context.Context, key string, dest interface{}) error {
 		return err
 	}
 
-	err = json.Unmarshal([]byte(val), dest)
+	err = c.codec.decode([]byte(val), dest)
 	if err != nil {
 		c.logger.WithError(err).WithField("key", key).Error("Failed to unmarshal Redis value")
 		return err
@@ -67,6 +114,93 @@ func (c *Client) Get(ctx context.Context, key string, dest interface{}) error {
 	return nil
 }
 
+// получает значения ключей одним pipeline и десериализует каждое найденное в dest(key);
+// возвращает ключи, которых нет в Redis. Pipeline, в отличие от MGET, работает
+// и в режиме cluster, где ключи лежат в разных слотах
+func (c *Client) GetMany(ctx context.Context, keys []string, dest func(key string) interface{}) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	values, err := getPipelined(ctx, c.reader, keys)
+	if err != nil {
+		c.logger.WithError(err).WithField("keys", len(keys)).Error("Failed to get Redis keys")
+		return nil, err
+	}
+
+	var missing []string
+	for i, key := range keys {
+		if values[i] == nil {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 && c.reader != c.client {
+		// Реплика может отставать от primary: ненайденные ключи ищем на primary
+		primaryValues, err := getPipelined(ctx, c.client, missing)
+		if err != nil {
+			c.logger.WithError(err).WithField("keys", len(missing)).Error("Failed to get Redis keys")
+			return nil, err
+		}
+		found := make(map[string][]byte, len(missing))
+		for i, key := range missing {
+			if primaryValues[i] != nil {
+				found[key] = primaryValues[i]
+			}
+		}
+		for i, key := range keys {
+			if value, ok := found[key]; ok {
+				values[i] = value
+			}
+		}
+	}
+
+	missing = nil
+	for i, key := range keys {
+		if values[i] == nil {
+			missing = append(missing, key)
+			continue
+		}
+		if err := c.codec.decode(values[i], dest(key)); err != nil {
+			c.logger.WithError(err).WithField("key", key).Error("Failed to unmarshal Redis value")
+			return nil, err
+		}
+	}
+
+	c.logger.WithFields(logrus.Fields{
+		"keys":    len(keys),
+		"missing": len(missing),
+	}).Debug("Successfully retrieved Redis keys")
+	return missing, nil
+}
+
+// выполняет GET ключей одним pipeline; для отсутствующих ключей значение nil
+func getPipelined(ctx context.Context, client redis.UniversalClient, keys []string) ([][]byte, error) {
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err := client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	// Pipeline возвращает ошибку первой неудачной команды, в том числе redis.Nil
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	values := make([][]byte, len(keys))
+	for i, cmd := range cmds {
+		data, err := cmd.Bytes()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		values[i] = data
+	}
+	return values, nil
+}
+
 // удаляет ключ из Redis
 func (c *Client) Delete(ctx context.Context, key string) error {
 	err := c.client.Del(ctx, key).Err()
@@ -94,6 +228,22 @@ func (c *Client) Ping(ctx context.Context) error {
 	return c.client.Ping(ctx).Err()
 }
 
+// возвращает клиент primary для команд, которых нет в Client, например потоков;
+// команды учитываются в метриках Redis
+func (c *Client) Primary() redis.UniversalClient {
+	return c.client
+}
+
 func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		poolCounters.remove(c)
+	})
+
+	if c.reader != c.client {
+		if err := c.reader.Close(); err != nil {
+			c.logger.WithError(err).Error("Failed to close Redis replica client")
+		}
+	}
 	return c.client.Close()
 }
@@ -0,0 +1,223 @@
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+)
+
+// форматы значений, которые Client сохраняет через Set
+const (
+	CodecJSON    = "json"
+	CodecMsgpack = "msgpack"
+	// Для proto.Message и значений с MarshalProto, например models.Event;
+	// остальные значения сохраняются в JSON
+	CodecProtobuf = "protobuf"
+)
+
+// алгоритмы сжатия значений
+const (
+	CompressionNone   = "none"
+	CompressionZstd   = "zstd"
+	CompressionSnappy = "snappy"
+)
+
+// метка формата в начале значения: байт 0xFF, байт кодека и байт сжатия.
+// JSON не может начинаться с 0xFF, поэтому значения без метки - это JSON,
+// записанный до появления кодеков; несжатый JSON и сейчас пишется без метки
+const (
+	formatMarker     byte = 0xFF
+	formatHeaderSize      = 3
+)
+
+const (
+	codecIDJSON byte = iota + 1
+	codecIDMsgpack
+	codecIDProtobuf
+)
+
+const (
+	compressionIDNone byte = iota
+	compressionIDZstd
+	compressionIDSnappy
+)
+
+// значение, которое умеет кодировать себя в protobuf через конвертацию
+// в сгенерированное сообщение, как kafka.ProtoMarshaler
+type protoMarshaler interface {
+	MarshalProto() ([]byte, error)
+}
+
+// значение, которое умеет заполнить себя из protobuf, как kafka.ProtoUnmarshaler
+type protoUnmarshaler interface {
+	UnmarshalProto(data []byte) error
+}
+
+var msgpackHandle = newMsgpackHandle()
+
+// кодирует msgpack с учетом тегов json; вложенные объекты читаются как map[string]interface{}
+func newMsgpackHandle() *codec.MsgpackHandle {
+	handle := &codec.MsgpackHandle{WriteExt: true}
+	handle.RawToString = true
+	handle.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	return handle
+}
+
+// кодеки zstd создаются при первом использовании
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+func zstdCodecs() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		if zstdEncoder, zstdErr = zstd.NewWriter(nil); zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil)
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// сериализует значения кэша выбранным кодеком и сжимает крупные значения;
+// читает значения в любом формате по их метке
+type valueCodec struct {
+	codec       byte
+	compression byte
+	threshold   int
+}
+
+func newValueCodec(codecName, compression string, threshold int) (*valueCodec, error) {
+	c := &valueCodec{threshold: threshold}
+
+	switch codecName {
+	case "", CodecJSON:
+		c.codec = codecIDJSON
+	case CodecMsgpack:
+		c.codec = codecIDMsgpack
+	case CodecProtobuf:
+		c.codec = codecIDProtobuf
+	default:
+		return nil, fmt.Errorf("unknown redis codec: %s", codecName)
+	}
+
+	switch compression {
+	case "", CompressionNone:
+		c.compression = compressionIDNone
+	case CompressionZstd:
+		c.compression = compressionIDZstd
+	case CompressionSnappy:
+		c.compression = compressionIDSnappy
+	default:
+		return nil, fmt.Errorf("unknown redis compression: %s", compression)
+	}
+	return c, nil
+}
+
+func (c *valueCodec) encode(value interface{}) ([]byte, error) {
+	codecID := c.codec
+	var data []byte
+	var err error
+	switch codecID {
+	case codecIDMsgpack:
+		err = codec.NewEncoderBytes(&data, msgpackHandle).Encode(value)
+	case codecIDProtobuf:
+		switch v := value.(type) {
+		case proto.Message:
+			data, err = proto.Marshal(v)
+		case protoMarshaler:
+			data, err = v.MarshalProto()
+		default:
+			codecID = codecIDJSON
+			data, err = json.Marshal(value)
+		}
+	default:
+		data, err = json.Marshal(value)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	compressionID := compressionIDNone
+	if c.compression != compressionIDNone && len(data) >= c.threshold {
+		if data, err = compress(c.compression, data); err != nil {
+			return nil, err
+		}
+		compressionID = c.compression
+	}
+
+	if codecID == codecIDJSON && compressionID == compressionIDNone {
+		return data, nil
+	}
+	return append([]byte{formatMarker, codecID, compressionID}, data...), nil
+}
+
+func (c *valueCodec) decode(data []byte, dest interface{}) error {
+	if len(data) < formatHeaderSize || data[0] != formatMarker {
+		return json.Unmarshal(data, dest)
+	}
+
+	codecID, compressionID := data[1], data[2]
+	payload, err := decompress(compressionID, data[formatHeaderSize:])
+	if err != nil {
+		return err
+	}
+
+	switch codecID {
+	case codecIDJSON:
+		return json.Unmarshal(payload, dest)
+	case codecIDMsgpack:
+		return codec.NewDecoderBytes(payload, msgpackHandle).Decode(dest)
+	case codecIDProtobuf:
+		switch v := dest.(type) {
+		case proto.Message:
+			return proto.Unmarshal(payload, v)
+		case protoUnmarshaler:
+			return v.UnmarshalProto(payload)
+		default:
+			return fmt.Errorf("protobuf value requires proto.Message or UnmarshalProto destination, got %T", dest)
+		}
+	default:
+		return fmt.Errorf("unknown redis value codec: %d", codecID)
+	}
+}
+
+func compress(compressionID byte, data []byte) ([]byte, error) {
+	switch compressionID {
+	case compressionIDZstd:
+		encoder, _, err := zstdCodecs()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, nil), nil
+	case compressionIDSnappy:
+		return snappy.Encode(nil, data), nil
+	default:
+		return data, nil
+	}
+}
+
+func decompress(compressionID byte, data []byte) ([]byte, error) {
+	switch compressionID {
+	case compressionIDNone:
+		return data, nil
+	case compressionIDZstd:
+		_, decoder, err := zstdCodecs()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeAll(data, nil)
+	case compressionIDSnappy:
+		return snappy.Decode(nil, data)
+	default:
+		return nil, fmt.Errorf("unknown redis value compression: %d", compressionID)
+	}
+}
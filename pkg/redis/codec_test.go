@@ -0,0 +1,222 @@
+package redis
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type codecTestValue struct {
+	ID     string                 `json:"id"`
+	Count  int                    `json:"count"`
+	Tags   []string               `json:"tags"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// кодирует себя в protobuf через сгенерированное сообщение, как models.Event
+type protoTestValue struct {
+	ID string
+}
+
+func (v *protoTestValue) MarshalProto() ([]byte, error) {
+	return proto.Marshal(wrapperspb.String(v.ID))
+}
+
+func (v *protoTestValue) UnmarshalProto(data []byte) error {
+	var message wrapperspb.StringValue
+	if err := proto.Unmarshal(data, &message); err != nil {
+		return err
+	}
+	v.ID = message.Value
+	return nil
+}
+
+func TestValueCodecRoundTrip(t *testing.T) {
+	value := codecTestValue{
+		ID:     "event_1",
+		Count:  3,
+		Tags:   []string{"a", "b"},
+		Fields: map[string]interface{}{"page": "/home", "nested": map[string]interface{}{"x": "y"}},
+	}
+
+	codecs := []string{CodecJSON, CodecMsgpack, CodecProtobuf}
+	compressions := []string{CompressionNone, CompressionZstd, CompressionSnappy}
+	codecIDs := map[string]byte{CodecJSON: codecIDJSON, CodecMsgpack: codecIDMsgpack, CodecProtobuf: codecIDProtobuf}
+	compressionIDs := map[string]byte{CompressionNone: compressionIDNone, CompressionZstd: compressionIDZstd, CompressionSnappy: compressionIDSnappy}
+
+	for _, codecName := range codecs {
+		for _, compression := range compressions {
+			t.Run(codecName+"/"+compression, func(t *testing.T) {
+				c, err := newValueCodec(codecName, compression, 0)
+				require.NoError(t, err)
+
+				t.Run("Struct", func(t *testing.T) {
+					data, err := c.encode(value)
+					require.NoError(t, err)
+
+					// Non-proto values fall back to JSON under the protobuf codec
+					wantCodec := codecIDs[codecName]
+					if codecName == CodecProtobuf {
+						wantCodec = codecIDJSON
+					}
+					assertFormat(t, data, wantCodec, compressionIDs[compression])
+
+					var got codecTestValue
+					require.NoError(t, c.decode(data, &got))
+					assert.Equal(t, value, got)
+				})
+
+				if codecName != CodecProtobuf {
+					return
+				}
+				t.Run("ProtoMessage", func(t *testing.T) {
+					data, err := c.encode(wrapperspb.String("event_1"))
+					require.NoError(t, err)
+					assertFormat(t, data, codecIDProtobuf, compressionIDs[compression])
+
+					got := &wrapperspb.StringValue{}
+					require.NoError(t, c.decode(data, got))
+					assert.True(t, proto.Equal(wrapperspb.String("event_1"), got))
+				})
+				t.Run("ProtoMarshaler", func(t *testing.T) {
+					data, err := c.encode(&protoTestValue{ID: "event_1"})
+					require.NoError(t, err)
+					assertFormat(t, data, codecIDProtobuf, compressionIDs[compression])
+
+					var got protoTestValue
+					require.NoError(t, c.decode(data, &got))
+					assert.Equal(t, protoTestValue{ID: "event_1"}, got)
+				})
+			})
+		}
+	}
+}
+
+func TestValueCodecThreshold(t *testing.T) {
+	c, err := newValueCodec(CodecJSON, CompressionZstd, 64)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name            string
+		value           string
+		wantCompression bool
+	}{
+		{name: "BelowThreshold", value: "short"},
+		{name: "AtThreshold", value: strings.Repeat("x", 62), wantCompression: true},
+		{name: "AboveThreshold", value: strings.Repeat("x", 1024), wantCompression: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := c.encode(tt.value)
+			require.NoError(t, err)
+
+			if tt.wantCompression {
+				assertFormat(t, data, codecIDJSON, compressionIDZstd)
+			} else {
+				// Uncompressed JSON is written without a format marker
+				raw, err := json.Marshal(tt.value)
+				require.NoError(t, err)
+				assert.Equal(t, raw, data)
+			}
+
+			var got string
+			require.NoError(t, c.decode(data, &got))
+			assert.Equal(t, tt.value, got)
+		})
+	}
+}
+
+func TestValueCodecDecode(t *testing.T) {
+	c, err := newValueCodec(CodecMsgpack, CompressionSnappy, 0)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    map[string]interface{}
+		wantErr string
+	}{
+		{
+			name: "LegacyJSON",
+			data: []byte(`{"id":"event_1","count":3}`),
+			want: map[string]interface{}{"id": "event_1", "count": float64(3)},
+		},
+		{
+			name: "MarkedUncompressedJSON",
+			data: append([]byte{formatMarker, codecIDJSON, compressionIDNone}, `{"id":"event_1"}`...),
+			want: map[string]interface{}{"id": "event_1"},
+		},
+		{
+			name:    "UnknownCodec",
+			data:    append([]byte{formatMarker, 0x7f, compressionIDNone}, `{}`...),
+			wantErr: "unknown redis value codec",
+		},
+		{
+			name:    "UnknownCompression",
+			data:    append([]byte{formatMarker, codecIDJSON, 0x7f}, `{}`...),
+			wantErr: "unknown redis value compression",
+		},
+		{
+			name:    "ProtobufIntoNonProto",
+			data:    []byte{formatMarker, codecIDProtobuf, compressionIDNone},
+			wantErr: "requires proto.Message or UnmarshalProto destination",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got map[string]interface{}
+			err := c.decode(tt.data, &got)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestNewValueCodecUnknown(t *testing.T) {
+	tests := []struct {
+		name        string
+		codec       string
+		compression string
+		wantErr     bool
+	}{
+		{name: "Defaults"},
+		{name: "UnknownCodec", codec: "avro", wantErr: true},
+		{name: "UnknownCompression", compression: "gzip", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newValueCodec(tt.codec, tt.compression, 0)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, codecIDJSON, c.codec)
+			assert.Equal(t, compressionIDNone, c.compression)
+		})
+	}
+}
+
+func assertFormat(t *testing.T, data []byte, codecID, compressionID byte) {
+	t.Helper()
+	if codecID == codecIDJSON && compressionID == compressionIDNone {
+		require.NotEmpty(t, data)
+		assert.NotEqual(t, formatMarker, data[0])
+		return
+	}
+	require.GreaterOrEqual(t, len(data), formatHeaderSize)
+	assert.Equal(t, []byte{formatMarker, codecID, compressionID}, data[:formatHeaderSize])
+}
@@ -0,0 +1,154 @@
+package redis
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// режимы развертывания Redis
+const (
+	ModeStandalone = "standalone"
+	ModeSentinel   = "sentinel"
+	ModeCluster    = "cluster"
+)
+
+// узлы, с которых читает Get
+const (
+	// Все команды выполняются на primary
+	ReadFromPrimary = "primary"
+	// Get читает с реплики, при ее недоступности - с primary
+	ReadFromReplica = "replica"
+	// Get читает с узла с наименьшей задержкой, primary или реплики
+	ReadFromNearest = "nearest"
+)
+
+// настройки подключения к Redis
+type Config struct {
+	Mode string
+
+	// Адрес сервера в режиме standalone
+	Addr string
+	// Адреса узлов для начального подключения в режиме cluster
+	ClusterAddrs []string
+
+	// Имя primary и адреса sentinel в режиме sentinel
+	MasterName       string
+	SentinelAddrs    []string
+	SentinelPassword string
+
+	Password string
+	DB       int // Не поддерживается в режиме cluster
+
+	ReadFrom string
+	Timeout  time.Duration
+
+	// Период экспорта статистики пула соединений в Prometheus; 0 - 15 секунд
+	PoolStatsInterval time.Duration
+
+	// Формат значений Set: json, msgpack или protobuf; Get читает любой формат
+	Codec string
+	// Сжатие значений не меньше CompressionThreshold байт: none, zstd или snappy
+	Compression          string
+	CompressionThreshold int
+}
+
+// возвращает настройки standalone подключения по адресу
+func DefaultConfig(addr, password string, db int) *Config {
+	return &Config{
+		Mode:     ModeStandalone,
+		Addr:     addr,
+		Password: password,
+		DB:       db,
+		ReadFrom: ReadFromPrimary,
+		Codec:    CodecJSON,
+	}
+}
+
+// создает клиент для записи и клиент для Get; без чтения с реплик это один клиент
+func (c *Config) clients() (redis.UniversalClient, redis.UniversalClient, error) {
+	switch c.Mode {
+	case "", ModeStandalone:
+		if c.ReadFrom != "" && c.ReadFrom != ReadFromPrimary {
+			return nil, nil, fmt.Errorf("read from %s is not supported in standalone mode", c.ReadFrom)
+		}
+		if c.Addr == "" {
+			return nil, nil, fmt.Errorf("redis address is required")
+		}
+		client := redis.NewClient(&redis.Options{
+			Addr:         c.Addr,
+			Password:     c.Password,
+			DB:           c.DB,
+			DialTimeout:  c.Timeout,
+			ReadTimeout:  c.Timeout,
+			WriteTimeout: c.Timeout,
+		})
+		return client, client, nil
+
+	case ModeSentinel:
+		if c.MasterName == "" || len(c.SentinelAddrs) == 0 {
+			return nil, nil, fmt.Errorf("master name and sentinel addresses are required in sentinel mode")
+		}
+		options := &redis.FailoverOptions{
+			MasterName:       c.MasterName,
+			SentinelAddrs:    c.SentinelAddrs,
+			SentinelPassword: c.SentinelPassword,
+			Password:         c.Password,
+			DB:               c.DB,
+			DialTimeout:      c.Timeout,
+			ReadTimeout:      c.Timeout,
+			WriteTimeout:     c.Timeout,
+		}
+		client := redis.NewFailoverClient(options)
+
+		switch c.ReadFrom {
+		case "", ReadFromPrimary:
+			return client, client, nil
+		case ReadFromReplica:
+			replicaOptions := *options
+			replicaOptions.SlaveOnly = true
+			return client, redis.NewFailoverClient(&replicaOptions), nil
+		case ReadFromNearest:
+			// Клиент с маршрутизацией чтения работает с primary и репликами как с одним шардом
+			nearestOptions := *options
+			nearestOptions.RouteByLatency = true
+			return client, redis.NewFailoverClusterClient(&nearestOptions), nil
+		default:
+			client.Close()
+			return nil, nil, fmt.Errorf("unknown read from option: %s", c.ReadFrom)
+		}
+
+	case ModeCluster:
+		if len(c.ClusterAddrs) == 0 {
+			return nil, nil, fmt.Errorf("cluster addresses are required in cluster mode")
+		}
+		options := &redis.ClusterOptions{
+			Addrs:        c.ClusterAddrs,
+			Password:     c.Password,
+			DialTimeout:  c.Timeout,
+			ReadTimeout:  c.Timeout,
+			WriteTimeout: c.Timeout,
+		}
+		client := redis.NewClusterClient(options)
+
+		switch c.ReadFrom {
+		case "", ReadFromPrimary:
+			return client, client, nil
+		case ReadFromReplica:
+			replicaOptions := *options
+			replicaOptions.ReadOnly = true
+			return client, redis.NewClusterClient(&replicaOptions), nil
+		case ReadFromNearest:
+			nearestOptions := *options
+			nearestOptions.RouteByLatency = true
+			return client, redis.NewClusterClient(&nearestOptions), nil
+		default:
+			client.Close()
+			return nil, nil, fmt.Errorf("unknown read from option: %s", c.ReadFrom)
+		}
+
+	default:
+		return nil, nil, fmt.Errorf("unknown redis mode: %s", c.Mode)
+	}
+}
@@ -0,0 +1,128 @@
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// результат попытки занять событие для обработки
+type DedupState int
+
+const (
+	// Событие занято этим обработчиком
+	DedupAcquired DedupState = iota
+	// Событие уже обработано в пределах окна дедупликации
+	DedupDuplicate
+	// Событие обрабатывается другим обработчиком, его аренда еще не истекла
+	DedupInProgress
+)
+
+// значение ключа обработанного события
+const dedupDone = "done"
+
+// сколько раз Acquire повторяет SETNX, если аренда истекает между SETNX и GET
+const dedupAcquireAttempts = 3
+
+// завершает обработку, только если событие все еще занято токеном
+var completeScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+	return 1
+end
+return 0
+`)
+
+// удаляет ключ, только если его значение не изменилось
+var deleteIfEqualScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// защищает от повторной обработки события по его ID: обработчик занимает ключ
+// dedup:<id> на время аренды, а после успеха атомарно помечает его обработанным
+// на окно дедупликации; если обработчик упал, ключ освобождается по истечении аренды
+type Deduplicator struct {
+	client *Client
+	window time.Duration
+	lease  time.Duration
+}
+
+func NewDeduplicator(client *Client, window, lease time.Duration) *Deduplicator {
+	return &Deduplicator{
+		client: client,
+		window: window,
+		lease:  lease,
+	}
+}
+
+// занимает событие; токен нужен для Complete и Release
+func (d *Deduplicator) Acquire(ctx context.Context, eventID string) (string, DedupState, error) {
+	token, err := newToken()
+	if err != nil {
+		return "", 0, err
+	}
+
+	key := dedupKey(eventID)
+	for attempt := 0; attempt < dedupAcquireAttempts; attempt++ {
+		acquired, err := d.client.client.SetNX(ctx, key, token, d.lease).Result()
+		if err != nil {
+			return "", 0, fmt.Errorf("failed to acquire dedup key: %w", err)
+		}
+		if acquired {
+			return token, DedupAcquired, nil
+		}
+
+		value, err := d.client.client.Get(ctx, key).Result()
+		switch {
+		case err == redis.Nil:
+			// Аренда истекла между SETNX и GET; событие снова свободно
+			continue
+		case err != nil:
+			return "", 0, fmt.Errorf("failed to read dedup key: %w", err)
+		case value == dedupDone:
+			return "", DedupDuplicate, nil
+		default:
+			return "", DedupInProgress, nil
+		}
+	}
+
+	// Ключ все время исчезает: считаем, что событие обрабатывает другой обработчик
+	return "", DedupInProgress, nil
+}
+
+// помечает событие обработанным; false, если аренда уже истекла или перехвачена
+func (d *Deduplicator) Complete(ctx context.Context, eventID, token string) (bool, error) {
+	completed, err := completeScript.Run(ctx, d.client.client, []string{dedupKey(eventID)}, token, dedupDone, d.window.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to complete dedup key: %w", err)
+	}
+	return completed == 1, nil
+}
+
+// освобождает событие после неудачной обработки, чтобы повтор не ждал конца аренды
+func (d *Deduplicator) Release(ctx context.Context, eventID, token string) error {
+	if err := deleteIfEqualScript.Run(ctx, d.client.client, []string{dedupKey(eventID)}, token).Err(); err != nil {
+		return fmt.Errorf("failed to release dedup key: %w", err)
+	}
+	return nil
+}
+
+func dedupKey(eventID string) string {
+	return "dedup:" + eventID
+}
+
+// возвращает случайный токен для значений ключей
+func newToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
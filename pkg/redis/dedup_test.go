@@ -0,0 +1,137 @@
+package redis
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicator(t *testing.T) {
+	const (
+		window = time.Hour
+		lease  = time.Minute
+	)
+	ctx := context.Background()
+
+	tests := []struct {
+		name  string
+		check func(t *testing.T, d *Deduplicator, mr *miniredis.Miniredis)
+	}{
+		{
+			name: "SecondAcquireInProgress",
+			check: func(t *testing.T, d *Deduplicator, mr *miniredis.Miniredis) {
+				token, state, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupAcquired, state)
+				assert.NotEmpty(t, token)
+
+				token, state, err = d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupInProgress, state)
+				assert.Empty(t, token)
+			},
+		},
+		{
+			name: "CompletedEventIsDuplicate",
+			check: func(t *testing.T, d *Deduplicator, mr *miniredis.Miniredis) {
+				token, _, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				completed, err := d.Complete(ctx, "event_1", token)
+				require.NoError(t, err)
+				assert.True(t, completed)
+
+				_, state, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupDuplicate, state)
+				assert.Equal(t, window, mr.TTL(dedupKey("event_1")))
+
+				// After the dedup window the event can be processed again
+				mr.FastForward(window)
+				_, state, err = d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupAcquired, state)
+			},
+		},
+		{
+			name: "CrashBeforeComplete",
+			check: func(t *testing.T, d *Deduplicator, mr *miniredis.Miniredis) {
+				crashed, _, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+
+				// The lease expires and another consumer takes the event
+				mr.FastForward(lease)
+				token, state, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupAcquired, state)
+				assert.NotEqual(t, crashed, token)
+
+				// A late completion with the expired token does not mark the event
+				completed, err := d.Complete(ctx, "event_1", crashed)
+				require.NoError(t, err)
+				assert.False(t, completed)
+				value, err := mr.Get(dedupKey("event_1"))
+				require.NoError(t, err)
+				assert.Equal(t, token, value)
+			},
+		},
+		{
+			name: "ReleaseWithOtherTokenKeepsLease",
+			check: func(t *testing.T, d *Deduplicator, mr *miniredis.Miniredis) {
+				token, _, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+
+				require.NoError(t, d.Release(ctx, "event_1", "other-token"))
+				_, state, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupInProgress, state)
+
+				require.NoError(t, d.Release(ctx, "event_1", token))
+				_, state, err = d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupAcquired, state)
+			},
+		},
+		{
+			name: "ReleaseDoesNotDropCompleted",
+			check: func(t *testing.T, d *Deduplicator, mr *miniredis.Miniredis) {
+				token, _, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				_, err = d.Complete(ctx, "event_1", token)
+				require.NoError(t, err)
+
+				require.NoError(t, d.Release(ctx, "event_1", token))
+				_, state, err := d.Acquire(ctx, "event_1")
+				require.NoError(t, err)
+				assert.Equal(t, DedupDuplicate, state)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, mr := newTestClient(t)
+			tt.check(t, NewDeduplicator(client, window, lease), mr)
+		})
+	}
+}
+
+// клиент поверх miniredis; закрывается вместе с тестом
+func newTestClient(t *testing.T) (*Client, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	rdb := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	client := newClient(rdb, rdb, &valueCodec{codec: codecIDJSON}, time.Hour, logger)
+	t.Cleanup(func() { client.Close() })
+	return client, mr
+}
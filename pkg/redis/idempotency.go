@@ -0,0 +1,113 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// запись ключа идемпотентности: отпечаток запроса и сохраненный ответ;
+// пустой Response означает, что первый запрос еще выполняется
+type IdempotencyRecord struct {
+	Fingerprint string          `json:"fingerprint"`
+	Response    json.RawMessage `json:"response,omitempty"`
+}
+
+// сколько раз Begin повторяет SETNX, если аренда истекает между SETNX и GET
+const idempotencyBeginAttempts = 3
+
+// хранит ответы запросов по ключу идемпотентности: первый запрос занимает ключ
+// на время аренды, после успеха ответ сохраняется на окно идемпотентности.
+// Ключи разных API клиентов не пересекаются
+type IdempotencyStore struct {
+	client *Client
+	window time.Duration
+	lease  time.Duration
+}
+
+func NewIdempotencyStore(client *Client, window, lease time.Duration) *IdempotencyStore {
+	return &IdempotencyStore{
+		client: client,
+		window: window,
+		lease:  lease,
+	}
+}
+
+// занимает ключ клиента client для запроса с отпечатком fingerprint; если ключ
+// уже занят, возвращает его запись и false
+func (s *IdempotencyStore) Begin(ctx context.Context, client, key, fingerprint string) (*IdempotencyRecord, bool, error) {
+	pending, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, false, err
+	}
+
+	redisKey := idempotencyKey(client, key)
+	for attempt := 0; attempt < idempotencyBeginAttempts; attempt++ {
+		acquired, err := s.client.client.SetNX(ctx, redisKey, pending, s.lease).Result()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to acquire idempotency key: %w", err)
+		}
+		if acquired {
+			return nil, true, nil
+		}
+
+		data, err := s.client.client.Get(ctx, redisKey).Bytes()
+		if err == redis.Nil {
+			// Аренда истекла между SETNX и GET; ключ снова свободен
+			continue
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read idempotency key: %w", err)
+		}
+
+		var record IdempotencyRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return nil, false, fmt.Errorf("failed to unmarshal idempotency record: %w", err)
+		}
+		return &record, false, nil
+	}
+
+	// Ключ все время исчезает: считаем, что первый запрос еще выполняется
+	return &IdempotencyRecord{Fingerprint: fingerprint}, false, nil
+}
+
+// сохраняет ответ первого запроса на окно идемпотентности
+func (s *IdempotencyStore) Save(ctx context.Context, client, key, fingerprint string, response interface{}) error {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	record, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint, Response: data})
+	if err != nil {
+		return err
+	}
+
+	if err := s.client.client.Set(ctx, idempotencyKey(client, key), record, s.window).Err(); err != nil {
+		return fmt.Errorf("failed to save idempotency record: %w", err)
+	}
+	return nil
+}
+
+// освобождает ключ после неудачного запроса, чтобы клиент мог повторить его
+func (s *IdempotencyStore) Abort(ctx context.Context, client, key, fingerprint string) error {
+	pending, err := json.Marshal(&IdempotencyRecord{Fingerprint: fingerprint})
+	if err != nil {
+		return err
+	}
+
+	// Ключ удаляется, только если в нем все еще запись выполняющегося запроса
+	if err := deleteIfEqualScript.Run(ctx, s.client.client, []string{idempotencyKey(client, key)}, pending).Err(); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// ключ в пространстве клиента; ':' в идентификаторе клиента экранируется,
+// чтобы пары клиент-ключ не совпадали
+func idempotencyKey(client, key string) string {
+	return "idempotency:" + url.QueryEscape(client) + ":" + key
+}
@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	const (
+		window = time.Hour
+		lease  = 30 * time.Second
+	)
+	ctx := context.Background()
+	response := map[string]string{"event_id": "event_1"}
+
+	t.Run("BeginSaveReplay", func(t *testing.T) {
+		client, mr := newTestClient(t)
+		store := NewIdempotencyStore(client, window, lease)
+
+		record, acquired, err := store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		assert.True(t, acquired)
+		assert.Nil(t, record)
+		assert.Equal(t, lease, mr.TTL("idempotency:mobile:1"))
+
+		// The first request is still running
+		record, acquired, err = store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		assert.False(t, acquired)
+		assert.Equal(t, &IdempotencyRecord{Fingerprint: "fp"}, record)
+
+		require.NoError(t, store.Save(ctx, "mobile", "1", "fp", response))
+		assert.Equal(t, window, mr.TTL("idempotency:mobile:1"))
+
+		record, acquired, err = store.Begin(ctx, "mobile", "1", "other")
+		require.NoError(t, err)
+		assert.False(t, acquired)
+		assert.Equal(t, "fp", record.Fingerprint)
+		assert.JSONEq(t, `{"event_id":"event_1"}`, string(record.Response))
+	})
+
+	t.Run("KeysScopedByClient", func(t *testing.T) {
+		client, _ := newTestClient(t)
+		store := NewIdempotencyStore(client, window, lease)
+
+		for _, scope := range [][2]string{{"mobile", "1"}, {"web", "1"}, {"", "1"}, {"a:b", "c"}, {"a", "b:c"}} {
+			_, acquired, err := store.Begin(ctx, scope[0], scope[1], "fp")
+			require.NoError(t, err)
+			assert.True(t, acquired, "client %q key %q", scope[0], scope[1])
+		}
+	})
+
+	t.Run("AbortReleasesPendingOnly", func(t *testing.T) {
+		client, _ := newTestClient(t)
+		store := NewIdempotencyStore(client, window, lease)
+
+		_, _, err := store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		// Another request with the same key does not release it
+		require.NoError(t, store.Abort(ctx, "mobile", "1", "other"))
+		_, acquired, err := store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		assert.False(t, acquired)
+
+		require.NoError(t, store.Abort(ctx, "mobile", "1", "fp"))
+		_, acquired, err = store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		assert.True(t, acquired)
+
+		// A saved response is kept
+		require.NoError(t, store.Save(ctx, "mobile", "1", "fp", response))
+		require.NoError(t, store.Abort(ctx, "mobile", "1", "fp"))
+		record, acquired, err := store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		assert.False(t, acquired)
+		assert.NotEmpty(t, record.Response)
+	})
+
+	t.Run("LeaseExpiry", func(t *testing.T) {
+		client, mr := newTestClient(t)
+		store := NewIdempotencyStore(client, window, lease)
+
+		_, _, err := store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		mr.FastForward(lease)
+
+		_, acquired, err := store.Begin(ctx, "mobile", "1", "fp")
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+
+	t.Run("CorruptedRecord", func(t *testing.T) {
+		client, mr := newTestClient(t)
+		store := NewIdempotencyStore(client, window, lease)
+		require.NoError(t, mr.Set("idempotency:mobile:1", "not json"))
+
+		_, _, err := store.Begin(ctx, "mobile", "1", "fp")
+		var syntaxErr *json.SyntaxError
+		assert.ErrorAs(t, err, &syntaxErr)
+	})
+}
@@ -8,8 +8,25 @@ import (
 type ClientInterface interface {
 	Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error
 	Get(ctx context.Context, key string, dest interface{}) error
+	GetMany(ctx context.Context, keys []string, dest func(key string) interface{}) ([]string, error)
 	Delete(ctx context.Context, key string) error
 	Exists(ctx context.Context, key string) (bool, error)
 	Ping(ctx context.Context) error
 	Close() error
 }
+
+type DeduplicatorInterface interface {
+	Acquire(ctx context.Context, eventID string) (string, DedupState, error)
+	Complete(ctx context.Context, eventID, token string) (bool, error)
+	Release(ctx context.Context, eventID, token string) error
+}
+
+type IdempotencyStoreInterface interface {
+	Begin(ctx context.Context, client, key, fingerprint string) (*IdempotencyRecord, bool, error)
+	Save(ctx context.Context, client, key, fingerprint string, response interface{}) error
+	Abort(ctx context.Context, client, key, fingerprint string) error
+}
+
+type RateLimiterInterface interface {
+	Allow(ctx context.Context, limits []RateLimit) (int, time.Duration, error)
+}
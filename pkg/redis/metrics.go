@@ -0,0 +1,195 @@
+package redis
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"pet-proj/pkg/monitoring"
+)
+
+// значения label client метрик пула
+const (
+	clientPrimary = "primary"
+	clientReplica = "replica"
+)
+
+// период экспорта статистики пула по умолчанию
+const defaultPoolStatsInterval = 15 * time.Second
+
+type startTimeKey struct{}
+
+// hook go-redis, который записывает длительность, результат и класс ключа каждой команды
+type metricsHook struct{}
+
+func (metricsHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startTimeKey{}, time.Now()), nil
+}
+
+func (metricsHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
+	observeCommand(cmd, sinceStart(ctx))
+	return nil
+}
+
+func (metricsHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder) (context.Context, error) {
+	return context.WithValue(ctx, startTimeKey{}, time.Now()), nil
+}
+
+// команды pipeline выполняются одним запросом, каждой записывается его длительность
+func (metricsHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder) error {
+	duration := sinceStart(ctx)
+	for _, cmd := range cmds {
+		observeCommand(cmd, duration)
+	}
+	return nil
+}
+
+func sinceStart(ctx context.Context) time.Duration {
+	start, ok := ctx.Value(startTimeKey{}).(time.Time)
+	if !ok {
+		return 0
+	}
+	return time.Since(start)
+}
+
+func observeCommand(cmd redis.Cmder, duration time.Duration) {
+	operation := cmd.Name()
+	class := keyClass(cmd)
+
+	status := "success"
+	switch err := cmd.Err(); {
+	case err == redis.Nil:
+		status = "miss"
+	case err != nil:
+		status = "failed"
+	}
+
+	monitoring.RedisOperationsTotal.WithLabelValues(operation, status, class).Inc()
+	monitoring.RedisOperationDuration.WithLabelValues(operation, class).Observe(duration.Seconds())
+}
+
+// возвращает префикс ключа до первого ':' (event, processed_event, payload);
+// полный ключ в label не попадает, чтобы не раздувать число временных рядов
+func keyClass(cmd redis.Cmder) string {
+	args := cmd.Args()
+	if len(args) < 2 {
+		return "none"
+	}
+	key, ok := args[1].(string)
+	if !ok {
+		return "none"
+	}
+	prefix, _, found := strings.Cut(key, ":")
+	if !found {
+		return "other"
+	}
+	return prefix
+}
+
+// периодически экспортирует статистику пулов соединений до закрытия done
+func exportPoolStats(clients map[string]redis.UniversalClient, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		for name, client := range clients {
+			recordPoolStats(name, client.PoolStats())
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func recordPoolStats(client string, stats *redis.PoolStats) {
+	monitoring.RedisPoolIdleConnections.WithLabelValues(client).Set(float64(stats.IdleConns))
+	monitoring.RedisPoolTotalConnections.WithLabelValues(client).Set(float64(stats.TotalConns))
+}
+
+var poolCounters = registerPoolCollector()
+
+func registerPoolCollector() *poolCollector {
+	collector := newPoolCollector()
+	prometheus.MustRegister(collector)
+	return collector
+}
+
+// экспортирует накопленные счетчики пулов go-redis (hits, misses, timeouts) как
+// counter, читая PoolStats при каждом сборе метрик. Значения закрытых клиентов
+// сохраняются, чтобы counter не уменьшался
+type poolCollector struct {
+	hits     *prometheus.Desc
+	misses   *prometheus.Desc
+	timeouts *prometheus.Desc
+
+	mu      sync.Mutex
+	pools   map[*Client]map[string]redis.UniversalClient
+	retired map[string]redis.PoolStats
+}
+
+func newPoolCollector() *poolCollector {
+	return &poolCollector{
+		hits:     prometheus.NewDesc("redis_pool_hits_total", "Number of times a free connection was found in the Redis pool", []string{"client"}, nil),
+		misses:   prometheus.NewDesc("redis_pool_misses_total", "Number of times a free connection was not found in the Redis pool", []string{"client"}, nil),
+		timeouts: prometheus.NewDesc("redis_pool_timeouts_total", "Number of times a wait for a Redis pool connection timed out", []string{"client"}, nil),
+		pools:    make(map[*Client]map[string]redis.UniversalClient),
+		retired:  make(map[string]redis.PoolStats),
+	}
+}
+
+func (p *poolCollector) add(client *Client, pools map[string]redis.UniversalClient) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pools[client] = pools
+}
+
+// переносит последние значения пулов клиента в накопленные; вызывается до закрытия пулов
+func (p *poolCollector) remove(client *Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for name, pool := range p.pools[client] {
+		p.retired[name] = addPoolStats(p.retired[name], pool.PoolStats())
+	}
+	delete(p.pools, client)
+}
+
+func (p *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- p.hits
+	ch <- p.misses
+	ch <- p.timeouts
+}
+
+func (p *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	p.mu.Lock()
+	totals := make(map[string]redis.PoolStats, len(p.retired))
+	for name, stats := range p.retired {
+		totals[name] = stats
+	}
+	for _, pools := range p.pools {
+		for name, pool := range pools {
+			totals[name] = addPoolStats(totals[name], pool.PoolStats())
+		}
+	}
+	p.mu.Unlock()
+
+	for name, stats := range totals {
+		ch <- prometheus.MustNewConstMetric(p.hits, prometheus.CounterValue, float64(stats.Hits), name)
+		ch <- prometheus.MustNewConstMetric(p.misses, prometheus.CounterValue, float64(stats.Misses), name)
+		ch <- prometheus.MustNewConstMetric(p.timeouts, prometheus.CounterValue, float64(stats.Timeouts), name)
+	}
+}
+
+func addPoolStats(total redis.PoolStats, stats *redis.PoolStats) redis.PoolStats {
+	total.Hits += stats.Hits
+	total.Misses += stats.Misses
+	total.Timeouts += stats.Timeouts
+	return total
+}
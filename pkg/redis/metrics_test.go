@@ -0,0 +1,69 @@
+package redis
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolCollector(t *testing.T) {
+	collector := newPoolCollector()
+	primary := &statsPool{stats: redis.PoolStats{Hits: 10, Misses: 2, Timeouts: 1}}
+	replica := &statsPool{stats: redis.PoolStats{Hits: 5}}
+	other := &statsPool{stats: redis.PoolStats{Hits: 3, Misses: 1}}
+
+	first, second := &Client{}, &Client{}
+	collector.add(first, map[string]redis.UniversalClient{clientPrimary: primary, clientReplica: replica})
+	collector.add(second, map[string]redis.UniversalClient{clientPrimary: other})
+
+	assertPoolCounters(t, collector, `
+redis_pool_hits_total{client="primary"} 13
+redis_pool_hits_total{client="replica"} 5
+redis_pool_misses_total{client="primary"} 3
+redis_pool_misses_total{client="replica"} 0
+redis_pool_timeouts_total{client="primary"} 1
+redis_pool_timeouts_total{client="replica"} 0
+`)
+
+	// Counters keep the values of closed clients and do not go down
+	primary.stats.Hits = 12
+	collector.remove(first)
+	primary.stats.Hits = 0
+	other.stats.Hits = 4
+
+	assertPoolCounters(t, collector, `
+redis_pool_hits_total{client="primary"} 16
+redis_pool_hits_total{client="replica"} 5
+redis_pool_misses_total{client="primary"} 3
+redis_pool_misses_total{client="replica"} 0
+redis_pool_timeouts_total{client="primary"} 1
+redis_pool_timeouts_total{client="replica"} 0
+`)
+}
+
+func assertPoolCounters(t *testing.T, collector *poolCollector, values string) {
+	t.Helper()
+	expected := `
+# HELP redis_pool_hits_total Number of times a free connection was found in the Redis pool
+# TYPE redis_pool_hits_total counter
+# HELP redis_pool_misses_total Number of times a free connection was not found in the Redis pool
+# TYPE redis_pool_misses_total counter
+# HELP redis_pool_timeouts_total Number of times a wait for a Redis pool connection timed out
+# TYPE redis_pool_timeouts_total counter
+` + values
+	assert.NoError(t, testutil.CollectAndCompare(collector, strings.NewReader(expected)))
+}
+
+// отдает заданную статистику пула
+type statsPool struct {
+	redis.UniversalClient
+	stats redis.PoolStats
+}
+
+func (p *statsPool) PoolStats() *redis.PoolStats {
+	stats := p.stats
+	return &stats
+}
@@ -0,0 +1,110 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// скользящее окно в sorted set по часам Redis, общим для всех реплик сервиса:
+// удаляет записи старше окна и, если их меньше лимита, добавляет ARGV[3];
+// с пустым ARGV[3] только проверяет квоту. При превышении возвращает время
+// до выхода старейшей записи из окна
+var slidingWindowScript = redis.NewScript(`
+redis.replicate_commands()
+
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+local window = tonumber(ARGV[1])
+local limit = tonumber(ARGV[2])
+
+redis.call("ZREMRANGEBYSCORE", KEYS[1], "-inf", now - window)
+if redis.call("ZCARD", KEYS[1]) < limit then
+	if ARGV[3] ~= "" then
+		redis.call("ZADD", KEYS[1], now, ARGV[3])
+		redis.call("PEXPIRE", KEYS[1], window)
+	end
+	return {1, 0}
+end
+
+local oldest = redis.call("ZRANGE", KEYS[1], 0, 0, "WITHSCORES")
+return {0, math.max(tonumber(oldest[2]) + window - now, 0)}
+`)
+
+// квота: не больше Limit операций за Window по ключу Key
+type RateLimit struct {
+	Key    string
+	Limit  int
+	Window time.Duration
+}
+
+// ограничивает частоту операций по ключам скользящим окном; счетчики хранятся
+// в Redis, поэтому лимит общий для всех реплик сервиса
+type RateLimiter struct {
+	client *Client
+}
+
+func NewRateLimiter(client *Client) *RateLimiter {
+	return &RateLimiter{client: client}
+}
+
+// учитывает операцию во всех квотах, только если ни одна из них не превышена.
+// Возвращает индекс превышенной квоты или -1 и время, через которое она освободится.
+// Ключи квот могут лежать на разных узлах cluster, поэтому квоты сначала проверяются,
+// а затем учитываются; квота, занятая параллельным запросом между этими шагами,
+// отменяет уже учтенную операцию
+func (l *RateLimiter) Allow(ctx context.Context, limits []RateLimit) (int, time.Duration, error) {
+	for i, limit := range limits {
+		allowed, retryAfter, err := l.run(ctx, limit, "")
+		if err != nil {
+			return -1, 0, err
+		}
+		if !allowed {
+			return i, retryAfter, nil
+		}
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return -1, 0, err
+	}
+	for i, limit := range limits {
+		allowed, retryAfter, err := l.run(ctx, limit, token)
+		if err != nil || !allowed {
+			l.release(ctx, limits[:i], token)
+		}
+		if err != nil {
+			return -1, 0, err
+		}
+		if !allowed {
+			return i, retryAfter, nil
+		}
+	}
+	return -1, 0, nil
+}
+
+func (l *RateLimiter) run(ctx context.Context, limit RateLimit, member string) (bool, time.Duration, error) {
+	result, err := slidingWindowScript.Run(ctx, l.client.client, []string{rateLimitKey(limit.Key)}, limit.Window.Milliseconds(), limit.Limit, member).Int64Slice()
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to check rate limit: %w", err)
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit result: %v", result)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// отменяет операцию, учтенную в квотах limits
+func (l *RateLimiter) release(ctx context.Context, limits []RateLimit, member string) {
+	for _, limit := range limits {
+		if err := l.client.client.ZRem(ctx, rateLimitKey(limit.Key), member).Err(); err != nil {
+			l.client.logger.WithError(err).WithField("key", limit.Key).Warn("Failed to release rate limit slot")
+		}
+	}
+}
+
+func rateLimitKey(key string) string {
+	return "ratelimit:" + key
+}
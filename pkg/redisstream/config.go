@@ -0,0 +1,150 @@
+package redisstream
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shopify/sarama"
+	goredis "github.com/go-redis/redis/v8"
+)
+
+// смещение сообщения - ID записи "<миллисекунды>-<номер>" в виде миллисекунды<<sequenceBits | номер.
+// Redis не создает 2^20 записей за миллисекунду, а миллисекунды помещаются в оставшиеся
+// 43 бита до 2248 года; ID, который так не записать, получает смещение -1
+const sequenceBits = 20
+
+// поля записи потока: ключ и тело сообщения; заголовки хранятся в полях с префиксом
+const (
+	fieldKey     = "key"
+	fieldValue   = "value"
+	headerPrefix = "h:"
+)
+
+// настройки транспорта событий через Redis Streams
+type Config struct {
+	// Приблизительная длина потока, после которой старые записи удаляются; 0 - без ограничения
+	MaxLen int64
+	// Сколько записей читать за один запрос
+	BatchSize int64
+	// Сколько ждать новых записей в XREADGROUP
+	Block time.Duration
+	// Через сколько неподтвержденная запись забирается у другого consumer группы
+	ClaimIdle time.Duration
+	// Как часто искать такие записи
+	ClaimInterval time.Duration
+	// После скольких выдач consumer группы запись перекладывается в dead-letter поток,
+	// а не обрабатывается снова; 0 - без ограничения
+	MaxDeliveries int64
+	// Ограничение одной попытки обработки; 0 - без ограничения
+	MessageTimeout time.Duration
+}
+
+// возвращает настройки по умолчанию
+func DefaultConfig() *Config {
+	return &Config{
+		MaxLen:        1000000,
+		BatchSize:     100,
+		Block:         2 * time.Second,
+		ClaimIdle:     time.Minute,
+		ClaimInterval: 30 * time.Second,
+		MaxDeliveries: 5,
+	}
+}
+
+// возвращает ключ потока для топика
+func StreamKey(topic string) string {
+	return "stream:" + topic
+}
+
+// раскладывает сообщение в поля записи потока
+func messageValues(msg *sarama.ProducerMessage) ([]interface{}, error) {
+	values := make([]interface{}, 0, 4+2*len(msg.Headers))
+	if msg.Key != nil {
+		key, err := msg.Key.Encode()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, fieldKey, key)
+	}
+
+	value, err := msg.Value.Encode()
+	if err != nil {
+		return nil, err
+	}
+	values = append(values, fieldValue, value)
+
+	for _, header := range msg.Headers {
+		values = append(values, headerPrefix+string(header.Key), header.Value)
+	}
+	return values, nil
+}
+
+// собирает сообщение для kafka.MessageHandler из записи потока; партиция всегда 0,
+// а смещение и время берутся из ID записи
+func consumerMessage(topic string, entry goredis.XMessage) *sarama.ConsumerMessage {
+	millis, sequence := parseID(entry.ID)
+	message := &sarama.ConsumerMessage{
+		Topic:     topic,
+		Offset:    entryOffset(millis, sequence),
+		Timestamp: time.UnixMilli(millis),
+	}
+
+	for field, value := range entry.Values {
+		data := []byte(stringValue(value))
+		switch {
+		case field == fieldKey:
+			message.Key = data
+		case field == fieldValue:
+			message.Value = data
+		case strings.HasPrefix(field, headerPrefix):
+			message.Headers = append(message.Headers, &sarama.RecordHeader{
+				Key:   []byte(strings.TrimPrefix(field, headerPrefix)),
+				Value: data,
+			})
+		}
+	}
+	return message
+}
+
+// разбирает ID записи вида "<миллисекунды>-<номер>"; -1, если часть ID не число int64
+func parseID(id string) (int64, int64) {
+	millisPart, sequencePart, _ := strings.Cut(id, "-")
+	millis, err := strconv.ParseInt(millisPart, 10, 64)
+	if err != nil {
+		millis = -1
+	}
+	sequence, err := strconv.ParseInt(sequencePart, 10, 64)
+	if err != nil {
+		sequence = -1
+	}
+	return millis, sequence
+}
+
+// упаковывает ID записи в смещение без потери порядка и совпадений
+func entryOffset(millis, sequence int64) int64 {
+	if millis < 0 || millis >= 1<<(63-sequenceBits) || sequence < 0 || sequence >= 1<<sequenceBits {
+		return -1
+	}
+	return millis<<sequenceBits | sequence
+}
+
+// восстанавливает ID записи из смещения для логов
+func entryID(offset int64) string {
+	if offset < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d-%d", offset>>sequenceBits, offset&(1<<sequenceBits-1))
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return ""
+	}
+}
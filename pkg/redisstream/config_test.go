@@ -0,0 +1,124 @@
+package redisstream
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageValuesRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message *sarama.ProducerMessage
+		wantKey []byte
+	}{
+		{
+			name: "KeyAndHeaders",
+			message: &sarama.ProducerMessage{
+				Key:   sarama.StringEncoder("user_1"),
+				Value: sarama.ByteEncoder(`{"id":"1"}`),
+				Headers: []sarama.RecordHeader{
+					{Key: []byte("x-request-id"), Value: []byte("req-1")},
+					{Key: []byte("content-type"), Value: []byte("application/json")},
+				},
+			},
+			wantKey: []byte("user_1"),
+		},
+		{
+			name: "NoKey",
+			message: &sarama.ProducerMessage{
+				Value: sarama.ByteEncoder("payload"),
+			},
+		},
+		{
+			name: "BinaryValue",
+			message: &sarama.ProducerMessage{
+				Key:   sarama.ByteEncoder{0x00, 0xff},
+				Value: sarama.ByteEncoder{0x01, 0x00, 0x02},
+			},
+			wantKey: []byte{0x00, 0xff},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := messageValues(tt.message)
+			require.NoError(t, err)
+			require.Zero(t, len(values)%2)
+
+			// Redis returns field values as strings
+			fields := make(map[string]interface{}, len(values)/2)
+			for i := 0; i < len(values); i += 2 {
+				fields[values[i].(string)] = string(values[i+1].([]byte))
+			}
+
+			message := consumerMessage("events", goredis.XMessage{ID: "1700000000000-3", Values: fields})
+
+			value, err := tt.message.Value.Encode()
+			require.NoError(t, err)
+			assert.Equal(t, "events", message.Topic)
+			assert.Equal(t, tt.wantKey, message.Key)
+			assert.Equal(t, value, message.Value)
+			assert.Equal(t, time.UnixMilli(1700000000000), message.Timestamp)
+
+			headers := make(map[string]string, len(message.Headers))
+			for _, header := range message.Headers {
+				headers[string(header.Key)] = string(header.Value)
+			}
+			want := make(map[string]string, len(tt.message.Headers))
+			for _, header := range tt.message.Headers {
+				want[string(header.Key)] = string(header.Value)
+			}
+			assert.Equal(t, want, headers)
+		})
+	}
+}
+
+func TestConsumerMessageOffset(t *testing.T) {
+	tests := []struct {
+		name string
+		id   string
+		want int64
+	}{
+		{name: "Zero", id: "0-0", want: 0},
+		{name: "FirstInMillisecond", id: "1700000000000-0", want: 1700000000000 << sequenceBits},
+		{name: "LargeSequence", id: "1700000000000-65536", want: 1700000000000<<sequenceBits | 65536},
+		{name: "SequenceTooLarge", id: "1700000000000-1048576", want: -1},
+		{name: "MillisTooLarge", id: "9223372036854775807-0", want: -1},
+		{name: "NotANumber", id: "abc-0", want: -1},
+		{name: "NoSequence", id: "1700000000000", want: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message := consumerMessage("events", goredis.XMessage{ID: tt.id})
+			assert.Equal(t, tt.want, message.Offset)
+		})
+	}
+}
+
+func TestEntryOffsetOrder(t *testing.T) {
+	// Offsets must follow stream order and never collide
+	ids := [][2]int64{
+		{1700000000000, 0},
+		{1700000000000, 1},
+		{1700000000000, 65535},
+		{1700000000000, 65536},
+		{1700000000000, 1<<sequenceBits - 1},
+		{1700000000001, 0},
+		{1700000000001, 1},
+	}
+
+	previous := int64(-1)
+	for _, id := range ids {
+		offset := entryOffset(id[0], id[1])
+		assert.Greater(t, offset, previous, "offset of %d-%d", id[0], id[1])
+		assert.Equal(t, fmt.Sprintf("%d-%d", id[0], id[1]), entryID(offset))
+		previous = offset
+	}
+}
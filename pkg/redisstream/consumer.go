@@ -0,0 +1,442 @@
+package redisstream
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Shopify/sarama"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/redis"
+)
+
+// пауза перед повтором команды после ошибки Redis
+const retryBackoff = time.Second
+
+// участник consumer group потоков Redis; реализует kafka.ConsumerInterface.
+// Запись подтверждается XACK после обработки; записи, которые consumer группы
+// не подтвердил за ClaimIdle, забираются XAUTOCLAIM и обрабатываются повторно
+type Consumer struct {
+	client       goredis.UniversalClient
+	config       Config
+	topics       []string
+	groupID      string
+	name         string
+	logger       *logrus.Logger
+	handler      kafka.MessageHandler
+	deliveryMode string
+	deadLetters  string
+
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// создает consumer; как и kafka.Consumer, новая группа читает только новые записи
+func NewConsumer(client *redis.Client, config *Config, topics []string, groupID string, logger *logrus.Logger) (*Consumer, error) {
+	if len(topics) == 0 {
+		return nil, fmt.Errorf("at least one topic is required")
+	}
+
+	return &Consumer{
+		client:       client.Primary(),
+		config:       *config,
+		topics:       topics,
+		groupID:      groupID,
+		name:         consumerName(),
+		logger:       logger,
+		deliveryMode: kafka.DeliveryModeForward,
+		closed:       make(chan struct{}),
+	}, nil
+}
+
+func (c *Consumer) SetHandler(handler kafka.MessageHandler) {
+	c.handler = handler
+}
+
+// задает режим доставки как у kafka.Consumer; в режиме at-least-once неудачная
+// запись не подтверждается и обрабатывается повторно через ClaimIdle, режим
+// forward требует SetDeadLetterTopic
+func (c *Consumer) SetDeliveryMode(mode string) error {
+	switch mode {
+	case kafka.DeliveryModeForward, kafka.DeliveryModeAtLeastOnce:
+	default:
+		return fmt.Errorf("unknown delivery mode: %s", mode)
+	}
+
+	c.deliveryMode = mode
+	return nil
+}
+
+// включает перекладывание необработанных записей в поток топика с заголовками kafka.Header*
+func (c *Consumer) SetDeadLetterTopic(topic string) {
+	c.deadLetters = topic
+}
+
+// создает группы и читает потоки до отмены контекста или Close
+func (c *Consumer) Start(ctx context.Context) error {
+	// В режиме forward необработанная запись подтверждается, без dead-letter потока она была бы потеряна
+	if c.deliveryMode == kafka.DeliveryModeForward && c.deadLetters == "" {
+		return fmt.Errorf("forward delivery mode requires a dead-letter topic")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-c.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for _, topic := range c.topics {
+		if err := c.createGroup(ctx, topic); err != nil {
+			c.logger.WithError(err).WithField("topic", topic).Error("Failed to create Redis stream group")
+			return err
+		}
+	}
+
+	// Потоки читаются отдельно: в режиме cluster они могут лежать на разных узлах
+	var wg sync.WaitGroup
+	for _, topic := range c.topics {
+		wg.Add(2)
+		go func(topic string) {
+			defer wg.Done()
+			c.consume(ctx, topic)
+		}(topic)
+		go func(topic string) {
+			defer wg.Done()
+			c.claimStuck(ctx, topic)
+		}(topic)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// создает группу с чтением новых записей, если ее еще нет
+func (c *Consumer) createGroup(ctx context.Context, topic string) error {
+	err := c.client.XGroupCreateMkStream(ctx, StreamKey(topic), c.groupID, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return err
+	}
+	return nil
+}
+
+// читает поток топика: сначала записи, не подтвержденные этим consumer до
+// перезапуска, затем новые записи
+func (c *Consumer) consume(ctx context.Context, topic string) {
+	stream := StreamKey(topic)
+	start := "0"
+	for ctx.Err() == nil {
+		block := c.config.Block
+		if start != ">" {
+			// Свои неподтвержденные записи возвращаются сразу, без ожидания
+			block = -1
+		}
+
+		streams, err := c.client.XReadGroup(ctx, &goredis.XReadGroupArgs{
+			Group:    c.groupID,
+			Consumer: c.name,
+			Streams:  []string{stream, start},
+			Count:    c.config.BatchSize,
+			Block:    block,
+		}).Result()
+		if err == goredis.Nil {
+			continue
+		}
+		if err != nil {
+			if ctx.Err() == nil {
+				c.logger.WithError(err).WithField("topic", topic).Error("Failed to read Redis stream")
+				c.sleep(ctx, retryBackoff)
+			}
+			continue
+		}
+
+		var entries []goredis.XMessage
+		for _, s := range streams {
+			entries = append(entries, s.Messages...)
+		}
+		redelivered := start != ">"
+		if redelivered {
+			if len(entries) == 0 {
+				start = ">"
+				continue
+			}
+			start = entries[len(entries)-1].ID
+		}
+
+		for _, entry := range entries {
+			c.process(ctx, topic, entry, redelivered)
+		}
+	}
+}
+
+// периодически забирает записи, которые другие consumer группы (или этот, в режиме
+// at-least-once) не подтвердили за ClaimIdle
+func (c *Consumer) claimStuck(ctx context.Context, topic string) {
+	if c.config.ClaimIdle <= 0 || c.config.ClaimInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(c.config.ClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		start := "0-0"
+		for ctx.Err() == nil {
+			entries, next, err := c.autoClaim(ctx, topic, start)
+			if err != nil {
+				if ctx.Err() == nil {
+					c.logger.WithError(err).WithField("topic", topic).Error("Failed to claim Redis stream entries")
+				}
+				break
+			}
+
+			if len(entries) > 0 {
+				c.logger.WithFields(logrus.Fields{
+					"topic":   topic,
+					"entries": len(entries),
+				}).Warn("Claimed stuck Redis stream entries")
+			}
+			for _, entry := range entries {
+				c.process(ctx, topic, entry, true)
+			}
+
+			if next == "0-0" {
+				break
+			}
+			start = next
+		}
+	}
+}
+
+// забирает XAUTOCLAIM записи, не подтвержденные за ClaimIdle, начиная со start;
+// возвращает записи и ID, с которого продолжать ("0-0" - поток пройден до конца).
+// Команда отправляется через Do: XAutoClaim из go-redis v8 не разбирает ответ Redis 7
+func (c *Consumer) autoClaim(ctx context.Context, topic, start string) ([]goredis.XMessage, string, error) {
+	reply, err := c.client.Do(ctx, "XAUTOCLAIM", StreamKey(topic), c.groupID, c.name,
+		c.config.ClaimIdle.Milliseconds(), start, "COUNT", c.config.BatchSize).Result()
+	if err != nil {
+		return nil, "", err
+	}
+	return parseAutoClaim(reply)
+}
+
+// разбирает ответ XAUTOCLAIM: [next, entries] в Redis 6.2 и [next, entries, deleted]
+// в Redis 7; удаленные из потока записи Redis 7 сам убирает из списка ожидающих
+func parseAutoClaim(reply interface{}) ([]goredis.XMessage, string, error) {
+	parts, ok := reply.([]interface{})
+	if !ok || len(parts) < 2 {
+		return nil, "", fmt.Errorf("unexpected XAUTOCLAIM reply: %v", reply)
+	}
+	next, ok := parts[0].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected XAUTOCLAIM cursor: %v", parts[0])
+	}
+	items, ok := parts[1].([]interface{})
+	if !ok {
+		return nil, "", fmt.Errorf("unexpected XAUTOCLAIM entries: %v", parts[1])
+	}
+
+	entries := make([]goredis.XMessage, 0, len(items))
+	for _, item := range items {
+		entry, err := parseEntry(item)
+		if err != nil {
+			return nil, "", err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, next, nil
+}
+
+// разбирает запись потока [id, [поле, значение, ...]]; у записи, удаленной из
+// потока, в Redis 6.2 вместо полей nil
+func parseEntry(item interface{}) (goredis.XMessage, error) {
+	fields, ok := item.([]interface{})
+	if !ok || len(fields) != 2 {
+		return goredis.XMessage{}, fmt.Errorf("unexpected stream entry: %v", item)
+	}
+	id, ok := fields[0].(string)
+	if !ok {
+		return goredis.XMessage{}, fmt.Errorf("unexpected stream entry ID: %v", fields[0])
+	}
+
+	entry := goredis.XMessage{ID: id}
+	if fields[1] == nil {
+		return entry, nil
+	}
+	pairs, ok := fields[1].([]interface{})
+	if !ok || len(pairs)%2 != 0 {
+		return goredis.XMessage{}, fmt.Errorf("unexpected fields of stream entry %s: %v", id, fields[1])
+	}
+
+	entry.Values = make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return goredis.XMessage{}, fmt.Errorf("unexpected field name of stream entry %s: %v", id, pairs[i])
+		}
+		entry.Values[key] = pairs[i+1]
+	}
+	return entry, nil
+}
+
+// обрабатывает запись и подтверждает ее, если она обработана или передана дальше;
+// redelivered - запись уже выдавалась группе и могла исчерпать MaxDeliveries
+func (c *Consumer) process(ctx context.Context, topic string, entry goredis.XMessage, redelivered bool) {
+	// Запись, удаленная из потока по MaxLen, приходит без полей
+	if len(entry.Values) == 0 {
+		c.ack(ctx, topic, entry.ID)
+		return
+	}
+
+	message := consumerMessage(topic, entry)
+	if redelivered && c.exhausted(ctx, topic, entry.ID) {
+		cause := fmt.Errorf("redis stream entry %s exceeded %d deliveries", entry.ID, c.config.MaxDeliveries)
+		if err := c.forwardFailed(ctx, message, cause); err != nil {
+			c.logger.WithError(err).WithField("topic", topic).Error("Failed to forward message to dead-letter stream")
+			return
+		}
+		c.logger.WithFields(logrus.Fields{
+			"topic": topic,
+			"id":    entry.ID,
+		}).Warn("Redis stream entry moved to dead-letter stream after too many deliveries")
+		c.ack(ctx, topic, entry.ID)
+		return
+	}
+
+	if c.handler != nil && !c.handle(ctx, message) {
+		return
+	}
+	c.ack(ctx, topic, entry.ID)
+}
+
+// проверяет по XPENDING, выдавалась ли запись группе больше MaxDeliveries раз;
+// без dead-letter потока запись не перекладывается и обрабатывается снова
+func (c *Consumer) exhausted(ctx context.Context, topic, id string) bool {
+	if c.config.MaxDeliveries <= 0 || c.deadLetters == "" {
+		return false
+	}
+
+	pending, err := c.client.XPendingExt(ctx, &goredis.XPendingExtArgs{
+		Stream: StreamKey(topic),
+		Group:  c.groupID,
+		Start:  id,
+		End:    id,
+		Count:  1,
+	}).Result()
+	if err != nil {
+		c.logger.WithError(err).WithField("topic", topic).Warn("Failed to get Redis stream delivery count")
+		return false
+	}
+	return len(pending) > 0 && pending[0].RetryCount > c.config.MaxDeliveries
+}
+
+// возвращает false, если запись нужно оставить неподтвержденной
+func (c *Consumer) handle(ctx context.Context, message *sarama.ConsumerMessage) bool {
+	err := c.callHandler(ctx, message)
+	if err == nil {
+		return true
+	}
+	c.logFailure(message, err)
+
+	if c.deliveryMode == kafka.DeliveryModeAtLeastOnce && !kafka.IsPermanent(err) {
+		return false
+	}
+	// Без dead-letter потока сюда доходит только постоянная ошибка в режиме
+	// at-least-once: повтор ее не исправит
+	if c.deadLetters == "" {
+		return true
+	}
+
+	if err := c.forwardFailed(ctx, message, err); err != nil {
+		c.logger.WithError(err).WithField("topic", message.Topic).Error("Failed to forward message to dead-letter stream")
+		return false
+	}
+	return true
+}
+
+// вызывает обработчик с контекстом запроса из заголовков сообщения,
+// ограничивая попытку MessageTimeout
+func (c *Consumer) callHandler(ctx context.Context, message *sarama.ConsumerMessage) error {
+	ctx = kafka.ContextFromMessage(ctx, message)
+	if c.config.MessageTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.config.MessageTimeout)
+		defer cancel()
+	}
+	return c.handler.HandleMessage(ctx, message)
+}
+
+// добавляет запись в dead-letter поток с заголовками как у kafka.DeadLetterQueue
+func (c *Consumer) forwardFailed(ctx context.Context, message *sarama.ConsumerMessage, cause error) error {
+	values, err := messageValues(&sarama.ProducerMessage{
+		Key:     sarama.ByteEncoder(message.Key),
+		Value:   sarama.ByteEncoder(message.Value),
+		Headers: kafka.DeadLetterHeaders(message, cause),
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: StreamKey(c.deadLetters),
+		MaxLen: c.config.MaxLen,
+		Approx: true,
+		Values: values,
+	}).Err()
+}
+
+func (c *Consumer) ack(ctx context.Context, topic, id string) {
+	if err := c.client.XAck(ctx, StreamKey(topic), c.groupID, id).Err(); err != nil {
+		// Неподтвержденная запись будет обработана повторно после ClaimIdle
+		c.logger.WithError(err).WithFields(logrus.Fields{
+			"topic": topic,
+			"id":    id,
+		}).Warn("Failed to acknowledge Redis stream entry")
+	}
+}
+
+func (c *Consumer) sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
+
+func (c *Consumer) logFailure(message *sarama.ConsumerMessage, err error) {
+	c.logger.WithError(err).WithFields(logrus.Fields{
+		"topic":  message.Topic,
+		"offset": message.Offset,
+		"id":     entryID(message.Offset),
+	}).Error("Failed to handle message")
+}
+
+// останавливает чтение; Start возвращает context.Canceled
+func (c *Consumer) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+// возвращает имя consumer в группе: имя хоста (pod), чтобы после перезапуска
+// consumer дочитал свои неподтвержденные записи
+func consumerName() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "local"
+	}
+	return name
+}
@@ -0,0 +1,148 @@
+package redisstream
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/redis"
+)
+
+func TestParseAutoClaim(t *testing.T) {
+	entries := []interface{}{
+		[]interface{}{"1-0", []interface{}{"value", "a", "key", "k"}},
+		// Redis 6.2 returns an entry trimmed from the stream without fields
+		[]interface{}{"2-0", nil},
+	}
+	want := []goredis.XMessage{
+		{ID: "1-0", Values: map[string]interface{}{"value": "a", "key": "k"}},
+		{ID: "2-0"},
+	}
+
+	tests := []struct {
+		name    string
+		reply   interface{}
+		want    []goredis.XMessage
+		next    string
+		wantErr bool
+	}{
+		{
+			name:  "Redis62",
+			reply: []interface{}{"3-0", entries},
+			want:  want,
+			next:  "3-0",
+		},
+		{
+			name:  "Redis7",
+			reply: []interface{}{"0-0", entries, []interface{}{"2-5"}},
+			want:  want,
+			next:  "0-0",
+		},
+		{
+			name:  "Empty",
+			reply: []interface{}{"0-0", []interface{}{}, []interface{}{}},
+			want:  []goredis.XMessage{},
+			next:  "0-0",
+		},
+		{
+			name:    "ShortReply",
+			reply:   []interface{}{"0-0"},
+			wantErr: true,
+		},
+		{
+			name:    "OddFields",
+			reply:   []interface{}{"0-0", []interface{}{[]interface{}{"1-0", []interface{}{"value"}}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, next, err := parseAutoClaim(tt.reply)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.next, next)
+		})
+	}
+}
+
+// запоминает полученные сообщения
+type recordingHandler struct {
+	messages chan *sarama.ConsumerMessage
+}
+
+func (h *recordingHandler) HandleMessage(ctx context.Context, message *sarama.ConsumerMessage) error {
+	h.messages <- message
+	return nil
+}
+
+func TestConsumerStart(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(mr.Addr(), "", 0, logger)
+	t.Cleanup(func() { client.Close() })
+
+	t.Run("ForwardRequiresDeadLetters", func(t *testing.T) {
+		consumer, err := NewConsumer(client, DefaultConfig(), []string{"events"}, "group", logger)
+		require.NoError(t, err)
+		assert.Error(t, consumer.Start(context.Background()))
+
+		require.NoError(t, consumer.SetDeliveryMode(kafka.DeliveryModeAtLeastOnce))
+		require.NoError(t, consumer.Close())
+		assert.ErrorIs(t, consumer.Start(context.Background()), context.Canceled)
+	})
+
+	t.Run("ClaimsPendingEntry", func(t *testing.T) {
+		ctx := context.Background()
+		rdb := client.Primary()
+		stream := StreamKey("claimed")
+		require.NoError(t, rdb.XGroupCreateMkStream(ctx, stream, "group", "$").Err())
+		require.NoError(t, rdb.XAdd(ctx, &goredis.XAddArgs{Stream: stream, Values: map[string]interface{}{"value": "a"}}).Err())
+
+		// Another consumer reads the entry and never acknowledges it
+		_, err := rdb.XReadGroup(ctx, &goredis.XReadGroupArgs{Group: "group", Consumer: "crashed", Streams: []string{stream, ">"}}).Result()
+		require.NoError(t, err)
+
+		config := DefaultConfig()
+		config.Block = 10 * time.Millisecond
+		config.ClaimIdle = time.Millisecond
+		config.ClaimInterval = 10 * time.Millisecond
+		consumer, err := NewConsumer(client, config, []string{"claimed"}, "group", logger)
+		require.NoError(t, err)
+		consumer.SetDeadLetterTopic("claimed.dlq")
+		handler := &recordingHandler{messages: make(chan *sarama.ConsumerMessage, 1)}
+		consumer.SetHandler(handler)
+
+		done := make(chan error, 1)
+		go func() { done <- consumer.Start(ctx) }()
+
+		select {
+		case message := <-handler.messages:
+			assert.Equal(t, []byte("a"), message.Value)
+		case <-time.After(5 * time.Second):
+			t.Fatal("pending entry was not claimed")
+		}
+		require.Eventually(t, func() bool {
+			pending, err := rdb.XPending(ctx, stream, "group").Result()
+			return err == nil && pending.Count == 0
+		}, 5*time.Second, 10*time.Millisecond)
+
+		require.NoError(t, consumer.Close())
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
@@ -0,0 +1,79 @@
+package redisstream
+
+import (
+	"context"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/redis"
+)
+
+// producer, который пишет события в потоки Redis; реализует kafka.ProducerInterface.
+// Каждый топик - отдельный поток stream:<topic>, тело и заголовки сообщения
+// кодируются так же, как для Kafka
+type Producer struct {
+	client goredis.UniversalClient
+	topic  string
+	codecs *kafka.TopicCodecs
+	maxLen int64
+	logger *logrus.Logger
+}
+
+// создает producer с топиком по умолчанию; codecs nil - JSON для всех топиков
+func NewProducer(client *redis.Client, config *Config, topic string, codecs *kafka.TopicCodecs, logger *logrus.Logger) *Producer {
+	return &Producer{
+		client: client.Primary(),
+		topic:  topic,
+		codecs: codecs,
+		maxLen: config.MaxLen,
+		logger: logger,
+	}
+}
+
+func (p *Producer) Topic() string {
+	return p.topic
+}
+
+func (p *Producer) SendMessage(ctx context.Context, key string, value interface{}) error {
+	return p.SendMessageToTopic(ctx, p.topic, key, value)
+}
+
+// добавляет сообщение в поток топика
+func (p *Producer) SendMessageToTopic(ctx context.Context, topic, key string, value interface{}) error {
+	msg, err := kafka.NewProducerMessage(ctx, p.codecs.ForTopic(topic), topic, key, value)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to marshal message")
+		return err
+	}
+	values, err := messageValues(msg)
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to encode message")
+		return err
+	}
+
+	id, err := p.client.XAdd(ctx, &goredis.XAddArgs{
+		Stream: StreamKey(topic),
+		MaxLen: p.maxLen,
+		Approx: true,
+		Values: values,
+	}).Result()
+	if err != nil {
+		p.logger.WithError(err).Error("Failed to send message to Redis stream")
+		return err
+	}
+
+	p.logger.WithFields(logrus.Fields{
+		"topic": topic,
+		"id":    id,
+		"key":   key,
+	}).Info("Message sent to Redis stream successfully")
+
+	return nil
+}
+
+// клиент Redis принадлежит вызывающему коду и закрывается им
+func (p *Producer) Close() error {
+	return nil
+}
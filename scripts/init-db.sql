@@ -20,6 +20,7 @@ CREATE TABLE IF NOT EXISTS transactions (
     service VARCHAR(50) NOT NULL,
     event_id VARCHAR(100),
     error_msg TEXT,
+    request_id VARCHAR(100),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -30,6 +31,7 @@ CREATE INDEX IF NOT EXISTS idx_transactions_service ON transactions(service);
 CREATE INDEX IF NOT EXISTS idx_transactions_kafka_status ON transactions(kafka_status);
 CREATE INDEX IF NOT EXISTS idx_transactions_redis_status ON transactions(redis_status);
 CREATE INDEX IF NOT EXISTS idx_transactions_event_id ON transactions(event_id);
+CREATE INDEX IF NOT EXISTS idx_transactions_request_id ON transactions(request_id);
 
 -- Создание таблицы событий (для истории)
 CREATE TABLE IF NOT EXISTS events (
@@ -75,6 +77,7 @@ CREATE TABLE IF NOT EXISTS health_checks (
     status VARCHAR(20) NOT NULL CHECK (status IN ('healthy', 'unhealthy', 'degraded')),
     response_time_ms INTEGER,
     error_message TEXT,
+    details JSONB,
     timestamp TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
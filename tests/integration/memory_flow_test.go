@@ -0,0 +1,260 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shopify/sarama"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/internal/models"
+	"pet-proj/internal/services"
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/kafka/kafkatest"
+	"pet-proj/pkg/monitoring"
+)
+
+func TestInMemoryEventFlow(t *testing.T) {
+	const (
+		topic   = "user-events"
+		groupID = "consumer-group"
+	)
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	broker := kafkatest.NewBroker(4)
+	require.NoError(t, broker.CreateTopic(topic, 4))
+
+	cache := newMemoryRedis()
+	store := &memoryPostgres{}
+
+	eventService := services.NewEventService(broker.NewProducer(topic, nil), cache, logger)
+	consumerService := services.NewConsumerService(cache, store, logger)
+
+	// Two members of one group share the topic partitions
+	startConsumer := func() (*kafkatest.Consumer, <-chan error) {
+		consumer := broker.NewConsumer([]string{topic}, groupID, logger)
+		consumer.SetInitialOffset(sarama.OffsetOldest)
+		consumer.SetHandler(consumerService)
+
+		done := make(chan error, 1)
+		go func() { done <- consumer.Start(ctx) }()
+		return consumer, done
+	}
+	first, firstDone := startConsumer()
+	second, secondDone := startConsumer()
+	defer second.Close()
+
+	sendEvents := func(count int) []string {
+		ids := make([]string, 0, count)
+		for i := 0; i < count; i++ {
+			event := models.NewEvent(models.EventTypeUserAction, fmt.Sprintf("user_%d", i), models.SourceProducer, map[string]interface{}{
+				"action": "click",
+			})
+			requestCtx := kafka.WithRequestID(ctx, "req-"+event.ID)
+			require.NoError(t, eventService.SendEvent(requestCtx, event))
+			ids = append(ids, event.ID)
+		}
+		return ids
+	}
+
+	var consumed []string
+	t.Run("ProduceAndConsume", func(t *testing.T) {
+		// Without a router messages are counted under the producer topic
+		sent := monitoring.KafkaMessagesTotal.WithLabelValues(topic, "success")
+		before := testutil.ToFloat64(sent)
+
+		ids := sendEvents(20)
+		consumed = ids
+		require.NoError(t, broker.WaitForCommitted(ctx, groupID, topic, 20))
+		assert.Equal(t, before+20, testutil.ToFloat64(sent))
+
+		for _, id := range ids {
+			processed, err := consumerService.GetProcessedEvent(ctx, id)
+			require.NoError(t, err)
+			assert.Equal(t, "processed", processed["status"])
+			assert.Equal(t, "req-"+id, store.requestID(id))
+		}
+	})
+
+	t.Run("BatchLookup", func(t *testing.T) {
+		require.Len(t, consumed, 20)
+		ids := []string{consumed[3], "missing-event", consumed[1], consumed[3]}
+
+		events, missing, err := eventService.GetEvents(ctx, ids)
+		require.NoError(t, err)
+		require.Len(t, events, 2)
+		assert.Equal(t, consumed[3], events[0].ID)
+		assert.Equal(t, consumed[1], events[1].ID)
+		assert.Equal(t, []string{"missing-event"}, missing)
+
+		processed, missing, err := consumerService.GetProcessedEvents(ctx, ids)
+		require.NoError(t, err)
+		require.Len(t, processed, 2)
+		assert.Equal(t, "processed", processed[0]["status"])
+		assert.Equal(t, []string{"missing-event"}, missing)
+
+		// Duplicates count once against the batch limit
+		eventService.SetMaxBatchSize(2)
+		defer eventService.SetMaxBatchSize(services.DefaultMaxBatchSize)
+		_, _, err = eventService.GetEvents(ctx, []string{consumed[0], consumed[0], consumed[1]})
+		assert.NoError(t, err)
+		_, _, err = eventService.GetEvents(ctx, consumed[:3])
+		assert.ErrorIs(t, err, services.ErrBatchTooLarge)
+	})
+
+	t.Run("Rebalance", func(t *testing.T) {
+		// The remaining member takes over the partitions of the closed one
+		require.NoError(t, first.Close())
+		assert.ErrorIs(t, <-firstDone, context.Canceled)
+
+		ids := sendEvents(10)
+		require.NoError(t, broker.WaitForCommitted(ctx, groupID, topic, 30))
+
+		for _, id := range ids {
+			_, err := consumerService.GetProcessedEvent(ctx, id)
+			assert.NoError(t, err)
+		}
+	})
+
+	t.Run("ProduceFault", func(t *testing.T) {
+		broker.InjectFault(kafkatest.OpProduce, topic, 1, sarama.ErrNotEnoughReplicas)
+
+		event := models.NewEvent(models.EventTypeUserAction, "user_fault", models.SourceProducer, nil)
+		assert.ErrorIs(t, eventService.SendEvent(ctx, event), sarama.ErrNotEnoughReplicas)
+		assert.NoError(t, eventService.SendEvent(ctx, event))
+	})
+
+	t.Run("FetchFault", func(t *testing.T) {
+		broker.InjectFault(kafkatest.OpFetch, groupID, 1, sarama.ErrOutOfBrokers)
+		broker.Rebalance(groupID)
+		assert.ErrorIs(t, <-secondDone, sarama.ErrOutOfBrokers)
+	})
+}
+
+// Redis client stub that keeps JSON values in memory
+type memoryRedis struct {
+	mu     sync.Mutex
+	values map[string][]byte
+}
+
+func newMemoryRedis() *memoryRedis {
+	return &memoryRedis{values: make(map[string][]byte)}
+}
+
+func (r *memoryRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.values[key] = data
+	return nil
+}
+
+func (r *memoryRedis) Get(ctx context.Context, key string, dest interface{}) error {
+	r.mu.Lock()
+	data, ok := r.values[key]
+	r.mu.Unlock()
+	if !ok {
+		return goredis.Nil
+	}
+	return json.Unmarshal(data, dest)
+}
+
+func (r *memoryRedis) GetMany(ctx context.Context, keys []string, dest func(key string) interface{}) ([]string, error) {
+	var missing []string
+	for _, key := range keys {
+		r.mu.Lock()
+		data, ok := r.values[key]
+		r.mu.Unlock()
+		if !ok {
+			missing = append(missing, key)
+			continue
+		}
+		if err := json.Unmarshal(data, dest(key)); err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+func (r *memoryRedis) Delete(ctx context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, key)
+	return nil
+}
+
+func (r *memoryRedis) Exists(ctx context.Context, key string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.values[key]
+	return ok, nil
+}
+
+func (r *memoryRedis) Ping(ctx context.Context) error { return nil }
+func (r *memoryRedis) Close() error                   { return nil }
+
+// PostgreSQL client stub that keeps transactions in memory
+type memoryPostgres struct {
+	mu           sync.Mutex
+	transactions []*models.Transaction
+}
+
+func (p *memoryPostgres) InsertTransaction(tx *models.Transaction) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.transactions = append(p.transactions, tx)
+	return nil
+}
+
+func (p *memoryPostgres) GetTransactions(limit int) ([]*models.Transaction, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if limit > len(p.transactions) {
+		limit = len(p.transactions)
+	}
+	return p.transactions[:limit], nil
+}
+
+func (p *memoryPostgres) GetTransactionStats() (map[string]interface{}, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return map[string]interface{}{"total_transactions": len(p.transactions)}, nil
+}
+
+func (p *memoryPostgres) CreateTransactionTable() error { return nil }
+
+func (p *memoryPostgres) InsertHealthCheck(check *models.HealthCheck) error {
+	return errors.New("health checks are not stored")
+}
+
+func (p *memoryPostgres) CreateHealthCheckTable() error { return nil }
+func (p *memoryPostgres) Close() error                  { return nil }
+
+// requestID returns the request ID recorded for the event
+func (p *memoryPostgres) requestID(eventID string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, tx := range p.transactions {
+		if tx.EventID == eventID {
+			return tx.RequestID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/internal/models"
+	"pet-proj/pkg/redis"
+)
+
+func TestRedisCacheCodecs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	newClient := func(codec, compression string) *redis.Client {
+		config := redis.DefaultConfig(addr, "", 0)
+		config.Codec = codec
+		config.Compression = compression
+		config.CompressionThreshold = 64
+
+		client, err := redis.NewClientFromConfig(config, logger)
+		require.NoError(t, err)
+		t.Cleanup(func() { client.Close() })
+		return client
+	}
+
+	legacy := newClient(redis.CodecJSON, redis.CompressionNone)
+	require.NoError(t, legacy.Ping(ctx))
+
+	event := models.NewEvent(models.EventTypeUserAction, "codec_user", models.SourceProducer, map[string]interface{}{
+		"count":   42,
+		"comment": strings.Repeat("large payload ", 20),
+	})
+
+	formats := []struct {
+		codec       string
+		compression string
+	}{
+		{redis.CodecJSON, redis.CompressionNone},
+		{redis.CodecJSON, redis.CompressionZstd},
+		{redis.CodecMsgpack, redis.CompressionNone},
+		{redis.CodecMsgpack, redis.CompressionZstd},
+		{redis.CodecMsgpack, redis.CompressionSnappy},
+		{redis.CodecProtobuf, redis.CompressionSnappy},
+	}
+	for _, format := range formats {
+		t.Run(format.codec+"_"+format.compression, func(t *testing.T) {
+			client := newClient(format.codec, format.compression)
+			key := fmt.Sprintf("test:codec:%s:%s:%d", format.codec, format.compression, time.Now().UnixNano())
+			defer legacy.Delete(context.Background(), key)
+
+			// Entries written in either format are readable by both clients during a rollout
+			require.NoError(t, client.Set(ctx, key, event, time.Minute))
+			var fromNew models.Event
+			require.NoError(t, legacy.Get(ctx, key, &fromNew))
+			assert.Equal(t, event.ID, fromNew.ID)
+			assert.Equal(t, event.Data["comment"], fromNew.Data["comment"])
+
+			require.NoError(t, legacy.Set(ctx, key, event, time.Minute))
+			var fromLegacy models.Event
+			require.NoError(t, client.Get(ctx, key, &fromLegacy))
+			assert.Equal(t, event.ID, fromLegacy.ID)
+		})
+	}
+
+	t.Run("MsgpackKeepsIntegers", func(t *testing.T) {
+		client := newClient(redis.CodecMsgpack, redis.CompressionNone)
+		key := fmt.Sprintf("test:codec:numbers:%d", time.Now().UnixNano())
+		defer legacy.Delete(context.Background(), key)
+
+		require.NoError(t, client.Set(ctx, key, event, time.Minute))
+		var cached models.Event
+		require.NoError(t, client.Get(ctx, key, &cached))
+		assert.Equal(t, int64(42), cached.Data["count"])
+	})
+
+	t.Run("UnknownCodec", func(t *testing.T) {
+		config := redis.DefaultConfig(addr, "", 0)
+		config.Codec = "xml"
+		_, err := redis.NewClientFromConfig(config, logger)
+		assert.Error(t, err)
+	})
+}
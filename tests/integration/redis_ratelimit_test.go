@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/pkg/redis"
+)
+
+func TestRedisRateLimiter(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	client := redis.NewClient(addr, "", 0, logger)
+	defer client.Close()
+	require.NoError(t, client.Ping(ctx))
+
+	limiter := redis.NewRateLimiter(client)
+	prefix := fmt.Sprintf("test:%d", time.Now().UnixNano())
+	cleanup := func(keys ...string) {
+		for _, key := range keys {
+			client.Delete(context.Background(), "ratelimit:"+key)
+		}
+	}
+
+	t.Run("Window", func(t *testing.T) {
+		key := prefix + ":window"
+		defer cleanup(key)
+		limits := []redis.RateLimit{{Key: key, Limit: 3, Window: time.Second}}
+
+		for i := 0; i < 3; i++ {
+			rejected, _, err := limiter.Allow(ctx, limits)
+			require.NoError(t, err)
+			assert.Equal(t, -1, rejected)
+		}
+
+		rejected, retryAfter, err := limiter.Allow(ctx, limits)
+		require.NoError(t, err)
+		assert.Equal(t, 0, rejected)
+		assert.Greater(t, retryAfter, time.Duration(0))
+		assert.LessOrEqual(t, retryAfter, time.Second)
+
+		// The oldest entry leaves the window and frees the quota
+		time.Sleep(retryAfter + 50*time.Millisecond)
+		rejected, _, err = limiter.Allow(ctx, limits)
+		require.NoError(t, err)
+		assert.Equal(t, -1, rejected)
+	})
+
+	t.Run("RejectedEventKeepsOtherQuotas", func(t *testing.T) {
+		user, client := prefix+":user", prefix+":client"
+		defer cleanup(user, client)
+		limits := []redis.RateLimit{
+			{Key: user, Limit: 2, Window: time.Minute},
+			{Key: client, Limit: 1, Window: time.Minute},
+		}
+
+		rejected, _, err := limiter.Allow(ctx, limits)
+		require.NoError(t, err)
+		assert.Equal(t, -1, rejected)
+
+		// The client quota rejects further events without using up the user quota
+		for i := 0; i < 3; i++ {
+			rejected, _, err = limiter.Allow(ctx, limits)
+			require.NoError(t, err)
+			assert.Equal(t, 1, rejected)
+		}
+
+		rejected, _, err = limiter.Allow(ctx, limits[:1])
+		require.NoError(t, err)
+		assert.Equal(t, -1, rejected)
+		rejected, _, err = limiter.Allow(ctx, limits[:1])
+		require.NoError(t, err)
+		assert.Equal(t, 0, rejected)
+	})
+}
@@ -0,0 +1,163 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"pet-proj/internal/models"
+	"pet-proj/internal/services"
+	"pet-proj/pkg/kafka"
+	"pet-proj/pkg/redis"
+	"pet-proj/pkg/redisstream"
+)
+
+func TestRedisStreamTransport(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := redis.NewClient(addr, "", 0, logger)
+	defer client.Close()
+	require.NoError(t, client.Ping(ctx))
+
+	// A unique topic keeps runs independent of each other
+	topic := fmt.Sprintf("test-events-%d", time.Now().UnixNano())
+	defer client.Primary().Del(context.Background(), redisstream.StreamKey(topic), redisstream.StreamKey(topic+".dlq"))
+
+	config := redisstream.DefaultConfig()
+	config.Block = 100 * time.Millisecond
+
+	cache := newMemoryRedis()
+	store := &memoryPostgres{}
+
+	eventService := services.NewEventService(redisstream.NewProducer(client, config, topic, nil, logger), cache, logger)
+	consumerService := services.NewConsumerService(cache, store, logger)
+
+	consumer, err := redisstream.NewConsumer(client, config, []string{topic}, "test-group", logger)
+	require.NoError(t, err)
+	consumer.SetDeadLetterTopic(topic + ".dlq")
+	consumer.SetHandler(consumerService)
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+
+	// The group reads only new entries, so wait until it exists. XInfoGroups of
+	// go-redis v8 fails on the Redis 7 reply, so the raw reply is checked
+	require.Eventually(t, func() bool {
+		groups, err := client.Primary().Do(ctx, "XINFO", "GROUPS", redisstream.StreamKey(topic)).Slice()
+		return err == nil && len(groups) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	ids := make([]string, 0, 10)
+	for i := 0; i < 10; i++ {
+		event := models.NewEvent(models.EventTypeUserAction, fmt.Sprintf("user_%d", i), models.SourceProducer, map[string]interface{}{
+			"action": "click",
+		})
+		require.NoError(t, eventService.SendEvent(kafka.WithRequestID(ctx, "req-"+event.ID), event))
+		ids = append(ids, event.ID)
+	}
+
+	for _, id := range ids {
+		require.Eventually(t, func() bool {
+			processed, err := consumerService.GetProcessedEvent(ctx, id)
+			return err == nil && processed["status"] == "processed"
+		}, 10*time.Second, 50*time.Millisecond)
+		assert.Equal(t, "req-"+id, store.requestID(id))
+	}
+
+	// Every entry is acknowledged after processing
+	require.Eventually(t, func() bool {
+		pending, err := client.Primary().XPending(ctx, redisstream.StreamKey(topic), "test-group").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, consumer.Close())
+	assert.ErrorIs(t, <-done, context.Canceled)
+}
+
+func TestRedisStreamClaimPending(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping integration test in short mode")
+	}
+
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		addr = "localhost:6379"
+	}
+
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := redis.NewClient(addr, "", 0, logger)
+	defer client.Close()
+	require.NoError(t, client.Ping(ctx))
+
+	topic := fmt.Sprintf("test-claim-%d", time.Now().UnixNano())
+	stream := redisstream.StreamKey(topic)
+	defer client.Primary().Del(context.Background(), stream, redisstream.StreamKey(topic+".dlq"))
+
+	config := redisstream.DefaultConfig()
+	config.Block = 100 * time.Millisecond
+	config.ClaimIdle = 200 * time.Millisecond
+	config.ClaimInterval = 100 * time.Millisecond
+
+	cache := newMemoryRedis()
+	consumerService := services.NewConsumerService(cache, &memoryPostgres{}, logger)
+
+	require.NoError(t, client.Primary().XGroupCreateMkStream(ctx, stream, "test-group", "$").Err())
+	event := models.NewEvent(models.EventTypeUserAction, "user_1", models.SourceProducer, map[string]interface{}{
+		"action": "click",
+	})
+	require.NoError(t, redisstream.NewProducer(client, config, topic, nil, logger).SendMessage(ctx, event.ID, event))
+
+	// A consumer that crashed before acknowledging leaves the entry pending
+	_, err := client.Primary().XReadGroup(ctx, &goredis.XReadGroupArgs{
+		Group:    "test-group",
+		Consumer: "crashed-consumer",
+		Streams:  []string{stream, ">"},
+	}).Result()
+	require.NoError(t, err)
+
+	consumer, err := redisstream.NewConsumer(client, config, []string{topic}, "test-group", logger)
+	require.NoError(t, err)
+	consumer.SetDeadLetterTopic(topic + ".dlq")
+	consumer.SetHandler(consumerService)
+
+	done := make(chan error, 1)
+	go func() { done <- consumer.Start(ctx) }()
+
+	require.Eventually(t, func() bool {
+		processed, err := consumerService.GetProcessedEvent(ctx, event.ID)
+		return err == nil && processed["status"] == "processed"
+	}, 10*time.Second, 50*time.Millisecond)
+
+	require.Eventually(t, func() bool {
+		pending, err := client.Primary().XPending(ctx, stream, "test-group").Result()
+		return err == nil && pending.Count == 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, consumer.Close())
+	assert.ErrorIs(t, <-done, context.Canceled)
+}